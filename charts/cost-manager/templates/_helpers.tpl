@@ -0,0 +1,25 @@
+{{/*
+cost-manager.webhookEnabled renders "true" when the configuration enables the pod-safe-to-evict-annotator
+webhook so that the webhook resources are only deployed when cost-manager serves the webhook
+*/}}
+{{- define "cost-manager.webhookEnabled" -}}
+{{- $podSafeToEvictAnnotator := .Values.config.podSafeToEvictAnnotator | default dict }}
+{{- if and (has "pod-safe-to-evict-annotator" (.Values.config.controllers | default list)) (kindIs "map" (get $podSafeToEvictAnnotator "webhook")) -}}
+true
+{{- end }}
+{{- end }}
+
+{{/*
+cost-manager.webhookPort renders the port that the webhook server listens on
+*/}}
+{{- define "cost-manager.webhookPort" -}}
+{{- dig "podSafeToEvictAnnotator" "webhook" "port" 9443 .Values.config }}
+{{- end }}
+
+{{/*
+cost-manager.webhookCertDir renders the directory that the webhook server loads its serving
+certificate from
+*/}}
+{{- define "cost-manager.webhookCertDir" -}}
+{{- dig "podSafeToEvictAnnotator" "webhook" "certDir" "/tmp/k8s-webhook-server/serving-certs" .Values.config }}
+{{- end }}
@@ -0,0 +1,49 @@
+// fake-cloud-provider-plugin is a reference implementation of a cloud provider plugin for the
+// external cloud provider that serves the fake cloud provider
+package main
+
+import (
+	"flag"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/external"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func main() {
+	var address string
+	flag.StringVar(&address, "address", "unix:///tmp/cost-manager-plugin.sock", "The address to serve the plugin on; either unix://<path> or <host>:<port>")
+	flag.Parse()
+	logger := zap.New()
+
+	network := "tcp"
+	if strings.HasPrefix(address, "unix://") {
+		network = "unix"
+		address = strings.TrimPrefix(address, "unix://")
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		logger.Error(err, "Failed to listen", "address", address)
+		os.Exit(1)
+	}
+
+	server := external.NewServer(&fake.CloudProvider{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		server.GracefulStop()
+	}()
+
+	logger.Info("Serving fake cloud provider plugin", "network", network, "address", address)
+	err = server.Serve(listener)
+	if err != nil {
+		logger.Error(err, "Failed to serve plugin")
+		os.Exit(1)
+	}
+}
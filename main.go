@@ -7,13 +7,18 @@ import (
 	costmanagerconfig "github.com/hsbc/cost-manager/pkg/config"
 	"github.com/hsbc/cost-manager/pkg/controller"
 	"github.com/hsbc/cost-manager/pkg/kubernetes"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 func init() {
@@ -49,12 +54,32 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Configure webhook server; this is only started if a webhook is registered by a controller
+	webhookServerOptions := webhook.Options{}
+	if costManagerConfig.PodSafeToEvictAnnotator != nil && costManagerConfig.PodSafeToEvictAnnotator.Webhook != nil {
+		webhookServerOptions.Port = costManagerConfig.PodSafeToEvictAnnotator.Webhook.Port
+		webhookServerOptions.CertDir = costManagerConfig.PodSafeToEvictAnnotator.Webhook.CertDir
+	}
+
 	// Setup controller manager
 	logger.Info("Setting up controller manager")
 	restConfig := config.GetConfigOrDie()
 	// Disable client-side rate-limiting: https://github.com/kubernetes/kubernetes/issues/111880
 	restConfig.QPS = -1
-	mgr, err := ctrl.NewManager(restConfig, manager.Options{Scheme: scheme})
+	mgr, err := ctrl.NewManager(restConfig, manager.Options{
+		Scheme:        scheme,
+		WebhookServer: webhook.NewServer(webhookServerOptions),
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				// We only watch Events involving Nodes to avoid caching all Events in the cluster;
+				// note that this applies to every controller using the manager's cache so any
+				// controller that needs other Events must use its own cache or an uncached client
+				&corev1.Event{}: {
+					Field: fields.OneTermEqualSelector("involvedObject.kind", "Node"),
+				},
+			},
+		},
+	})
 	if err != nil {
 		logger.Error(err, "failed to setup controller manager")
 		os.Exit(1)
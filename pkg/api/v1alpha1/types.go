@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -12,17 +13,256 @@ type CostManagerConfiguration struct {
 	Controllers             []string                 `json:"controllers,omitempty"`
 	CloudProvider           CloudProvider            `json:"cloudProvider"`
 	SpotMigrator            *SpotMigrator            `json:"spotMigrator,omitempty"`
+	SpotPreemptionHandler   *SpotPreemptionHandler   `json:"spotPreemptionHandler,omitempty"`
 	PodSafeToEvictAnnotator *PodSafeToEvictAnnotator `json:"podSafeToEvictAnnotator,omitempty"`
 }
 
 type CloudProvider struct {
 	Name string `json:"name"`
+	// GCP configures the gcp cloud provider
+	GCP *GCPCloudProvider `json:"gcp,omitempty"`
+	// AWS configures the aws cloud provider
+	AWS *AWSCloudProvider `json:"aws,omitempty"`
+	// Azure configures the azure cloud provider
+	Azure *AzureCloudProvider `json:"azure,omitempty"`
+	// ClusterAPI configures the clusterapi cloud provider
+	ClusterAPI *ClusterAPICloudProvider `json:"clusterAPI,omitempty"`
+	// Generic configures the generic cloud provider
+	Generic *GenericCloudProvider `json:"generic,omitempty"`
+	// External configures the external cloud provider
+	External *ExternalCloudProvider `json:"external,omitempty"`
 }
 
+type GCPCloudProvider struct {
+	// CredentialsFile is the path to a credentials file to use instead of the default credentials
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+	// ImpersonateServiceAccount is the email address of a service account to impersonate
+	ImpersonateServiceAccount string `json:"impersonateServiceAccount,omitempty"`
+	// QuotaProject is the project that is used for quota and billing of API requests
+	QuotaProject string `json:"quotaProject,omitempty"`
+	// Endpoint overrides the Compute API endpoint
+	Endpoint string `json:"endpoint,omitempty"`
+	// UserAgent overrides the user agent of API requests
+	UserAgent string `json:"userAgent,omitempty"`
+	// OperationTimeout is how long to wait for each compute operation; defaults to 10 minutes
+	OperationTimeout *metav1.Duration `json:"operationTimeout,omitempty"`
+	// ManagedInstanceGroupStabilityTimeout is how long to wait for stability; defaults to 10 minutes
+	ManagedInstanceGroupStabilityTimeout *metav1.Duration `json:"managedInstanceGroupStabilityTimeout,omitempty"`
+	// LoadBalancerDrainDelay is how long to let load balancers drain; defaults to 1 minute
+	LoadBalancerDrainDelay *metav1.Duration `json:"loadBalancerDrainDelay,omitempty"`
+	// WaitForBackendServiceHealth waits for backend services to report the instance as not healthy
+	WaitForBackendServiceHealth bool `json:"waitForBackendServiceHealth,omitempty"`
+	// BackendServiceHealthTimeout is how long to wait for backend services; defaults to 10 minutes
+	BackendServiceHealthTimeout *metav1.Duration `json:"backendServiceHealthTimeout,omitempty"`
+	// SpotNodePoolPreflightCheck checks that each on-demand node pool has a matching spot node pool
+	SpotNodePoolPreflightCheck *GKESpotNodePoolPreflightCheck `json:"spotNodePoolPreflightCheck,omitempty"`
+	// InstancePrices are the hourly prices of instances
+	InstancePrices []InstancePrice `json:"instancePrices,omitempty"`
+	// DeletionMode determines how on-demand Nodes are removed; defaults to DeleteInstance
+	DeletionMode GCPDeletionMode `json:"deletionMode,omitempty"`
+	// Taint is added to Nodes when using the Taint deletion mode; defaults to cost-manager.io/delete
+	Taint *corev1.Taint `json:"taint,omitempty"`
+	// NodePoolMinimumSizeCheck checks whether the node pool of a Node is at its minimum size
+	NodePoolMinimumSizeCheck *GKENodePoolMinimumSizeCheck `json:"nodePoolMinimumSizeCheck,omitempty"`
+}
+
+type GCPDeletionMode string
+
+const (
+	// GCPDeletionModeDeleteInstance deletes the instance from its managed instance group
+	GCPDeletionModeDeleteInstance GCPDeletionMode = "DeleteInstance"
+	// GCPDeletionModeTaint taints the Node and leaves its removal to the cluster autoscaler
+	GCPDeletionModeTaint GCPDeletionMode = "Taint"
+)
+
+type GKENodePoolMinimumSizeCheck struct {
+	// Action determines what happens when the node pool is at its minimum size; defaults to Warn
+	Action GKENodePoolMinimumSizeAction `json:"action,omitempty"`
+	// Cluster is the full resource name of the GKE cluster
+	Cluster string `json:"cluster,omitempty"`
+	// Endpoint overrides the GKE API endpoint
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+type GKENodePoolMinimumSizeAction string
+
+const (
+	// GKENodePoolMinimumSizeActionWarn deletes the instance anyway and logs a warning
+	GKENodePoolMinimumSizeActionWarn GKENodePoolMinimumSizeAction = "Warn"
+	// GKENodePoolMinimumSizeActionRefuse prevents the Node from being selected for deletion
+	GKENodePoolMinimumSizeActionRefuse GKENodePoolMinimumSizeAction = "Refuse"
+)
+
+type InstancePrice struct {
+	// MachineType is the machine type that the price applies to (e.g. n2-standard-4)
+	MachineType string `json:"machineType"`
+	// ProvisioningModel is the provisioning model that the price applies to (e.g. SPOT)
+	ProvisioningModel string `json:"provisioningModel,omitempty"`
+	// HourlyPrice is the price of running an instance for an hour
+	HourlyPrice float64 `json:"hourlyPrice"`
+}
+
+type GKESpotNodePoolPreflightCheck struct {
+	// Cluster is the full resource name of the GKE cluster
+	Cluster string `json:"cluster,omitempty"`
+	// Endpoint overrides the GKE API endpoint
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+type AWSCloudProvider struct {
+	// Region is the AWS region of the cluster
+	Region string `json:"region,omitempty"`
+	// Endpoint overrides the Auto Scaling API endpoint
+	Endpoint string `json:"endpoint,omitempty"`
+	// LoadBalancerDeregistrationDelay is how long to let targets deregister; defaults to 5 minutes
+	LoadBalancerDeregistrationDelay *metav1.Duration `json:"loadBalancerDeregistrationDelay,omitempty"`
+}
+
+type AzureCloudProvider struct {
+	// TenantID is the Microsoft Entra tenant to authenticate with
+	TenantID string `json:"tenantID,omitempty"`
+	// ManagedIdentityClientID is the client ID of a user-assigned managed identity
+	ManagedIdentityClientID string `json:"managedIdentityClientID,omitempty"`
+	// Endpoint overrides the Azure Resource Manager endpoint
+	Endpoint string `json:"endpoint,omitempty"`
+	// LoadBalancerDrainDelay is how long to let load balancers drain; defaults to 30 seconds
+	LoadBalancerDrainDelay *metav1.Duration `json:"loadBalancerDrainDelay,omitempty"`
+}
+
+type ClusterAPICloudProvider struct {
+	// SpotInstanceLabelKey is the key of the Node or Machine label that identifies spot instances
+	SpotInstanceLabelKey string `json:"spotInstanceLabelKey"`
+	// SpotInstanceLabelValue is the value of the spot instance label; defaults to "true"
+	SpotInstanceLabelValue string `json:"spotInstanceLabelValue,omitempty"`
+}
+
+type GenericCloudProvider struct {
+	// SpotInstanceSelector is a label selector expression that matches spot Nodes
+	SpotInstanceSelector string `json:"spotInstanceSelector"`
+	// DeletionPolicy determines how Nodes are removed; defaults to Delete
+	DeletionPolicy GenericDeletionPolicy `json:"deletionPolicy,omitempty"`
+	// Taint is added to Nodes when using the Taint deletion policy; defaults to cost-manager.io/delete
+	Taint *corev1.Taint `json:"taint,omitempty"`
+}
+
+type ExternalCloudProvider struct {
+	// Endpoint is the gRPC endpoint of the cloud provider plugin
+	Endpoint string `json:"endpoint"`
+}
+
+type GenericDeletionPolicy string
+
+const (
+	// GenericDeletionPolicyDelete deletes the Node object from the Kubernetes API server
+	GenericDeletionPolicyDelete GenericDeletionPolicy = "Delete"
+	// GenericDeletionPolicyTaint taints the Node and leaves its removal to an external autoscaler
+	GenericDeletionPolicyTaint GenericDeletionPolicy = "Taint"
+)
+
 type SpotMigrator struct {
 	MigrationSchedule *string `json:"migrationSchedule,omitempty"`
+	// MigrationScheduleJitter is the maximum amount of time by which each migration is delayed
+	MigrationScheduleJitter *metav1.Duration `json:"migrationScheduleJitter,omitempty"`
+	// MinOnDemandNodes is the minimum number of on-demand Nodes to leave running
+	MinOnDemandNodes *int32 `json:"minOnDemandNodes,omitempty"`
+	// MinOnDemandFraction is the minimum fraction of Nodes to leave running on-demand
+	MinOnDemandFraction *float64 `json:"minOnDemandFraction,omitempty"`
+	// MinOnDemandPerZone applies the minimum on-demand guardrail to each zone separately
+	MinOnDemandPerZone bool `json:"minOnDemandPerZone,omitempty"`
+	// HealthGate is checked before each Node is drained
+	HealthGate *HealthGate `json:"healthGate,omitempty"`
+	// Canary verifies that evicted workloads recover after the first Node is drained
+	Canary *Canary `json:"canary,omitempty"`
+	// MaxRunDuration bounds how long a single spot migration run can take
+	MaxRunDuration *metav1.Duration `json:"maxRunDuration,omitempty"`
+	// MaxRunDurationAction determines what happens when MaxRunDuration is reached; defaults to Finish
+	MaxRunDurationAction MaxRunDurationAction `json:"maxRunDurationAction,omitempty"`
+	// DrainTimeout is how long to wait for a Node to drain before giving up; defaults to 1 hour
+	DrainTimeout *metav1.Duration `json:"drainTimeout,omitempty"`
+	// Policies allow groups of Nodes (e.g. node pools) to be migrated independently
+	Policies []SpotMigrationPolicy `json:"policies,omitempty"`
+}
+
+// SpotMigrationPolicy configures spot migration for the Nodes selected by NodeSelector
+type SpotMigrationPolicy struct {
+	Name string `json:"name"`
+	// NodeSelector selects the Nodes that the policy applies to
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+	// SpotNodeSelector selects the spot Nodes counted by the minimum on-demand fraction guardrail
+	SpotNodeSelector     *metav1.LabelSelector `json:"spotNodeSelector,omitempty"`
+	MigrationSchedule    *string               `json:"migrationSchedule,omitempty"`
+	MinOnDemandNodes     *int32                `json:"minOnDemandNodes,omitempty"`
+	MinOnDemandFraction  *float64              `json:"minOnDemandFraction,omitempty"`
+	MinOnDemandPerZone   *bool                 `json:"minOnDemandPerZone,omitempty"`
+	MaxRunDuration       *metav1.Duration      `json:"maxRunDuration,omitempty"`
+	MaxRunDurationAction MaxRunDurationAction  `json:"maxRunDurationAction,omitempty"`
+	DrainTimeout         *metav1.Duration      `json:"drainTimeout,omitempty"`
+	HealthGate           *HealthGate           `json:"healthGate,omitempty"`
+	Canary               *Canary               `json:"canary,omitempty"`
+}
+
+type MaxRunDurationAction string
+
+const (
+	// MaxRunDurationActionFinish allows an in-flight drain to finish and the Node to be deleted
+	MaxRunDurationActionFinish MaxRunDurationAction = "Finish"
+	// MaxRunDurationActionRollback stops an in-flight drain and makes the Node schedulable again
+	MaxRunDurationActionRollback MaxRunDurationAction = "Rollback"
+)
+
+type Canary struct {
+	// Timeout is how long to wait for evicted workloads to become fully available again
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+type HealthGateAction string
+
+const (
+	// HealthGateActionPause waits for the cluster to become healthy before continuing
+	HealthGateActionPause HealthGateAction = "Pause"
+	// HealthGateActionAbort stops the migration as soon as the cluster is unhealthy
+	HealthGateActionAbort HealthGateAction = "Abort"
+)
+
+type HealthGate struct {
+	// MaxPendingPods is the maximum number of Pods that can be Pending for PendingPodMinAge
+	MaxPendingPods *int32 `json:"maxPendingPods,omitempty"`
+	// PendingPodMinAge is how long a Pod must have existed before it is counted as Pending
+	PendingPodMinAge *metav1.Duration `json:"pendingPodMinAge,omitempty"`
+	// MaxNotReadyNodes is the maximum number of Nodes that can be NotReady
+	MaxNotReadyNodes *int32 `json:"maxNotReadyNodes,omitempty"`
+	// MaxUnavailableDeployments is the maximum number of Deployments that can be unavailable
+	MaxUnavailableDeployments *int32 `json:"maxUnavailableDeployments,omitempty"`
+	// Action determines what happens when the cluster is unhealthy; defaults to Pause
+	Action HealthGateAction `json:"action,omitempty"`
+	// PauseTimeout is how long to wait for the cluster to become healthy before aborting
+	PauseTimeout *metav1.Duration `json:"pauseTimeout,omitempty"`
+}
+
+type SpotPreemptionHandler struct {
+	// DrainTimeout is how long to spend draining a preempted Node; defaults to 25 seconds
+	DrainTimeout *metav1.Duration `json:"drainTimeout,omitempty"`
+	// MaxConcurrentDrains is the maximum number of concurrent drains; defaults to 10
+	MaxConcurrentDrains *int32 `json:"maxConcurrentDrains,omitempty"`
 }
 
 type PodSafeToEvictAnnotator struct {
 	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// PodSelector restricts annotation to Pods with matching labels
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// ExcludePodSelector prevents Pods with matching labels from being annotated
+	ExcludePodSelector *metav1.LabelSelector `json:"excludePodSelector,omitempty"`
+	// OwnerKinds restricts annotation to Pods whose controller is one of the kinds
+	OwnerKinds []string `json:"ownerKinds,omitempty"`
+	// RequireMultipleReplicas restricts annotation to Pods whose controller has multiple replicas
+	RequireMultipleReplicas bool `json:"requireMultipleReplicas,omitempty"`
+	// Webhook enables a mutating admission webhook that annotates Pods when they are created
+	Webhook *PodSafeToEvictAnnotatorWebhook `json:"webhook,omitempty"`
+}
+
+type PodSafeToEvictAnnotatorWebhook struct {
+	// Port is the port that the webhook server listens on; defaults to 9443
+	Port int `json:"port,omitempty"`
+	// CertDir is the directory containing the serving certificate files
+	CertDir string `json:"certDir,omitempty"`
 }
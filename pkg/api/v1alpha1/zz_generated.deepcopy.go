@@ -22,13 +22,107 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AWSCloudProvider) DeepCopyInto(out *AWSCloudProvider) {
+	*out = *in
+	if in.LoadBalancerDeregistrationDelay != nil {
+		in, out := &in.LoadBalancerDeregistrationDelay, &out.LoadBalancerDeregistrationDelay
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AWSCloudProvider.
+func (in *AWSCloudProvider) DeepCopy() *AWSCloudProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(AWSCloudProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureCloudProvider) DeepCopyInto(out *AzureCloudProvider) {
+	*out = *in
+	if in.LoadBalancerDrainDelay != nil {
+		in, out := &in.LoadBalancerDrainDelay, &out.LoadBalancerDrainDelay
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureCloudProvider.
+func (in *AzureCloudProvider) DeepCopy() *AzureCloudProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureCloudProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Canary) DeepCopyInto(out *Canary) {
+	*out = *in
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Canary.
+func (in *Canary) DeepCopy() *Canary {
+	if in == nil {
+		return nil
+	}
+	out := new(Canary)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CloudProvider) DeepCopyInto(out *CloudProvider) {
 	*out = *in
+	if in.GCP != nil {
+		in, out := &in.GCP, &out.GCP
+		*out = new(GCPCloudProvider)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AWS != nil {
+		in, out := &in.AWS, &out.AWS
+		*out = new(AWSCloudProvider)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Azure != nil {
+		in, out := &in.Azure, &out.Azure
+		*out = new(AzureCloudProvider)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClusterAPI != nil {
+		in, out := &in.ClusterAPI, &out.ClusterAPI
+		*out = new(ClusterAPICloudProvider)
+		**out = **in
+	}
+	if in.Generic != nil {
+		in, out := &in.Generic, &out.Generic
+		*out = new(GenericCloudProvider)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.External != nil {
+		in, out := &in.External, &out.External
+		*out = new(ExternalCloudProvider)
+		**out = **in
+	}
 	return
 }
 
@@ -42,6 +136,22 @@ func (in *CloudProvider) DeepCopy() *CloudProvider {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterAPICloudProvider) DeepCopyInto(out *ClusterAPICloudProvider) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterAPICloudProvider.
+func (in *ClusterAPICloudProvider) DeepCopy() *ClusterAPICloudProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterAPICloudProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CostManagerConfiguration) DeepCopyInto(out *CostManagerConfiguration) {
 	*out = *in
@@ -51,12 +161,17 @@ func (in *CostManagerConfiguration) DeepCopyInto(out *CostManagerConfiguration)
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
-	out.CloudProvider = in.CloudProvider
+	in.CloudProvider.DeepCopyInto(&out.CloudProvider)
 	if in.SpotMigrator != nil {
 		in, out := &in.SpotMigrator, &out.SpotMigrator
 		*out = new(SpotMigrator)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.SpotPreemptionHandler != nil {
+		in, out := &in.SpotPreemptionHandler, &out.SpotPreemptionHandler
+		*out = new(SpotPreemptionHandler)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.PodSafeToEvictAnnotator != nil {
 		in, out := &in.PodSafeToEvictAnnotator, &out.PodSafeToEvictAnnotator
 		*out = new(PodSafeToEvictAnnotator)
@@ -83,6 +198,188 @@ func (in *CostManagerConfiguration) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalCloudProvider) DeepCopyInto(out *ExternalCloudProvider) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalCloudProvider.
+func (in *ExternalCloudProvider) DeepCopy() *ExternalCloudProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalCloudProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GCPCloudProvider) DeepCopyInto(out *GCPCloudProvider) {
+	*out = *in
+	if in.OperationTimeout != nil {
+		in, out := &in.OperationTimeout, &out.OperationTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.ManagedInstanceGroupStabilityTimeout != nil {
+		in, out := &in.ManagedInstanceGroupStabilityTimeout, &out.ManagedInstanceGroupStabilityTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.LoadBalancerDrainDelay != nil {
+		in, out := &in.LoadBalancerDrainDelay, &out.LoadBalancerDrainDelay
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.BackendServiceHealthTimeout != nil {
+		in, out := &in.BackendServiceHealthTimeout, &out.BackendServiceHealthTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.SpotNodePoolPreflightCheck != nil {
+		in, out := &in.SpotNodePoolPreflightCheck, &out.SpotNodePoolPreflightCheck
+		*out = new(GKESpotNodePoolPreflightCheck)
+		**out = **in
+	}
+	if in.InstancePrices != nil {
+		in, out := &in.InstancePrices, &out.InstancePrices
+		*out = make([]InstancePrice, len(*in))
+		copy(*out, *in)
+	}
+	if in.Taint != nil {
+		in, out := &in.Taint, &out.Taint
+		*out = new(corev1.Taint)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NodePoolMinimumSizeCheck != nil {
+		in, out := &in.NodePoolMinimumSizeCheck, &out.NodePoolMinimumSizeCheck
+		*out = new(GKENodePoolMinimumSizeCheck)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GCPCloudProvider.
+func (in *GCPCloudProvider) DeepCopy() *GCPCloudProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(GCPCloudProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GKENodePoolMinimumSizeCheck) DeepCopyInto(out *GKENodePoolMinimumSizeCheck) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GKENodePoolMinimumSizeCheck.
+func (in *GKENodePoolMinimumSizeCheck) DeepCopy() *GKENodePoolMinimumSizeCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(GKENodePoolMinimumSizeCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GKESpotNodePoolPreflightCheck) DeepCopyInto(out *GKESpotNodePoolPreflightCheck) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GKESpotNodePoolPreflightCheck.
+func (in *GKESpotNodePoolPreflightCheck) DeepCopy() *GKESpotNodePoolPreflightCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(GKESpotNodePoolPreflightCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GenericCloudProvider) DeepCopyInto(out *GenericCloudProvider) {
+	*out = *in
+	if in.Taint != nil {
+		in, out := &in.Taint, &out.Taint
+		*out = new(corev1.Taint)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GenericCloudProvider.
+func (in *GenericCloudProvider) DeepCopy() *GenericCloudProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(GenericCloudProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HealthGate) DeepCopyInto(out *HealthGate) {
+	*out = *in
+	if in.MaxPendingPods != nil {
+		in, out := &in.MaxPendingPods, &out.MaxPendingPods
+		*out = new(int32)
+		**out = **in
+	}
+	if in.PendingPodMinAge != nil {
+		in, out := &in.PendingPodMinAge, &out.PendingPodMinAge
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaxNotReadyNodes != nil {
+		in, out := &in.MaxNotReadyNodes, &out.MaxNotReadyNodes
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxUnavailableDeployments != nil {
+		in, out := &in.MaxUnavailableDeployments, &out.MaxUnavailableDeployments
+		*out = new(int32)
+		**out = **in
+	}
+	if in.PauseTimeout != nil {
+		in, out := &in.PauseTimeout, &out.PauseTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HealthGate.
+func (in *HealthGate) DeepCopy() *HealthGate {
+	if in == nil {
+		return nil
+	}
+	out := new(HealthGate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InstancePrice) DeepCopyInto(out *InstancePrice) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InstancePrice.
+func (in *InstancePrice) DeepCopy() *InstancePrice {
+	if in == nil {
+		return nil
+	}
+	out := new(InstancePrice)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PodSafeToEvictAnnotator) DeepCopyInto(out *PodSafeToEvictAnnotator) {
 	*out = *in
@@ -91,6 +388,26 @@ func (in *PodSafeToEvictAnnotator) DeepCopyInto(out *PodSafeToEvictAnnotator) {
 		*out = new(v1.LabelSelector)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.PodSelector != nil {
+		in, out := &in.PodSelector, &out.PodSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExcludePodSelector != nil {
+		in, out := &in.ExcludePodSelector, &out.ExcludePodSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OwnerKinds != nil {
+		in, out := &in.OwnerKinds, &out.OwnerKinds
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Webhook != nil {
+		in, out := &in.Webhook, &out.Webhook
+		*out = new(PodSafeToEvictAnnotatorWebhook)
+		**out = **in
+	}
 	return
 }
 
@@ -104,6 +421,88 @@ func (in *PodSafeToEvictAnnotator) DeepCopy() *PodSafeToEvictAnnotator {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PodSafeToEvictAnnotatorWebhook) DeepCopyInto(out *PodSafeToEvictAnnotatorWebhook) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PodSafeToEvictAnnotatorWebhook.
+func (in *PodSafeToEvictAnnotatorWebhook) DeepCopy() *PodSafeToEvictAnnotatorWebhook {
+	if in == nil {
+		return nil
+	}
+	out := new(PodSafeToEvictAnnotatorWebhook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpotMigrationPolicy) DeepCopyInto(out *SpotMigrationPolicy) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SpotNodeSelector != nil {
+		in, out := &in.SpotNodeSelector, &out.SpotNodeSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MigrationSchedule != nil {
+		in, out := &in.MigrationSchedule, &out.MigrationSchedule
+		*out = new(string)
+		**out = **in
+	}
+	if in.MinOnDemandNodes != nil {
+		in, out := &in.MinOnDemandNodes, &out.MinOnDemandNodes
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MinOnDemandFraction != nil {
+		in, out := &in.MinOnDemandFraction, &out.MinOnDemandFraction
+		*out = new(float64)
+		**out = **in
+	}
+	if in.MinOnDemandPerZone != nil {
+		in, out := &in.MinOnDemandPerZone, &out.MinOnDemandPerZone
+		*out = new(bool)
+		**out = **in
+	}
+	if in.MaxRunDuration != nil {
+		in, out := &in.MaxRunDuration, &out.MaxRunDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.DrainTimeout != nil {
+		in, out := &in.DrainTimeout, &out.DrainTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.HealthGate != nil {
+		in, out := &in.HealthGate, &out.HealthGate
+		*out = new(HealthGate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(Canary)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpotMigrationPolicy.
+func (in *SpotMigrationPolicy) DeepCopy() *SpotMigrationPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(SpotMigrationPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SpotMigrator) DeepCopyInto(out *SpotMigrator) {
 	*out = *in
@@ -112,6 +511,48 @@ func (in *SpotMigrator) DeepCopyInto(out *SpotMigrator) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.MigrationScheduleJitter != nil {
+		in, out := &in.MigrationScheduleJitter, &out.MigrationScheduleJitter
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MinOnDemandNodes != nil {
+		in, out := &in.MinOnDemandNodes, &out.MinOnDemandNodes
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MinOnDemandFraction != nil {
+		in, out := &in.MinOnDemandFraction, &out.MinOnDemandFraction
+		*out = new(float64)
+		**out = **in
+	}
+	if in.HealthGate != nil {
+		in, out := &in.HealthGate, &out.HealthGate
+		*out = new(HealthGate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(Canary)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MaxRunDuration != nil {
+		in, out := &in.MaxRunDuration, &out.MaxRunDuration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.DrainTimeout != nil {
+		in, out := &in.DrainTimeout, &out.DrainTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Policies != nil {
+		in, out := &in.Policies, &out.Policies
+		*out = make([]SpotMigrationPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -124,3 +565,29 @@ func (in *SpotMigrator) DeepCopy() *SpotMigrator {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpotPreemptionHandler) DeepCopyInto(out *SpotPreemptionHandler) {
+	*out = *in
+	if in.DrainTimeout != nil {
+		in, out := &in.DrainTimeout, &out.DrainTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaxConcurrentDrains != nil {
+		in, out := &in.MaxConcurrentDrains, &out.MaxConcurrentDrains
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpotPreemptionHandler.
+func (in *SpotPreemptionHandler) DeepCopy() *SpotPreemptionHandler {
+	if in == nil {
+		return nil
+	}
+	out := new(SpotPreemptionHandler)
+	in.DeepCopyInto(out)
+	return out
+}
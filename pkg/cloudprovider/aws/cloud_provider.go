@@ -0,0 +1,123 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/hsbc/cost-manager/pkg/kubernetes"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// By default we wait for the default target group deregistration delay before terminating
+	// instances to give load balancers time to drain connections:
+	// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-target-groups.html#deregistration-delay
+	defaultLoadBalancerDeregistrationDelay = 5 * time.Minute
+)
+
+// Labels used to identify spot instances; each label indicates a spot instance when it has the
+// corresponding value
+var spotInstanceLabels = map[string]string{
+	// https://docs.aws.amazon.com/eks/latest/userguide/managed-node-groups.html#managed-node-group-capacity-types
+	"eks.amazonaws.com/capacityType": "SPOT",
+	// https://karpenter.sh/docs/reference/well-known-labels/
+	"karpenter.sh/capacity-type": "spot",
+	// Self-managed node groups are commonly labelled using the convention from the AWS Node
+	// Termination Handler: https://github.com/aws/aws-node-termination-handler#installation-and-configuration
+	"node.kubernetes.io/lifecycle": "spot",
+}
+
+type CloudProvider struct {
+	autoScalingClient               *autoscaling.Client
+	loadBalancerDeregistrationDelay time.Duration
+}
+
+// NewCloudProvider creates a new AWS cloud provider
+func NewCloudProvider(ctx context.Context, config *v1alpha1.AWSCloudProvider) (*CloudProvider, error) {
+	if config == nil {
+		config = &v1alpha1.AWSCloudProvider{}
+	}
+
+	loadOptions := []func(*awsconfig.LoadOptions) error{}
+	if config.Region != "" {
+		loadOptions = append(loadOptions, awsconfig.WithRegion(config.Region))
+	}
+	awsConfig, err := awsconfig.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load AWS configuration")
+	}
+	autoScalingClient := autoscaling.NewFromConfig(awsConfig, func(o *autoscaling.Options) {
+		if config.Endpoint != "" {
+			o.BaseEndpoint = aws.String(config.Endpoint)
+		}
+	})
+
+	loadBalancerDeregistrationDelay := defaultLoadBalancerDeregistrationDelay
+	if config.LoadBalancerDeregistrationDelay != nil {
+		loadBalancerDeregistrationDelay = config.LoadBalancerDeregistrationDelay.Duration
+	}
+
+	return &CloudProvider{
+		autoScalingClient:               autoScalingClient,
+		loadBalancerDeregistrationDelay: loadBalancerDeregistrationDelay,
+	}, nil
+}
+
+// DeleteInstance waits for load balancers to deregister the instance and then terminates it,
+// decrementing the desired capacity of its Auto Scaling group so that the instance is not replaced
+// on-demand; the cluster autoscaler is then responsible for scaling up to replace the capacity
+func (p *CloudProvider) DeleteInstance(ctx context.Context, node *corev1.Node) error {
+	// Retrieve instance details from the provider ID
+	zone, instanceID, err := parseProviderID(node.Spec.ProviderID)
+	if err != nil {
+		return err
+	}
+
+	// Validate that the provider ID details match with the Node. This should not be necessary but
+	// it provides an extra level of validation that we are terminating the expected instance
+	nodeZone, ok := node.Labels[corev1.LabelTopologyZone]
+	if !ok {
+		return fmt.Errorf("failed to determine zone for Node %s", node.Name)
+	}
+	if zone != nodeZone {
+		return fmt.Errorf("provider ID zone \"%s\" does not match with Node zone \"%s\"", zone, nodeZone)
+	}
+
+	// Targets start to be deregistered once the Node fails health checks so we only wait for the
+	// remainder of the deregistration delay
+	select {
+	case <-time.After(p.loadBalancerDeregistrationDelay - kubernetes.TimeSinceToBeDeletedTaintAdded(node, time.Now())):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	_, err = p.autoScalingClient.TerminateInstanceInAutoScalingGroup(ctx, &autoscaling.TerminateInstanceInAutoScalingGroupInput{
+		InstanceId:                     aws.String(instanceID),
+		ShouldDecrementDesiredCapacity: aws.Bool(true),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to terminate instance %s", instanceID)
+	}
+
+	return nil
+}
+
+// IsSpotInstance determines whether the Node is a spot instance using the labels set by EKS
+// managed node groups, Karpenter and self-managed node groups
+func (p *CloudProvider) IsSpotInstance(ctx context.Context, node *corev1.Node) (bool, error) {
+	if node.Labels == nil {
+		return false, nil
+	}
+	for key, value := range spotInstanceLabels {
+		if node.Labels[key] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,237 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// autoScalingStub is a local stub of the Auto Scaling Query API that records the requests that it
+// receives
+type autoScalingStub struct {
+	mu       sync.Mutex
+	requests []url.Values
+	// instances maps instance IDs to the Auto Scaling group that they belong to
+	instances map[string]string
+}
+
+func (s *autoScalingStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, r.PostForm)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/xml")
+	if r.PostForm.Get("Action") != "TerminateInstanceInAutoScalingGroup" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `<ErrorResponse><Error><Type>Sender</Type><Code>InvalidAction</Code><Message>unknown action</Message></Error><RequestId>test</RequestId></ErrorResponse>`)
+		return
+	}
+	instanceID := r.PostForm.Get("InstanceId")
+	autoScalingGroupName, ok := s.instances[instanceID]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `<ErrorResponse><Error><Type>Sender</Type><Code>ValidationError</Code><Message>Instance Id not found - No managed instance found for instance ID: %s</Message></Error><RequestId>test</RequestId></ErrorResponse>`, instanceID)
+		return
+	}
+	fmt.Fprintf(w, `<TerminateInstanceInAutoScalingGroupResponse xmlns="http://autoscaling.amazonaws.com/doc/2011-01-01/">
+  <TerminateInstanceInAutoScalingGroupResult>
+    <Activity>
+      <ActivityId>test</ActivityId>
+      <AutoScalingGroupName>%s</AutoScalingGroupName>
+      <StatusCode>InProgress</StatusCode>
+    </Activity>
+  </TerminateInstanceInAutoScalingGroupResult>
+  <ResponseMetadata>
+    <RequestId>test</RequestId>
+  </ResponseMetadata>
+</TerminateInstanceInAutoScalingGroupResponse>`, autoScalingGroupName)
+}
+
+func newStubCloudProvider(t *testing.T, stub *autoScalingStub) *CloudProvider {
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	// Use static credentials to avoid looking up credentials from the environment
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	p, err := NewCloudProvider(context.Background(), &v1alpha1.AWSCloudProvider{
+		Region:                          "eu-west-2",
+		Endpoint:                        server.URL,
+		LoadBalancerDeregistrationDelay: &metav1.Duration{Duration: 0},
+	})
+	require.Nil(t, err)
+	return p
+}
+
+func TestIsSpotInstance(t *testing.T) {
+	tests := map[string]struct {
+		labels         map[string]string
+		isSpotInstance bool
+	}{
+		"managedNodeGroupSpot": {
+			labels:         map[string]string{"eks.amazonaws.com/capacityType": "SPOT"},
+			isSpotInstance: true,
+		},
+		"managedNodeGroupOnDemand": {
+			labels:         map[string]string{"eks.amazonaws.com/capacityType": "ON_DEMAND"},
+			isSpotInstance: false,
+		},
+		"karpenterSpot": {
+			labels:         map[string]string{"karpenter.sh/capacity-type": "spot"},
+			isSpotInstance: true,
+		},
+		"selfManagedSpot": {
+			labels:         map[string]string{"node.kubernetes.io/lifecycle": "spot"},
+			isSpotInstance: true,
+		},
+		"noLabels": {
+			labels:         nil,
+			isSpotInstance: false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: test.labels}}
+			isSpotInstance, err := (&CloudProvider{}).IsSpotInstance(context.Background(), node)
+			require.Nil(t, err)
+			require.Equal(t, test.isSpotInstance, isSpotInstance)
+		})
+	}
+}
+
+func TestDeleteInstance(t *testing.T) {
+	tests := map[string]struct {
+		node  *corev1.Node
+		valid bool
+	}{
+		"valid": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "ip-10-0-0-1.eu-west-2.compute.internal",
+					Labels: map[string]string{corev1.LabelTopologyZone: "eu-west-2a"},
+				},
+				Spec: corev1.NodeSpec{
+					ProviderID: "aws:///eu-west-2a/i-0123456789abcdef0",
+				},
+			},
+			valid: true,
+		},
+		"zoneMismatch": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "ip-10-0-0-1.eu-west-2.compute.internal",
+					Labels: map[string]string{corev1.LabelTopologyZone: "eu-west-2b"},
+				},
+				Spec: corev1.NodeSpec{
+					ProviderID: "aws:///eu-west-2a/i-0123456789abcdef0",
+				},
+			},
+			valid: false,
+		},
+		"unknownInstance": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "ip-10-0-0-2.eu-west-2.compute.internal",
+					Labels: map[string]string{corev1.LabelTopologyZone: "eu-west-2a"},
+				},
+				Spec: corev1.NodeSpec{
+					ProviderID: "aws:///eu-west-2a/i-0fedcba9876543210",
+				},
+			},
+			valid: false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			stub := &autoScalingStub{
+				instances: map[string]string{"i-0123456789abcdef0": "test"},
+			}
+			p := newStubCloudProvider(t, stub)
+
+			err := p.DeleteInstance(context.Background(), test.node)
+			if !test.valid {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Len(t, stub.requests, 1)
+			require.Equal(t, "i-0123456789abcdef0", stub.requests[0].Get("InstanceId"))
+			require.Equal(t, "true", stub.requests[0].Get("ShouldDecrementDesiredCapacity"))
+		})
+	}
+}
+
+func TestDeleteInstanceWaitsForDeregistrationDelay(t *testing.T) {
+	stub := &autoScalingStub{
+		instances: map[string]string{"i-0123456789abcdef0": "test"},
+	}
+	p := newStubCloudProvider(t, stub)
+	p.loadBalancerDeregistrationDelay = time.Hour
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{corev1.LabelTopologyZone: "eu-west-2a"},
+		},
+		Spec: corev1.NodeSpec{
+			ProviderID: "aws:///eu-west-2a/i-0123456789abcdef0",
+		},
+	}
+
+	// The instance should not be terminated before the deregistration delay has passed
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := p.DeleteInstance(ctx, node)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Empty(t, stub.requests)
+
+	// The delay is measured from when the ToBeDeletedByClusterAutoscaler taint was added
+	node.Spec.Taints = []corev1.Taint{
+		{
+			Key:    "ToBeDeletedByClusterAutoscaler",
+			Value:  fmt.Sprint(time.Now().Add(-time.Hour).Unix()),
+			Effect: corev1.TaintEffectNoSchedule,
+		},
+	}
+	err = p.DeleteInstance(context.Background(), node)
+	require.Nil(t, err)
+	require.Len(t, stub.requests, 1)
+}
+
+func TestDeleteInstanceValidatesBeforeDeregistrationDelay(t *testing.T) {
+	stub := &autoScalingStub{}
+	p := newStubCloudProvider(t, stub)
+	p.loadBalancerDeregistrationDelay = time.Hour
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{corev1.LabelTopologyZone: "eu-west-2a"},
+		},
+		Spec: corev1.NodeSpec{
+			ProviderID: "gce://my-project/europe-west2-a/my-instance",
+		},
+	}
+
+	// An invalid provider ID should fail immediately rather than after the deregistration delay
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err := p.DeleteInstance(ctx, node)
+	require.NotNil(t, err)
+	require.NotErrorIs(t, err, context.DeadlineExceeded)
+	require.Empty(t, stub.requests)
+}
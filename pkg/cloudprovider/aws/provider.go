@@ -0,0 +1,24 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	providerIDPrefix = "aws:///"
+)
+
+// parseProviderID parses the node.Spec.ProviderID of an EC2 Node and returns the availability zone
+// and instance ID. We assume the format aws:///<zone>/<instance-id> that is set by the AWS cloud
+// controller manager
+func parseProviderID(providerID string) (string, string, error) {
+	if !strings.HasPrefix(providerID, providerIDPrefix) {
+		return "", "", fmt.Errorf("provider ID does not have the expected prefix: %s", providerID)
+	}
+	tokens := strings.Split(strings.TrimPrefix(providerID, providerIDPrefix), "/")
+	if len(tokens) != 2 || tokens[0] == "" || !strings.HasPrefix(tokens[1], "i-") {
+		return "", "", fmt.Errorf("provider ID is not in the expected format: %s", providerID)
+	}
+	return tokens[0], tokens[1], nil
+}
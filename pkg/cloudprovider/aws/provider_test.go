@@ -0,0 +1,47 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProviderID(t *testing.T) {
+	tests := map[string]struct {
+		providerID string
+		valid      bool
+		zone       string
+		instanceID string
+	}{
+		"valid": {
+			providerID: "aws:///eu-west-2a/i-0123456789abcdef0",
+			valid:      true,
+			zone:       "eu-west-2a",
+			instanceID: "i-0123456789abcdef0",
+		},
+		"wrongPrefix": {
+			providerID: "gce://my-project/europe-west2-a/my-instance",
+			valid:      false,
+		},
+		"missingZone": {
+			providerID: "aws:///i-0123456789abcdef0",
+			valid:      false,
+		},
+		"notAnInstance": {
+			providerID: "aws:///eu-west-2a/fargate-ip-10-0-0-1",
+			valid:      false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			zone, instanceID, err := parseProviderID(test.providerID)
+			if test.valid {
+				require.Nil(t, err)
+				require.Equal(t, test.zone, zone)
+				require.Equal(t, test.instanceID, instanceID)
+			} else {
+				require.NotNil(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/hsbc/cost-manager/pkg/kubernetes"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// https://learn.microsoft.com/en-us/azure/aks/spot-node-pool
+	spotNodeLabelKey   = "kubernetes.azure.com/scalesetpriority"
+	spotNodeLabelValue = "spot"
+
+	// Load balancer health probes created by the Azure cloud controller manager have an interval of
+	// 5 seconds with an unhealthy threshold of 2 so we wait for 2 * 5 = 10 seconds for instances to
+	// be marked as unhealthy and stop receiving new connections. We then add an additional 20
+	// seconds to allow in-flight connections to complete and to allow processing time for the
+	// various components involved (e.g. Azure probes and kube-proxy)
+	defaultLoadBalancerDrainDelay = 30 * time.Second
+
+	// Interval between polls of the scale set delete operation when Azure Resource Manager does not
+	// return a Retry-After header
+	defaultPollFrequency = 10 * time.Second
+)
+
+type CloudProvider struct {
+	credential             azcore.TokenCredential
+	clientOptions          *arm.ClientOptions
+	loadBalancerDrainDelay time.Duration
+	pollFrequency          time.Duration
+}
+
+// NewCloudProvider creates a new Azure cloud provider. Unless a managed identity is configured the
+// default Azure credential chain is used (e.g. workload identity or managed identity)
+func NewCloudProvider(config *v1alpha1.AzureCloudProvider) (*CloudProvider, error) {
+	if config == nil {
+		config = &v1alpha1.AzureCloudProvider{}
+	}
+
+	var credential azcore.TokenCredential
+	var err error
+	if config.ManagedIdentityClientID != "" {
+		credential, err = azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{
+			ID: azidentity.ClientID(config.ManagedIdentityClientID),
+		})
+	} else {
+		credential, err = azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
+			TenantID: config.TenantID,
+		})
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create Azure credential")
+	}
+
+	var clientOptions *arm.ClientOptions
+	if config.Endpoint != "" {
+		clientOptions = &arm.ClientOptions{
+			ClientOptions: policy.ClientOptions{
+				Cloud: cloud.Configuration{
+					ActiveDirectoryAuthorityHost: cloud.AzurePublic.ActiveDirectoryAuthorityHost,
+					Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+						cloud.ResourceManager: {
+							Audience: cloud.AzurePublic.Services[cloud.ResourceManager].Audience,
+							Endpoint: config.Endpoint,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	azure := newCloudProvider(credential, clientOptions)
+	if config.LoadBalancerDrainDelay != nil {
+		azure.loadBalancerDrainDelay = config.LoadBalancerDrainDelay.Duration
+	}
+	return azure, nil
+}
+
+func newCloudProvider(credential azcore.TokenCredential, clientOptions *arm.ClientOptions) *CloudProvider {
+	return &CloudProvider{
+		credential:             credential,
+		clientOptions:          clientOptions,
+		loadBalancerDrainDelay: defaultLoadBalancerDrainDelay,
+		pollFrequency:          defaultPollFrequency,
+	}
+}
+
+// DeleteInstance drains any connections from Azure load balancers, deletes the underlying scale set
+// instance of the Kubernetes Node and then waits for the scale set operation to complete. Deleting
+// a scale set instance also reduces the capacity of the scale set so that the instance is not
+// replaced on-demand; the cluster autoscaler is then responsible for scaling up to replace the
+// capacity
+func (azure *CloudProvider) DeleteInstance(ctx context.Context, node *corev1.Node) error {
+	// Retrieve scale set instance details from the provider ID
+	instance, err := parseProviderID(node.Spec.ProviderID)
+	if err != nil {
+		return err
+	}
+	// Make sure that the provider ID refers to the scale set instance underlying this Node before
+	// deleting it
+	if !strings.EqualFold(instance.computerName(), node.Name) {
+		return fmt.Errorf("scale set instance \"%s\" does not match with Node \"%s\"", instance.computerName(), node.Name)
+	}
+
+	// Azure load balancer health probes start failing once kube-proxy sees the
+	// ToBeDeletedByClusterAutoscaler taint so we only wait for the remainder of the drain delay
+	select {
+	case <-time.After(azure.loadBalancerDrainDelay - kubernetes.TimeSinceToBeDeletedTaintAdded(node, time.Now())):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	scaleSetVMsClient, err := armcompute.NewVirtualMachineScaleSetVMsClient(instance.subscriptionID, azure.credential, azure.clientOptions)
+	if err != nil {
+		return errors.Wrap(err, "failed to create scale set VMs client")
+	}
+	poller, err := scaleSetVMsClient.BeginDelete(ctx, instance.resourceGroupName, instance.scaleSetName, instance.instanceID, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete scale set instance: %s/%s/%s", instance.resourceGroupName, instance.scaleSetName, instance.instanceID)
+	}
+
+	// Wait for the scale set operation to complete
+	_, err = poller.PollUntilDone(ctx, &runtime.PollUntilDoneOptions{Frequency: azure.pollFrequency})
+	if err != nil {
+		return errors.Wrapf(err, "failed to wait for deletion of scale set instance: %s/%s/%s", instance.resourceGroupName, instance.scaleSetName, instance.instanceID)
+	}
+
+	return nil
+}
+
+// IsSpotInstance determines whether the underlying scale set instance of the Node is a spot
+// instance using the label set by AKS on spot node pools
+func (azure *CloudProvider) IsSpotInstance(ctx context.Context, node *corev1.Node) (bool, error) {
+	if node.Labels == nil {
+		return false, nil
+	}
+	return node.Labels[spotNodeLabelKey] == spotNodeLabelValue, nil
+}
@@ -0,0 +1,249 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	testSubscriptionID = "00000000-0000-0000-0000-000000000000"
+	testScaleSetPath   = "/subscriptions/" + testSubscriptionID + "/resourceGroups/mc_test_test_uksouth/providers/Microsoft.Compute/virtualMachineScaleSets/aks-spot-12345678-vmss"
+)
+
+// fakeCredential returns a static access token to avoid authenticating with Microsoft Entra ID
+type fakeCredential struct{}
+
+func (fakeCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "test", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// resourceManagerStub is a local stub of the Azure Resource Manager API that deletes scale set
+// instances using asynchronous operations which complete after being polled a number of times
+type resourceManagerStub struct {
+	mu sync.Mutex
+	// instances contains the IDs of the instances in the scale set
+	instances map[string]bool
+	// operationPolls is the number of times an operation must be polled before it completes
+	operationPolls int
+	// operationStatus is the status of operations once they have completed
+	operationStatus string
+	deleteRequests  []string
+	pollRequests    int
+}
+
+func (s *resourceManagerStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, testScaleSetPath+"/virtualMachines/"):
+		instanceID := strings.TrimPrefix(r.URL.Path, testScaleSetPath+"/virtualMachines/")
+		s.deleteRequests = append(s.deleteRequests, instanceID)
+		if !s.instances[instanceID] {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error":{"code":"NotFound","message":"The entity was not found in this Azure location."}}`)
+			return
+		}
+		delete(s.instances, instanceID)
+		w.Header().Set("Azure-AsyncOperation", fmt.Sprintf("https://%s/operations/test", r.Host))
+		w.WriteHeader(http.StatusAccepted)
+	case r.Method == http.MethodGet && r.URL.Path == "/operations/test":
+		s.pollRequests++
+		if s.pollRequests < s.operationPolls {
+			fmt.Fprintf(w, `{"status":"InProgress"}`)
+			return
+		}
+		if s.operationStatus == "Failed" {
+			fmt.Fprintf(w, `{"status":"Failed","error":{"code":"InternalExecutionError","message":"An internal execution error occurred."}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"status":"Succeeded"}`)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":{"code":"InvalidRequest","message":"unexpected request: %s %s"}}`, r.Method, r.URL.Path)
+	}
+}
+
+func newStubCloudProvider(t *testing.T, stub *resourceManagerStub) *CloudProvider {
+	// Bearer token authentication is only permitted over TLS
+	server := httptest.NewTLSServer(stub)
+	t.Cleanup(server.Close)
+
+	azure := newCloudProvider(fakeCredential{}, &arm.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Cloud: cloud.Configuration{
+				Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+					cloud.ResourceManager: {
+						Audience: "https://management.azure.com",
+						Endpoint: server.URL,
+					},
+				},
+			},
+			Transport: server.Client(),
+			Retry:     policy.RetryOptions{MaxRetries: -1},
+		},
+	})
+	azure.loadBalancerDrainDelay = 0
+	azure.pollFrequency = 10 * time.Millisecond
+	return azure
+}
+
+func newScaleSetNode(instanceID string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "aks-spot-12345678-vmss00000" + instanceID,
+		},
+		Spec: corev1.NodeSpec{
+			ProviderID: "azure://" + testScaleSetPath + "/virtualMachines/" + instanceID,
+		},
+	}
+}
+
+func TestNewCloudProvider(t *testing.T) {
+	azure, err := NewCloudProvider(&v1alpha1.AzureCloudProvider{
+		ManagedIdentityClientID: "00000000-0000-0000-0000-000000000000",
+		Endpoint:                "https://management.example.com",
+		LoadBalancerDrainDelay:  &metav1.Duration{Duration: time.Minute},
+	})
+	require.Nil(t, err)
+	require.Equal(t, time.Minute, azure.loadBalancerDrainDelay)
+	require.Equal(t, "https://management.example.com", azure.clientOptions.Cloud.Services[cloud.ResourceManager].Endpoint)
+
+	// Defaults are used when no configuration is provided
+	azure, err = NewCloudProvider(nil)
+	require.Nil(t, err)
+	require.Equal(t, defaultLoadBalancerDrainDelay, azure.loadBalancerDrainDelay)
+	require.Nil(t, azure.clientOptions)
+}
+
+func TestIsSpotInstance(t *testing.T) {
+	tests := map[string]struct {
+		labels         map[string]string
+		isSpotInstance bool
+	}{
+		"spot": {
+			labels:         map[string]string{"kubernetes.azure.com/scalesetpriority": "spot"},
+			isSpotInstance: true,
+		},
+		"regular": {
+			labels:         map[string]string{"kubernetes.azure.com/scalesetpriority": "regular"},
+			isSpotInstance: false,
+		},
+		"noLabels": {
+			labels:         nil,
+			isSpotInstance: false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: test.labels}}
+			isSpotInstance, err := (&CloudProvider{}).IsSpotInstance(context.Background(), node)
+			require.Nil(t, err)
+			require.Equal(t, test.isSpotInstance, isSpotInstance)
+		})
+	}
+}
+
+func TestDeleteInstance(t *testing.T) {
+	tests := map[string]struct {
+		node            *corev1.Node
+		operationStatus string
+		valid           bool
+		// rejected is true if the Node should be rejected before calling the Azure API
+		rejected bool
+	}{
+		"valid": {
+			node:            newScaleSetNode("3"),
+			operationStatus: "Succeeded",
+			valid:           true,
+		},
+		"operationFailed": {
+			node:            newScaleSetNode("3"),
+			operationStatus: "Failed",
+			valid:           false,
+		},
+		"unknownInstance": {
+			node:            newScaleSetNode("4"),
+			operationStatus: "Succeeded",
+			valid:           false,
+		},
+		"invalidProviderID": {
+			node: &corev1.Node{
+				Spec: corev1.NodeSpec{
+					ProviderID: "aws:///eu-west-2a/i-0123456789abcdef0",
+				},
+			},
+			operationStatus: "Succeeded",
+			valid:           false,
+			rejected:        true,
+		},
+		"nodeNameMismatch": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "aks-spot-12345678-vmss000004",
+				},
+				Spec: corev1.NodeSpec{
+					ProviderID: "azure://" + testScaleSetPath + "/virtualMachines/3",
+				},
+			},
+			operationStatus: "Succeeded",
+			valid:           false,
+			rejected:        true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			stub := &resourceManagerStub{
+				instances:       map[string]bool{"3": true},
+				operationPolls:  3,
+				operationStatus: test.operationStatus,
+			}
+			azure := newStubCloudProvider(t, stub)
+
+			err := azure.DeleteInstance(context.Background(), test.node)
+			if !test.valid {
+				require.NotNil(t, err)
+				if test.rejected {
+					require.Empty(t, stub.deleteRequests)
+				}
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, []string{"3"}, stub.deleteRequests)
+			// We should have waited for the scale set operation to complete
+			require.Equal(t, 3, stub.pollRequests)
+		})
+	}
+}
+
+func TestDeleteInstanceWaitsForLoadBalancerDrainDelay(t *testing.T) {
+	stub := &resourceManagerStub{
+		instances:       map[string]bool{"3": true},
+		operationStatus: "Succeeded",
+	}
+	azure := newStubCloudProvider(t, stub)
+	azure.loadBalancerDrainDelay = time.Hour
+
+	// The instance should not be deleted before the drain delay has passed
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := azure.DeleteInstance(ctx, newScaleSetNode("3"))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Empty(t, stub.deleteRequests)
+}
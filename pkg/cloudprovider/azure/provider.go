@@ -0,0 +1,63 @@
+package azure
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	providerIDPrefix = "azure:///"
+)
+
+// scaleSetInstance identifies a virtual machine scale set instance
+type scaleSetInstance struct {
+	subscriptionID    string
+	resourceGroupName string
+	scaleSetName      string
+	instanceID        string
+}
+
+// parseProviderID parses the node.Spec.ProviderID of an AKS Node and returns the details of the
+// scale set instance. We assume the format set by the Azure cloud controller manager for virtual
+// machine scale set Nodes:
+// azure:///subscriptions/<subscription>/resourceGroups/<group>/providers/Microsoft.Compute/virtualMachineScaleSets/<scale-set>/virtualMachines/<instance-id>
+func parseProviderID(providerID string) (scaleSetInstance, error) {
+	if !strings.HasPrefix(providerID, providerIDPrefix) {
+		return scaleSetInstance{}, fmt.Errorf("provider ID does not have the expected prefix: %s", providerID)
+	}
+	tokens := strings.Split(strings.TrimPrefix(providerID, providerIDPrefix), "/")
+	// Azure resource IDs are case-insensitive and the casing of the resource group segment in
+	// particular varies between the various components that set it
+	if len(tokens) != 10 ||
+		!strings.EqualFold(tokens[0], "subscriptions") ||
+		!strings.EqualFold(tokens[2], "resourceGroups") ||
+		!strings.EqualFold(tokens[4], "providers") ||
+		!strings.EqualFold(tokens[5], "Microsoft.Compute") ||
+		!strings.EqualFold(tokens[6], "virtualMachineScaleSets") ||
+		!strings.EqualFold(tokens[8], "virtualMachines") {
+		return scaleSetInstance{}, fmt.Errorf("provider ID is not in the expected format: %s", providerID)
+	}
+	instance := scaleSetInstance{
+		subscriptionID:    tokens[1],
+		resourceGroupName: tokens[3],
+		scaleSetName:      tokens[7],
+		instanceID:        tokens[9],
+	}
+	if instance.subscriptionID == "" || instance.resourceGroupName == "" || instance.scaleSetName == "" || instance.instanceID == "" {
+		return scaleSetInstance{}, fmt.Errorf("provider ID is not in the expected format: %s", providerID)
+	}
+	if _, err := strconv.ParseUint(instance.instanceID, 10, 64); err != nil {
+		return scaleSetInstance{}, fmt.Errorf("provider ID does not contain a valid scale set instance ID: %s", providerID)
+	}
+	return instance, nil
+}
+
+// computerName returns the computer name of the scale set instance which AKS uses as the Node name;
+// it is the scale set name followed by the instance ID in base 36, zero-padded to 6 characters:
+// https://learn.microsoft.com/en-us/azure/virtual-machine-scale-sets/virtual-machine-scale-sets-instance-ids
+func (instance scaleSetInstance) computerName() string {
+	// The instance ID has already been validated by parseProviderID
+	instanceID, _ := strconv.ParseUint(instance.instanceID, 10, 64)
+	return fmt.Sprintf("%s%06s", instance.scaleSetName, strconv.FormatUint(instanceID, 36))
+}
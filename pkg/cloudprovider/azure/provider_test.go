@@ -0,0 +1,85 @@
+package azure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProviderID(t *testing.T) {
+	tests := map[string]struct {
+		providerID string
+		valid      bool
+		instance   scaleSetInstance
+	}{
+		"valid": {
+			providerID: "azure:///subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/mc_test_test_uksouth/providers/Microsoft.Compute/virtualMachineScaleSets/aks-spot-12345678-vmss/virtualMachines/3",
+			valid:      true,
+			instance: scaleSetInstance{
+				subscriptionID:    "00000000-0000-0000-0000-000000000000",
+				resourceGroupName: "mc_test_test_uksouth",
+				scaleSetName:      "aks-spot-12345678-vmss",
+				instanceID:        "3",
+			},
+		},
+		"lowerCaseResourceGroups": {
+			providerID: "azure:///subscriptions/00000000-0000-0000-0000-000000000000/resourcegroups/mc_test_test_uksouth/providers/Microsoft.Compute/virtualMachineScaleSets/aks-spot-12345678-vmss/virtualMachines/3",
+			valid:      true,
+			instance: scaleSetInstance{
+				subscriptionID:    "00000000-0000-0000-0000-000000000000",
+				resourceGroupName: "mc_test_test_uksouth",
+				scaleSetName:      "aks-spot-12345678-vmss",
+				instanceID:        "3",
+			},
+		},
+		"wrongPrefix": {
+			providerID: "aws:///eu-west-2a/i-0123456789abcdef0",
+			valid:      false,
+		},
+		"availabilitySet": {
+			providerID: "azure:///subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/mc_test_test_uksouth/providers/Microsoft.Compute/virtualMachines/aks-agentpool-12345678-0",
+			valid:      false,
+		},
+		"missingInstanceID": {
+			providerID: "azure:///subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/mc_test_test_uksouth/providers/Microsoft.Compute/virtualMachineScaleSets/aks-spot-12345678-vmss/virtualMachines/",
+			valid:      false,
+		},
+		"nonNumericInstanceID": {
+			providerID: "azure:///subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/mc_test_test_uksouth/providers/Microsoft.Compute/virtualMachineScaleSets/aks-spot-12345678-vmss/virtualMachines/aks-spot-12345678-vmss000003",
+			valid:      false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance, err := parseProviderID(test.providerID)
+			if test.valid {
+				require.Nil(t, err)
+				require.Equal(t, test.instance, instance)
+			} else {
+				require.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestScaleSetInstanceComputerName(t *testing.T) {
+	tests := map[string]struct {
+		instanceID   string
+		computerName string
+	}{
+		"singleDigit": {
+			instanceID:   "3",
+			computerName: "aks-spot-12345678-vmss000003",
+		},
+		"base36": {
+			instanceID:   "46",
+			computerName: "aks-spot-12345678-vmss00001a",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := scaleSetInstance{scaleSetName: "aks-spot-12345678-vmss", instanceID: test.instanceID}
+			require.Equal(t, test.computerName, instance.computerName())
+		})
+	}
+}
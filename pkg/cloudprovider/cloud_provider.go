@@ -4,14 +4,31 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/aws"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/azure"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/clusterapi"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/external"
 	"github.com/hsbc/cost-manager/pkg/cloudprovider/fake"
 	"github.com/hsbc/cost-manager/pkg/cloudprovider/gcp"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/generic"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/instanceinfo"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/karpenter"
+	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	clientgo "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 const (
-	FakeCloudProviderName = "fake"
-	GCPCloudProviderName  = "gcp"
+	FakeCloudProviderName       = "fake"
+	GCPCloudProviderName        = "gcp"
+	AWSCloudProviderName        = "aws"
+	AzureCloudProviderName      = "azure"
+	KarpenterCloudProviderName  = "karpenter"
+	ClusterAPICloudProviderName = "clusterapi"
+	GenericCloudProviderName    = "generic"
+	ExternalCloudProviderName   = "external"
 )
 
 // CloudProvider contains the functions for interacting with a cloud provider
@@ -26,14 +43,69 @@ type CloudProvider interface {
 	DeleteInstance(ctx context.Context, node *corev1.Node) error
 }
 
-// NewCloudProvider returns a new CloudProvider instance
-func NewCloudProvider(ctx context.Context, cloudProviderName string) (CloudProvider, error) {
-	switch cloudProviderName {
+// Every CloudProvider can be served as an external cloud provider plugin
+var _ external.PluginCloudProvider = CloudProvider(nil)
+
+// DisruptionChecker can optionally be implemented by cloud providers that have their own controls
+// for limiting voluntary disruption of Nodes (e.g. Karpenter disruption budgets)
+type DisruptionChecker interface {
+	// CanDisruptNode determines whether the Node can currently be drained and deleted
+	CanDisruptNode(ctx context.Context, node *corev1.Node) (bool, error)
+}
+
+// PreflightChecker can optionally be implemented by cloud providers that can validate that spot
+// capacity is available to replace on-demand Nodes before they are drained
+type PreflightChecker interface {
+	// PreflightCheck returns a non-empty reason if the on-demand Nodes should not be migrated to
+	// spot Nodes (e.g. because there is nowhere for their workloads to be rescheduled)
+	PreflightCheck(ctx context.Context, onDemandNodes, spotNodes []*corev1.Node) (string, error)
+}
+
+// RemovalDeferrer can optionally be implemented by cloud providers that do not always remove Nodes
+// themselves (e.g. because they taint Nodes for removal by an external autoscaler)
+type RemovalDeferrer interface {
+	// RemovalDeferred determines whether DeleteInstance leaves the removal of Nodes to another
+	// component, in which case the Node object may not be deleted for some time or at all (e.g. if
+	// its node group is at its minimum size)
+	RemovalDeferred() bool
+}
+
+// InstanceInfoProvider can optionally be implemented by cloud providers that can describe the
+// underlying instance of a Node so that it can be logged when the Node is selected for deletion
+type InstanceInfoProvider interface {
+	// GetInstanceInfo returns information about the underlying instance of the Node
+	GetInstanceInfo(ctx context.Context, node *corev1.Node) (*instanceinfo.InstanceInfo, error)
+}
+
+// NewCloudProvider returns a new CloudProvider instance. The REST config is used by cloud providers
+// that are implemented using Kubernetes APIs
+func NewCloudProvider(ctx context.Context, config v1alpha1.CloudProvider, restConfig *rest.Config) (CloudProvider, error) {
+	switch config.Name {
 	case FakeCloudProviderName:
 		return &fake.CloudProvider{}, nil
 	case GCPCloudProviderName:
-		return gcp.NewCloudProvider(ctx)
+		clientset, err := clientgo.NewForConfig(restConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create clientset")
+		}
+		return gcp.NewCloudProvider(ctx, config.GCP, clientset)
+	case AWSCloudProviderName:
+		return aws.NewCloudProvider(ctx, config.AWS)
+	case AzureCloudProviderName:
+		return azure.NewCloudProvider(config.Azure)
+	case KarpenterCloudProviderName:
+		return karpenter.NewCloudProvider(restConfig)
+	case ClusterAPICloudProviderName:
+		return clusterapi.NewCloudProvider(restConfig, config.ClusterAPI)
+	case GenericCloudProviderName:
+		clientset, err := clientgo.NewForConfig(restConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create clientset")
+		}
+		return generic.NewCloudProvider(clientset, config.Generic)
+	case ExternalCloudProviderName:
+		return external.NewCloudProvider(ctx, config.External)
 	default:
-		return nil, fmt.Errorf("unknown cloud provider: %s", cloudProviderName)
+		return nil, fmt.Errorf("unknown cloud provider: %s", config.Name)
 	}
 }
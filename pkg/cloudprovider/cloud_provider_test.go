@@ -4,10 +4,11 @@ import (
 	"context"
 	"testing"
 
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
 	"github.com/stretchr/testify/require"
 )
 
 func TestNewCloudProvider(t *testing.T) {
-	_, err := NewCloudProvider(context.Background(), "")
+	_, err := NewCloudProvider(context.Background(), v1alpha1.CloudProvider{}, nil)
 	require.NotNil(t, err)
 }
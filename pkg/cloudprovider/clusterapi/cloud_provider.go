@@ -0,0 +1,112 @@
+package clusterapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// Cluster API sets these annotations on each Node to identify its Machine:
+	// https://github.com/kubernetes-sigs/cluster-api/blob/v1.6.0/api/v1beta1/common_types.go#L79-L83
+	machineAnnotationKey          = "cluster.x-k8s.io/machine"
+	clusterNamespaceAnnotationKey = "cluster.x-k8s.io/cluster-namespace"
+
+	defaultSpotInstanceLabelValue = "true"
+)
+
+var (
+	machineGVR = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machines"}
+)
+
+// CloudProvider supports self-managed clusters that are provisioned by Cluster API. Nodes are
+// removed by deleting their Machine which allows the owning MachineSet or MachineDeployment to
+// reconcile the change
+type CloudProvider struct {
+	dynamicClient          dynamic.Interface
+	spotInstanceLabelKey   string
+	spotInstanceLabelValue string
+}
+
+// NewCloudProvider creates a new Cluster API cloud provider
+func NewCloudProvider(restConfig *rest.Config, config *v1alpha1.ClusterAPICloudProvider) (*CloudProvider, error) {
+	if config == nil || config.SpotInstanceLabelKey == "" {
+		return nil, errors.New("spot instance label key must be configured for the Cluster API cloud provider")
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create dynamic client")
+	}
+	return newCloudProvider(dynamicClient, config), nil
+}
+
+func newCloudProvider(dynamicClient dynamic.Interface, config *v1alpha1.ClusterAPICloudProvider) *CloudProvider {
+	spotInstanceLabelValue := defaultSpotInstanceLabelValue
+	if config.SpotInstanceLabelValue != "" {
+		spotInstanceLabelValue = config.SpotInstanceLabelValue
+	}
+	return &CloudProvider{
+		dynamicClient:          dynamicClient,
+		spotInstanceLabelKey:   config.SpotInstanceLabelKey,
+		spotInstanceLabelValue: spotInstanceLabelValue,
+	}
+}
+
+// IsSpotInstance determines whether the Node is a spot instance using the configured label. The
+// label is first checked on the Node and then on its Machine since Cluster API only propagates
+// Machine labels with certain prefixes to Nodes:
+// https://cluster-api.sigs.k8s.io/developer/architecture/controllers/metadata-propagation#machine
+func (capi *CloudProvider) IsSpotInstance(ctx context.Context, node *corev1.Node) (bool, error) {
+	if value, ok := node.Labels[capi.spotInstanceLabelKey]; ok {
+		return value == capi.spotInstanceLabelValue, nil
+	}
+
+	// Nodes that are not managed by Cluster API can only be identified using their own labels
+	if node.Annotations[machineAnnotationKey] == "" {
+		return false, nil
+	}
+	namespace, name, err := getMachineNamespaceAndName(node)
+	if err != nil {
+		return false, err
+	}
+	machine, err := capi.dynamicClient.Resource(machineGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to get Machine %s/%s", namespace, name)
+	}
+	return machine.GetLabels()[capi.spotInstanceLabelKey] == capi.spotInstanceLabelValue, nil
+}
+
+// DeleteInstance deletes the Machine corresponding to the Node
+func (capi *CloudProvider) DeleteInstance(ctx context.Context, node *corev1.Node) error {
+	namespace, name, err := getMachineNamespaceAndName(node)
+	if err != nil {
+		return err
+	}
+	err = capi.dynamicClient.Resource(machineGVR).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete Machine %s/%s", namespace, name)
+	}
+	return nil
+}
+
+// getMachineNamespaceAndName retrieves the namespace and name of the Node's Machine from the
+// annotations set by Cluster API
+func getMachineNamespaceAndName(node *corev1.Node) (string, string, error) {
+	name := node.Annotations[machineAnnotationKey]
+	if name == "" {
+		return "", "", fmt.Errorf("failed to determine Machine for Node %s: annotation %s not found", node.Name, machineAnnotationKey)
+	}
+	namespace := node.Annotations[clusterNamespaceAnnotationKey]
+	if namespace == "" {
+		return "", "", fmt.Errorf("failed to determine Machine namespace for Node %s: annotation %s not found", node.Name, clusterNamespaceAnnotationKey)
+	}
+	return namespace, name, nil
+}
@@ -0,0 +1,153 @@
+package clusterapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newMachine(namespace, name string, labels map[string]string) *unstructured.Unstructured {
+	machine := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "cluster.x-k8s.io/v1beta1",
+			"kind":       "Machine",
+			"metadata": map[string]interface{}{
+				"namespace": namespace,
+				"name":      name,
+			},
+			"spec": map[string]interface{}{
+				"clusterName": "test",
+				"bootstrap": map[string]interface{}{
+					"dataSecretName": name,
+				},
+				"infrastructureRef": map[string]interface{}{
+					"apiVersion": "infrastructure.cluster.x-k8s.io/v1beta1",
+					"kind":       "DockerMachine",
+					"name":       name,
+				},
+			},
+		},
+	}
+	machine.SetLabels(labels)
+	return machine
+}
+
+func newMachineNode(namespace, machineName string, labels map[string]string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   machineName,
+			Labels: labels,
+			Annotations: map[string]string{
+				"cluster.x-k8s.io/machine":           machineName,
+				"cluster.x-k8s.io/cluster-namespace": namespace,
+			},
+		},
+	}
+}
+
+func newFakeCloudProvider(config *v1alpha1.ClusterAPICloudProvider, objects ...runtime.Object) *CloudProvider {
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		machineGVR: "MachineList",
+	}, objects...)
+	return newCloudProvider(dynamicClient, config)
+}
+
+func TestIsSpotInstance(t *testing.T) {
+	tests := map[string]struct {
+		config         *v1alpha1.ClusterAPICloudProvider
+		node           *corev1.Node
+		machine        *unstructured.Unstructured
+		isSpotInstance bool
+	}{
+		"nodeLabel": {
+			config: &v1alpha1.ClusterAPICloudProvider{
+				SpotInstanceLabelKey: "example.com/spot",
+			},
+			node:           newMachineNode("default", "test", map[string]string{"example.com/spot": "true"}),
+			isSpotInstance: true,
+		},
+		"nodeLabelWithCustomValue": {
+			config: &v1alpha1.ClusterAPICloudProvider{
+				SpotInstanceLabelKey:   "example.com/capacity-type",
+				SpotInstanceLabelValue: "spot",
+			},
+			node:           newMachineNode("default", "test", map[string]string{"example.com/capacity-type": "spot"}),
+			isSpotInstance: true,
+		},
+		"nodeLabelFalse": {
+			config: &v1alpha1.ClusterAPICloudProvider{
+				SpotInstanceLabelKey: "example.com/spot",
+			},
+			// The Node label takes precedence over the Machine label
+			node:           newMachineNode("default", "test", map[string]string{"example.com/spot": "false"}),
+			machine:        newMachine("default", "test", map[string]string{"example.com/spot": "true"}),
+			isSpotInstance: false,
+		},
+		"machineLabel": {
+			config: &v1alpha1.ClusterAPICloudProvider{
+				SpotInstanceLabelKey: "example.com/spot",
+			},
+			node:           newMachineNode("default", "test", nil),
+			machine:        newMachine("default", "test", map[string]string{"example.com/spot": "true"}),
+			isSpotInstance: true,
+		},
+		"noLabels": {
+			config: &v1alpha1.ClusterAPICloudProvider{
+				SpotInstanceLabelKey: "example.com/spot",
+			},
+			node:           newMachineNode("default", "test", nil),
+			machine:        newMachine("default", "test", nil),
+			isSpotInstance: false,
+		},
+		"unmanagedNode": {
+			config: &v1alpha1.ClusterAPICloudProvider{
+				SpotInstanceLabelKey: "example.com/spot",
+			},
+			node:           &corev1.Node{},
+			isSpotInstance: false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			objects := []runtime.Object{}
+			if test.machine != nil {
+				objects = append(objects, test.machine)
+			}
+			capi := newFakeCloudProvider(test.config, objects...)
+
+			isSpotInstance, err := capi.IsSpotInstance(context.Background(), test.node)
+			require.Nil(t, err)
+			require.Equal(t, test.isSpotInstance, isSpotInstance)
+		})
+	}
+}
+
+func TestDeleteInstance(t *testing.T) {
+	ctx := context.Background()
+	capi := newFakeCloudProvider(
+		&v1alpha1.ClusterAPICloudProvider{SpotInstanceLabelKey: "example.com/spot"},
+		newMachine("default", "test-0", nil),
+		newMachine("default", "test-1", nil),
+	)
+
+	err := capi.DeleteInstance(ctx, newMachineNode("default", "test-0", nil))
+	require.Nil(t, err)
+
+	_, err = capi.dynamicClient.Resource(machineGVR).Namespace("default").Get(ctx, "test-0", metav1.GetOptions{})
+	require.True(t, apierrors.IsNotFound(err))
+	_, err = capi.dynamicClient.Resource(machineGVR).Namespace("default").Get(ctx, "test-1", metav1.GetOptions{})
+	require.Nil(t, err)
+
+	// Nodes without a Machine cannot be deleted
+	err = capi.DeleteInstance(ctx, &corev1.Node{})
+	require.NotNil(t, err)
+}
@@ -0,0 +1,67 @@
+package clusterapi
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// TestCloudProviderWithEnvtest runs the Cluster API cloud provider against a real API server with
+// the Cluster API CRDs installed. The CRDs in testdata are copied from the Cluster API v1.6.0
+// release: https://github.com/kubernetes-sigs/cluster-api/tree/v1.6.0/config/crd/bases
+func TestCloudProviderWithEnvtest(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set; run `make test-envtest` to install envtest binaries")
+	}
+	ctx := context.Background()
+
+	testEnv := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("testdata", "crds")},
+		ErrorIfCRDPathMissing: true,
+	}
+	restConfig, err := testEnv.Start()
+	require.Nil(t, err)
+	defer func() {
+		require.Nil(t, testEnv.Stop())
+	}()
+
+	capi, err := NewCloudProvider(restConfig, &v1alpha1.ClusterAPICloudProvider{
+		SpotInstanceLabelKey: "example.com/spot",
+	})
+	require.Nil(t, err)
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	require.Nil(t, err)
+
+	// Create a spot Machine and its Node
+	_, err = capi.dynamicClient.Resource(machineGVR).Namespace(metav1.NamespaceDefault).Create(ctx, newMachine(metav1.NamespaceDefault, "test", map[string]string{"example.com/spot": "true"}), metav1.CreateOptions{})
+	require.Nil(t, err)
+	node, err := clientset.CoreV1().Nodes().Create(ctx, newMachineNode(metav1.NamespaceDefault, "test", nil), metav1.CreateOptions{})
+	require.Nil(t, err)
+
+	isSpotInstance, err := capi.IsSpotInstance(ctx, node)
+	require.Nil(t, err)
+	require.True(t, isSpotInstance)
+
+	err = capi.DeleteInstance(ctx, node)
+	require.Nil(t, err)
+	_, err = capi.dynamicClient.Resource(machineGVR).Namespace(metav1.NamespaceDefault).Get(ctx, "test", metav1.GetOptions{})
+	require.True(t, apierrors.IsNotFound(err))
+
+	// Deleting the instance again should succeed since the Machine has already been deleted
+	err = capi.DeleteInstance(ctx, &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        node.Name,
+			Annotations: node.Annotations,
+		},
+	})
+	require.Nil(t, err)
+}
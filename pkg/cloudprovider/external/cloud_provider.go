@@ -0,0 +1,88 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	pb "github.com/hsbc/cost-manager/pkg/cloudprovider/external/proto"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// CloudProvider delegates to an out-of-process cloud provider plugin over gRPC. Plugins are
+// expected to run alongside cost-manager (e.g. as a sidecar container) so the connection is not
+// encrypted
+type CloudProvider struct {
+	client pb.CloudProviderClient
+}
+
+const (
+	// connectTimeout is how long to wait for the plugin to accept connections on startup; the
+	// plugin may be starting alongside cost-manager so we give it some time
+	connectTimeout = 30 * time.Second
+)
+
+// NewCloudProvider creates a new external cloud provider connected to the configured endpoint. The
+// connection is checked on startup so that a plugin that is not reachable is reported immediately
+// rather than on the first migration
+func NewCloudProvider(ctx context.Context, config *v1alpha1.ExternalCloudProvider) (*CloudProvider, error) {
+	if config == nil || config.Endpoint == "" {
+		return nil, errors.New("endpoint must be configured for the external cloud provider")
+	}
+	conn, err := grpc.NewClient(config.Endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create gRPC client for endpoint %s", config.Endpoint)
+	}
+	err = waitUntilReady(ctx, conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrapf(err, "failed to connect to endpoint %s", config.Endpoint)
+	}
+	return &CloudProvider{
+		client: pb.NewCloudProviderClient(conn),
+	}, nil
+}
+
+// waitUntilReady waits until the connection is ready or the connect timeout expires
+func waitUntilReady(ctx context.Context, conn *grpc.ClientConn) error {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	conn.Connect()
+	for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+		if !conn.WaitForStateChange(ctx, state) {
+			return errors.Errorf("connection is %s: %s", state, ctx.Err())
+		}
+	}
+	return nil
+}
+
+// IsSpotInstance asks the plugin whether the underlying instance of the Node is a spot instance
+func (external *CloudProvider) IsSpotInstance(ctx context.Context, node *corev1.Node) (bool, error) {
+	nodeData, err := json.Marshal(node)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to encode Node %s", node.Name)
+	}
+	r, err := external.client.IsSpotInstance(ctx, &pb.IsSpotInstanceRequest{Node: nodeData})
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to determine whether Node %s is a spot instance", node.Name)
+	}
+	return r.IsSpotInstance, nil
+}
+
+// DeleteInstance asks the plugin to delete the underlying instance of the Node
+func (external *CloudProvider) DeleteInstance(ctx context.Context, node *corev1.Node) error {
+	nodeData, err := json.Marshal(node)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode Node %s", node.Name)
+	}
+	_, err = external.client.DeleteInstance(ctx, &pb.DeleteInstanceRequest{Node: nodeData})
+	if err != nil {
+		return errors.Wrapf(err, "failed to delete instance of Node %s", node.Name)
+	}
+	return nil
+}
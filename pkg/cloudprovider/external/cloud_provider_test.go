@@ -0,0 +1,94 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/fake"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// failingCloudProvider wraps the fake cloud provider to fail deleting instances
+type failingCloudProvider struct {
+	fake.CloudProvider
+}
+
+func (f *failingCloudProvider) DeleteInstance(ctx context.Context, node *corev1.Node) error {
+	return errors.New("instance is protected")
+}
+
+// servePlugin serves the cloud provider as a plugin on a Unix socket and returns its endpoint
+func servePlugin(t *testing.T, cloudProvider PluginCloudProvider) string {
+	socketPath := filepath.Join(t.TempDir(), "plugin.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.Nil(t, err)
+	server := NewServer(cloudProvider)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	return "unix://" + socketPath
+}
+
+func TestCloudProvider(t *testing.T) {
+	ctx := context.Background()
+	external, err := NewCloudProvider(ctx, &v1alpha1.ExternalCloudProvider{
+		Endpoint: servePlugin(t, &fake.CloudProvider{}),
+	})
+	require.Nil(t, err)
+
+	spotNode := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "spot",
+			Labels: map[string]string{
+				fake.SpotInstanceLabelKey: fake.SpotInstanceLabelValue,
+			},
+		},
+	}
+	isSpotInstance, err := external.IsSpotInstance(ctx, spotNode)
+	require.Nil(t, err)
+	require.True(t, isSpotInstance)
+
+	onDemandNode := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "on-demand"}}
+	isSpotInstance, err = external.IsSpotInstance(ctx, onDemandNode)
+	require.Nil(t, err)
+	require.False(t, isSpotInstance)
+
+	err = external.DeleteInstance(ctx, onDemandNode)
+	require.Nil(t, err)
+}
+
+func TestCloudProviderPluginError(t *testing.T) {
+	ctx := context.Background()
+	external, err := NewCloudProvider(ctx, &v1alpha1.ExternalCloudProvider{
+		Endpoint: servePlugin(t, &failingCloudProvider{}),
+	})
+	require.Nil(t, err)
+
+	err = external.DeleteInstance(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test"}})
+	require.ErrorContains(t, err, "instance is protected")
+}
+
+func TestNewCloudProviderWithoutEndpoint(t *testing.T) {
+	ctx := context.Background()
+	_, err := NewCloudProvider(ctx, nil)
+	require.NotNil(t, err)
+	_, err = NewCloudProvider(ctx, &v1alpha1.ExternalCloudProvider{})
+	require.NotNil(t, err)
+}
+
+func TestNewCloudProviderWithUnreachableEndpoint(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := NewCloudProvider(ctx, &v1alpha1.ExternalCloudProvider{
+		Endpoint: "unix://" + filepath.Join(t.TempDir(), "missing.sock"),
+	})
+	require.NotNil(t, err)
+}
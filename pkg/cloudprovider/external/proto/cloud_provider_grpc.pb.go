@@ -0,0 +1,152 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: cloud_provider.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	CloudProvider_IsSpotInstance_FullMethodName = "/costmanager.cloudprovider.v1alpha1.CloudProvider/IsSpotInstance"
+	CloudProvider_DeleteInstance_FullMethodName = "/costmanager.cloudprovider.v1alpha1.CloudProvider/DeleteInstance"
+)
+
+// CloudProviderClient is the client API for CloudProvider service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CloudProviderClient interface {
+	// IsSpotInstance determines whether the underlying instance of the Node is a spot instance
+	IsSpotInstance(ctx context.Context, in *IsSpotInstanceRequest, opts ...grpc.CallOption) (*IsSpotInstanceResponse, error)
+	// DeleteInstance should drain connections from external load balancers to the Node and then
+	// delete the underlying instance
+	DeleteInstance(ctx context.Context, in *DeleteInstanceRequest, opts ...grpc.CallOption) (*DeleteInstanceResponse, error)
+}
+
+type cloudProviderClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCloudProviderClient(cc grpc.ClientConnInterface) CloudProviderClient {
+	return &cloudProviderClient{cc}
+}
+
+func (c *cloudProviderClient) IsSpotInstance(ctx context.Context, in *IsSpotInstanceRequest, opts ...grpc.CallOption) (*IsSpotInstanceResponse, error) {
+	out := new(IsSpotInstanceResponse)
+	err := c.cc.Invoke(ctx, CloudProvider_IsSpotInstance_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cloudProviderClient) DeleteInstance(ctx context.Context, in *DeleteInstanceRequest, opts ...grpc.CallOption) (*DeleteInstanceResponse, error) {
+	out := new(DeleteInstanceResponse)
+	err := c.cc.Invoke(ctx, CloudProvider_DeleteInstance_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CloudProviderServer is the server API for CloudProvider service.
+// All implementations must embed UnimplementedCloudProviderServer
+// for forward compatibility
+type CloudProviderServer interface {
+	// IsSpotInstance determines whether the underlying instance of the Node is a spot instance
+	IsSpotInstance(context.Context, *IsSpotInstanceRequest) (*IsSpotInstanceResponse, error)
+	// DeleteInstance should drain connections from external load balancers to the Node and then
+	// delete the underlying instance
+	DeleteInstance(context.Context, *DeleteInstanceRequest) (*DeleteInstanceResponse, error)
+	mustEmbedUnimplementedCloudProviderServer()
+}
+
+// UnimplementedCloudProviderServer must be embedded to have forward compatible implementations.
+type UnimplementedCloudProviderServer struct {
+}
+
+func (UnimplementedCloudProviderServer) IsSpotInstance(context.Context, *IsSpotInstanceRequest) (*IsSpotInstanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method IsSpotInstance not implemented")
+}
+func (UnimplementedCloudProviderServer) DeleteInstance(context.Context, *DeleteInstanceRequest) (*DeleteInstanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteInstance not implemented")
+}
+func (UnimplementedCloudProviderServer) mustEmbedUnimplementedCloudProviderServer() {}
+
+// UnsafeCloudProviderServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CloudProviderServer will
+// result in compilation errors.
+type UnsafeCloudProviderServer interface {
+	mustEmbedUnimplementedCloudProviderServer()
+}
+
+func RegisterCloudProviderServer(s grpc.ServiceRegistrar, srv CloudProviderServer) {
+	s.RegisterService(&CloudProvider_ServiceDesc, srv)
+}
+
+func _CloudProvider_IsSpotInstance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IsSpotInstanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudProviderServer).IsSpotInstance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CloudProvider_IsSpotInstance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudProviderServer).IsSpotInstance(ctx, req.(*IsSpotInstanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CloudProvider_DeleteInstance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteInstanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudProviderServer).DeleteInstance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CloudProvider_DeleteInstance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudProviderServer).DeleteInstance(ctx, req.(*DeleteInstanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CloudProvider_ServiceDesc is the grpc.ServiceDesc for CloudProvider service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CloudProvider_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "costmanager.cloudprovider.v1alpha1.CloudProvider",
+	HandlerType: (*CloudProviderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "IsSpotInstance",
+			Handler:    _CloudProvider_IsSpotInstance_Handler,
+		},
+		{
+			MethodName: "DeleteInstance",
+			Handler:    _CloudProvider_DeleteInstance_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "cloud_provider.proto",
+}
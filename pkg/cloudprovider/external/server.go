@@ -0,0 +1,67 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+
+	pb "github.com/hsbc/cost-manager/pkg/cloudprovider/external/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PluginCloudProvider contains the functions that a cloud provider plugin must implement; this
+// mirrors cloudprovider.CloudProvider which cannot be imported here since the cloudprovider package
+// imports this package to construct the external cloud provider. The cloudprovider package asserts
+// that every CloudProvider implements PluginCloudProvider so that the two cannot drift apart
+type PluginCloudProvider interface {
+	IsSpotInstance(ctx context.Context, node *corev1.Node) (bool, error)
+	DeleteInstance(ctx context.Context, node *corev1.Node) error
+}
+
+// NewServer returns a gRPC server that serves the cloud provider to allow it to be used as a plugin
+// by the external cloud provider
+func NewServer(cloudProvider PluginCloudProvider, opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(opts...)
+	pb.RegisterCloudProviderServer(server, &pluginServer{cloudProvider: cloudProvider})
+	return server
+}
+
+type pluginServer struct {
+	pb.UnimplementedCloudProviderServer
+	cloudProvider PluginCloudProvider
+}
+
+func (s *pluginServer) IsSpotInstance(ctx context.Context, request *pb.IsSpotInstanceRequest) (*pb.IsSpotInstanceResponse, error) {
+	node, err := decodeNode(request.Node)
+	if err != nil {
+		return nil, err
+	}
+	isSpotInstance, err := s.cloudProvider.IsSpotInstance(ctx, node)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.IsSpotInstanceResponse{IsSpotInstance: isSpotInstance}, nil
+}
+
+func (s *pluginServer) DeleteInstance(ctx context.Context, request *pb.DeleteInstanceRequest) (*pb.DeleteInstanceResponse, error) {
+	node, err := decodeNode(request.Node)
+	if err != nil {
+		return nil, err
+	}
+	err = s.cloudProvider.DeleteInstance(ctx, node)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.DeleteInstanceResponse{}, nil
+}
+
+func decodeNode(nodeData []byte) (*corev1.Node, error) {
+	node := &corev1.Node{}
+	err := json.Unmarshal(nodeData, node)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to decode Node: %s", err)
+	}
+	return node, nil
+}
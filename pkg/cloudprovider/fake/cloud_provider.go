@@ -2,23 +2,131 @@ package fake
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/instanceinfo"
+	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
 )
 
 const (
 	SpotInstanceLabelKey   = "is-spot-instance"
 	SpotInstanceLabelValue = "true"
+
+	// Names of the CloudProvider functions used to record calls
+	IsSpotInstanceMethod  = "IsSpotInstance"
+	DeleteInstanceMethod  = "DeleteInstance"
+	GetInstanceInfoMethod = "GetInstanceInfo"
+)
+
+// CapacityType is the capacity type of a replacement Node
+type CapacityType string
+
+const (
+	CapacityTypeSpot     CapacityType = "spot"
+	CapacityTypeOnDemand CapacityType = "on-demand"
 )
 
-// CloudProvider is a fake implementation of the cloudprovider.CloudProvider interface for testing
-type CloudProvider struct{}
+// CloudProvider is a fake implementation of the cloudprovider.CloudProvider interface for testing.
+// The zero value never fails and does not modify the cluster; the exported fields can be used to
+// script failure modes and to simulate the node controller
+type CloudProvider struct {
+	// Clientset is used to delete Node objects and create replacement Nodes
+	Clientset kubernetes.Interface
+	// DeleteNodes deletes the Node object when deleting the instance to simulate the node
+	// controller removing Nodes whose instance has been deleted
+	DeleteNodes bool
+	// ReplacementCapacityType creates a replacement Node of the specified capacity type after the
+	// Node object has been deleted to simulate the cluster autoscaler scaling up
+	ReplacementCapacityType CapacityType
+	// IsSpotInstanceErrors maps Node names to the error returned by IsSpotInstance
+	IsSpotInstanceErrors map[string]error
+	// DeleteInstanceErrors maps Node names to the error returned by DeleteInstance
+	DeleteInstanceErrors map[string]error
+	// DeleteInstanceLatencies maps Node names to how long DeleteInstance takes
+	DeleteInstanceLatencies map[string]time.Duration
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Call records a call to the fake cloud provider
+type Call struct {
+	Method   string
+	NodeName string
+}
+
+// Calls returns the calls that have been made to the fake cloud provider in order
+func (fake *CloudProvider) Calls() []Call {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return append([]Call{}, fake.calls...)
+}
+
+func (fake *CloudProvider) recordCall(method string, node *corev1.Node) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.calls = append(fake.calls, Call{Method: method, NodeName: node.Name})
+}
 
 func (fake *CloudProvider) DeleteInstance(ctx context.Context, node *corev1.Node) error {
+	fake.recordCall(DeleteInstanceMethod, node)
+
+	if latency, ok := fake.DeleteInstanceLatencies[node.Name]; ok {
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err, ok := fake.DeleteInstanceErrors[node.Name]; ok {
+		return err
+	}
+
+	if !fake.DeleteNodes {
+		return nil
+	}
+	if fake.Clientset == nil {
+		return errors.New("clientset must be set to delete Nodes")
+	}
+	err := fake.Clientset.CoreV1().Nodes().Delete(ctx, node.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete Node %s", node.Name)
+	}
+
+	if fake.ReplacementCapacityType == "" {
+		return nil
+	}
+	// We set the UID and creation timestamp since these would normally be set by the API server
+	replacementNode := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              fmt.Sprintf("%s-replacement", node.Name),
+			UID:               uuid.NewUUID(),
+			CreationTimestamp: metav1.Now(),
+			Labels: map[string]string{
+				SpotInstanceLabelKey: fmt.Sprint(fake.ReplacementCapacityType == CapacityTypeSpot),
+			},
+		},
+	}
+	_, err = fake.Clientset.CoreV1().Nodes().Create(ctx, replacementNode, metav1.CreateOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to create replacement Node %s", replacementNode.Name)
+	}
+
 	return nil
 }
 
 func (fake *CloudProvider) IsSpotInstance(ctx context.Context, node *corev1.Node) (bool, error) {
+	fake.recordCall(IsSpotInstanceMethod, node)
+	if err, ok := fake.IsSpotInstanceErrors[node.Name]; ok {
+		return false, err
+	}
 	if node.Labels == nil {
 		return false, nil
 	}
@@ -28,3 +136,19 @@ func (fake *CloudProvider) IsSpotInstance(ctx context.Context, node *corev1.Node
 	}
 	return value == SpotInstanceLabelValue, nil
 }
+
+// GetInstanceInfo returns instance information derived from the well-known labels of the Node
+func (fake *CloudProvider) GetInstanceInfo(ctx context.Context, node *corev1.Node) (*instanceinfo.InstanceInfo, error) {
+	fake.recordCall(GetInstanceInfoMethod, node)
+	isSpotInstance := node.Labels[SpotInstanceLabelKey] == SpotInstanceLabelValue
+	provisioningModel := instanceinfo.ProvisioningModelStandard
+	if isSpotInstance {
+		provisioningModel = instanceinfo.ProvisioningModelSpot
+	}
+	return &instanceinfo.InstanceInfo{
+		MachineType:       node.Labels[corev1.LabelInstanceTypeStable],
+		Zone:              node.Labels[corev1.LabelTopologyZone],
+		ProvisioningModel: provisioningModel,
+		CreationTime:      node.CreationTimestamp.Time,
+	}, nil
+}
@@ -0,0 +1,146 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/instanceinfo"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetInstanceInfo(t *testing.T) {
+	creationTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			CreationTimestamp: metav1.NewTime(creationTime),
+			Labels: map[string]string{
+				SpotInstanceLabelKey:           SpotInstanceLabelValue,
+				corev1.LabelInstanceTypeStable: "n2-standard-4",
+				corev1.LabelTopologyZone:       "europe-west2-a",
+			},
+		},
+	}
+	instanceInfo, err := (&CloudProvider{}).GetInstanceInfo(context.Background(), node)
+	require.Nil(t, err)
+	require.Equal(t, &instanceinfo.InstanceInfo{
+		MachineType:       "n2-standard-4",
+		Zone:              "europe-west2-a",
+		ProvisioningModel: "SPOT",
+		CreationTime:      creationTime,
+	}, instanceInfo)
+}
+
+func TestCloudProviderRecordsCalls(t *testing.T) {
+	ctx := context.Background()
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+		},
+	}
+	cloudProvider := &CloudProvider{}
+	_, err := cloudProvider.IsSpotInstance(ctx, node)
+	require.Nil(t, err)
+	err = cloudProvider.DeleteInstance(ctx, node)
+	require.Nil(t, err)
+	require.Equal(t, []Call{
+		{Method: IsSpotInstanceMethod, NodeName: "test"},
+		{Method: DeleteInstanceMethod, NodeName: "test"},
+	}, cloudProvider.Calls())
+}
+
+func TestCloudProviderErrors(t *testing.T) {
+	ctx := context.Background()
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+		},
+	}
+	isSpotInstanceErr := errors.New("is spot instance error")
+	deleteInstanceErr := errors.New("delete instance error")
+	cloudProvider := &CloudProvider{
+		IsSpotInstanceErrors: map[string]error{"test": isSpotInstanceErr},
+		DeleteInstanceErrors: map[string]error{"test": deleteInstanceErr},
+	}
+	_, err := cloudProvider.IsSpotInstance(ctx, node)
+	require.ErrorIs(t, err, isSpotInstanceErr)
+	err = cloudProvider.DeleteInstance(ctx, node)
+	require.ErrorIs(t, err, deleteInstanceErr)
+
+	// Other Nodes should not be affected
+	err = cloudProvider.DeleteInstance(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "other"}})
+	require.Nil(t, err)
+}
+
+func TestCloudProviderDeleteInstanceLatency(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+		},
+	}
+	cloudProvider := &CloudProvider{
+		DeleteInstanceLatencies: map[string]time.Duration{"test": time.Hour},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := cloudProvider.DeleteInstance(ctx, node)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestCloudProviderDeleteInstanceDeleteNodes(t *testing.T) {
+	tests := map[string]struct {
+		replacementCapacityType CapacityType
+		expectedNodeNames       []string
+		expectedSpotLabelValue  string
+	}{
+		"noReplacement": {},
+		"spotReplacement": {
+			replacementCapacityType: CapacityTypeSpot,
+			expectedNodeNames:       []string{"test-replacement"},
+			expectedSpotLabelValue:  "true",
+		},
+		"onDemandReplacement": {
+			replacementCapacityType: CapacityTypeOnDemand,
+			expectedNodeNames:       []string{"test-replacement"},
+			expectedSpotLabelValue:  "false",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+			}
+			clientset := fake.NewSimpleClientset(node)
+			cloudProvider := &CloudProvider{
+				Clientset:               clientset,
+				DeleteNodes:             true,
+				ReplacementCapacityType: test.replacementCapacityType,
+			}
+			err := cloudProvider.DeleteInstance(ctx, node)
+			require.Nil(t, err)
+
+			nodeList, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+			require.Nil(t, err)
+			nodeNames := []string{}
+			for _, node := range nodeList.Items {
+				nodeNames = append(nodeNames, node.Name)
+				require.Equal(t, test.expectedSpotLabelValue, node.Labels[SpotInstanceLabelKey])
+				require.NotEmpty(t, node.UID)
+			}
+			require.ElementsMatch(t, test.expectedNodeNames, nodeNames)
+
+			// Deleting the instance again should not fail if the Node has already been deleted
+			if test.replacementCapacityType == "" {
+				err = cloudProvider.DeleteInstance(ctx, node)
+				require.Nil(t, err)
+			}
+		})
+	}
+}
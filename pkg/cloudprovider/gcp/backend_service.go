@@ -0,0 +1,152 @@
+package gcp
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/compute/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	defaultBackendServiceHealthTimeout = 10 * time.Minute
+
+	healthStateHealthy = "HEALTHY"
+)
+
+// waitForInstanceToBeUnhealthy waits for every backend service that uses the instance group of the
+// managed instance group as a backend to report the instance as not healthy. Note that backend
+// services that use network endpoint groups (e.g. container-native load balancing) are not
+// considered since their endpoints are Pods rather than instances
+func (gcp *CloudProvider) waitForInstanceToBeUnhealthy(ctx context.Context, project string, managedInstanceGroup managedInstanceGroup, instance *compute.Instance) error {
+	instanceGroup, err := gcp.getInstanceGroup(ctx, project, managedInstanceGroup)
+	if err != nil {
+		return err
+	}
+	backendServices, err := gcp.listBackendServicesForInstanceGroup(ctx, project, instanceGroup)
+	if err != nil {
+		return err
+	}
+
+	for _, backendService := range backendServices {
+		logger := log.FromContext(ctx, "backendService", backendService.Name)
+		logger.Info("Waiting for backend service to report instance as not healthy")
+		err := gcp.poll(ctx, gcp.backendServiceHealthTimeout, func(ctx context.Context) (bool, error) {
+			healthStatus, err := gcp.getBackendServiceHealth(ctx, project, backendService, instanceGroup)
+			if err != nil {
+				return false, err
+			}
+			return !isInstanceHealthy(healthStatus, instance.SelfLink), nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to wait for backend service %s", backendService.Name)
+		}
+		logger.Info("Backend service reports instance as not healthy")
+	}
+
+	return nil
+}
+
+// getInstanceGroup returns the URL of the instance group that is created by the managed instance
+// group to contain its instances
+func (gcp *CloudProvider) getInstanceGroup(ctx context.Context, project string, managedInstanceGroup managedInstanceGroup) (string, error) {
+	var instanceGroup string
+	err := gcp.retry(ctx, gcp.operationTimeout, func(ctx context.Context) error {
+		if managedInstanceGroup.regional {
+			r, err := gcp.computeService.RegionInstanceGroupManagers.Get(project, managedInstanceGroup.location, managedInstanceGroup.name).Context(ctx).Do()
+			if err != nil {
+				return err
+			}
+			instanceGroup = r.InstanceGroup
+			return nil
+		}
+		r, err := gcp.computeService.InstanceGroupManagers.Get(project, managedInstanceGroup.location, managedInstanceGroup.name).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+		instanceGroup = r.InstanceGroup
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get managed instance group %s", managedInstanceGroup.name)
+	}
+	return instanceGroup, nil
+}
+
+// listBackendServicesForInstanceGroup lists all global and regional backend services in the
+// project that have the instance group as a backend
+func (gcp *CloudProvider) listBackendServicesForInstanceGroup(ctx context.Context, project, instanceGroup string) ([]*compute.BackendService, error) {
+	var backendServices []*compute.BackendService
+	err := gcp.retry(ctx, gcp.operationTimeout, func(ctx context.Context) error {
+		backendServices = nil
+		return gcp.computeService.BackendServices.AggregatedList(project).Context(ctx).Pages(ctx, func(r *compute.BackendServiceAggregatedList) error {
+			for _, scopedList := range r.Items {
+				backendServices = append(backendServices, filterBackendServicesForInstanceGroup(scopedList.BackendServices, instanceGroup)...)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list backend services")
+	}
+	return backendServices, nil
+}
+
+func filterBackendServicesForInstanceGroup(backendServices []*compute.BackendService, instanceGroup string) []*compute.BackendService {
+	var filteredBackendServices []*compute.BackendService
+	for _, backendService := range backendServices {
+		for _, backend := range backendService.Backends {
+			if backend != nil && isSameResource(backend.Group, instanceGroup) {
+				filteredBackendServices = append(filteredBackendServices, backendService)
+				break
+			}
+		}
+	}
+	return filteredBackendServices
+}
+
+// getBackendServiceHealth returns the health of the instances in the instance group as reported
+// by the global or regional backend service
+func (gcp *CloudProvider) getBackendServiceHealth(ctx context.Context, project string, backendService *compute.BackendService, instanceGroup string) ([]*compute.HealthStatus, error) {
+	resourceGroupReference := &compute.ResourceGroupReference{Group: instanceGroup}
+	if backendService.Region != "" {
+		region := lastURLSegment(backendService.Region)
+		r, err := gcp.computeService.RegionBackendServices.GetHealth(project, region, backendService.Name, resourceGroupReference).Context(ctx).Do()
+		if err != nil {
+			return nil, err
+		}
+		return r.HealthStatus, nil
+	}
+	r, err := gcp.computeService.BackendServices.GetHealth(project, backendService.Name, resourceGroupReference).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return r.HealthStatus, nil
+}
+
+// isInstanceHealthy determines whether any health status reports the instance as healthy; an
+// instance without any health status has been removed from the backend service
+func isInstanceHealthy(healthStatus []*compute.HealthStatus, instance string) bool {
+	for _, status := range healthStatus {
+		if status != nil && isSameResource(status.Instance, instance) && status.HealthState == healthStateHealthy {
+			return true
+		}
+	}
+	return false
+}
+
+// isSameResource determines whether two compute resource URLs refer to the same resource; URLs may
+// either be full URLs (e.g. https://www.googleapis.com/compute/v1/projects/...) or partial URLs
+// (e.g. projects/...)
+func isSameResource(a, b string) bool {
+	return relativeResourceName(a) == relativeResourceName(b)
+}
+
+func relativeResourceName(url string) string {
+	if i := strings.Index(url, "projects/"); i >= 0 {
+		return url[i:]
+	}
+	return url
+}
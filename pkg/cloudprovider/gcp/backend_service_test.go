@@ -0,0 +1,79 @@
+package gcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+)
+
+const (
+	testInstanceGroup = "https://www.googleapis.com/compute/v1/projects/my-project/zones/my-zone/instanceGroups/my-instance-group"
+	testInstance      = "https://www.googleapis.com/compute/v1/projects/my-project/zones/my-zone/instances/my-instance"
+)
+
+func TestFilterBackendServicesForInstanceGroup(t *testing.T) {
+	backendServices := []*compute.BackendService{
+		{
+			Name: "matching",
+			Backends: []*compute.Backend{
+				{Group: "https://www.googleapis.com/compute/v1/projects/my-project/zones/my-zone/instanceGroups/other-instance-group"},
+				{Group: "projects/my-project/zones/my-zone/instanceGroups/my-instance-group"},
+			},
+		},
+		{
+			Name: "networkEndpointGroup",
+			Backends: []*compute.Backend{
+				{Group: "https://www.googleapis.com/compute/v1/projects/my-project/zones/my-zone/networkEndpointGroups/my-network-endpoint-group"},
+			},
+		},
+		{
+			Name: "noBackends",
+		},
+	}
+	filteredBackendServices := filterBackendServicesForInstanceGroup(backendServices, testInstanceGroup)
+	require.Len(t, filteredBackendServices, 1)
+	require.Equal(t, "matching", filteredBackendServices[0].Name)
+}
+
+func TestIsInstanceHealthy(t *testing.T) {
+	tests := map[string]struct {
+		healthStatus []*compute.HealthStatus
+		healthy      bool
+	}{
+		"healthy": {
+			healthStatus: []*compute.HealthStatus{
+				{Instance: testInstance, HealthState: "HEALTHY"},
+			},
+			healthy: true,
+		},
+		"unhealthy": {
+			healthStatus: []*compute.HealthStatus{
+				{Instance: testInstance, HealthState: "UNHEALTHY"},
+			},
+			healthy: false,
+		},
+		"healthyForOneForwardingRule": {
+			healthStatus: []*compute.HealthStatus{
+				{Instance: testInstance, HealthState: "UNHEALTHY", ForwardingRule: "a"},
+				{Instance: testInstance, HealthState: "HEALTHY", ForwardingRule: "b"},
+			},
+			healthy: true,
+		},
+		"otherInstanceHealthy": {
+			healthStatus: []*compute.HealthStatus{
+				{Instance: "https://www.googleapis.com/compute/v1/projects/my-project/zones/my-zone/instances/other-instance", HealthState: "HEALTHY"},
+			},
+			healthy: false,
+		},
+		"removed": {
+			healthStatus: nil,
+			healthy:      false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.healthy, isInstanceHealthy(test.healthStatus, testInstance))
+		})
+	}
+}
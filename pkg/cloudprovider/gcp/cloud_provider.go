@@ -3,13 +3,22 @@ package gcp
 import (
 	"context"
 	"fmt"
-	"strconv"
+	"slices"
 	"time"
 
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/instanceinfo"
 	"github.com/hsbc/cost-manager/pkg/kubernetes"
 	"github.com/pkg/errors"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgo "k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 const (
@@ -17,34 +26,235 @@ const (
 	spotNodeLabelKey = "cloud.google.com/gke-spot"
 	// https://cloud.google.com/kubernetes-engine/docs/how-to/preemptible-vms#use_nodeselector_to_schedule_pods_on_preemptible_vms
 	preemptibleNodeLabelKey = "cloud.google.com/gke-preemptible"
+
+	// GCP Network Load Balancer health checks have an interval of 8 seconds with a timeout of 1
+	// second and an unhealthy threshold of 3 so we wait for 3 * 8 + 1 = 25 seconds for instances to
+	// be marked as unhealthy which triggers connection draining. We add an additional 30 seconds
+	// since this is the connection draining timeout used when GKE subsetting is enabled. We then
+	// add an additional 5 seconds to allow processing time for the various components involved
+	// (e.g. GCP probes and kube-proxy):
+	// https://github.com/kubernetes/ingress-gce/blob/2a08b1e4111a21c71455bbb2bcca13349bb6f4c0/pkg/healthchecksl4/healthchecksl4.go#L42
+	defaultLoadBalancerDrainDelay = time.Minute
+)
+
+var (
+	// deletionModeAnnotationKey is added to each Node that is deleted to expose which deletion mode
+	// was used
+	deletionModeAnnotationKey = fmt.Sprintf("%s/%s", v1alpha1.GroupName, "deletion-mode")
 )
 
 type CloudProvider struct {
-	computeService *compute.Service
+	computeService                       *compute.Service
+	clientset                            clientgo.Interface
+	operationTimeout                     time.Duration
+	managedInstanceGroupStabilityTimeout time.Duration
+	loadBalancerDrainDelay               time.Duration
+	waitForBackendServiceHealth          bool
+	backendServiceHealthTimeout          time.Duration
+	// containerService and cluster are only set when the spot node pool pre-flight check is
+	// enabled
+	containerService    *container.Service
+	cluster             string
+	initialPollInterval time.Duration
+	maxPollInterval     time.Duration
+	instancePrices      []v1alpha1.InstancePrice
+	instanceInfoCache   *instanceinfo.Cache
+	deletionMode        v1alpha1.GCPDeletionMode
+	taint               corev1.Taint
+	// nodePoolMinimumSizeCheck is only set when the node pool minimum size check is enabled
+	nodePoolMinimumSizeCheck *nodePoolMinimumSizeCheck
 }
 
-// NewCloudProvider creates a new GCP cloud provider
-func NewCloudProvider(ctx context.Context) (*CloudProvider, error) {
-	computeService, err := compute.NewService(ctx)
+// NewCloudProvider creates a new GCP cloud provider. The clientset is used to annotate and taint
+// Nodes
+func NewCloudProvider(ctx context.Context, config *v1alpha1.GCPCloudProvider, clientset clientgo.Interface) (*CloudProvider, error) {
+	if config == nil {
+		config = &v1alpha1.GCPCloudProvider{}
+	}
+	clientOptions, err := newClientOptions(ctx, config)
 	if err != nil {
 		return nil, err
 	}
-	return &CloudProvider{
-		computeService,
-	}, nil
+	return newCloudProviderWithClientOptions(ctx, config, clientset, clientOptions...)
+}
+
+// newCloudProviderWithClientOptions creates a new GCP cloud provider using the specified client
+// options (e.g. option.WithoutAuthentication) when creating all GCP API services
+func newCloudProviderWithClientOptions(ctx context.Context, config *v1alpha1.GCPCloudProvider, clientset clientgo.Interface, clientOptions ...option.ClientOption) (*CloudProvider, error) {
+	computeClientOptions := clientOptions
+	if config.Endpoint != "" {
+		computeClientOptions = append(slices.Clone(clientOptions), option.WithEndpoint(config.Endpoint))
+	}
+	computeService, err := compute.NewService(ctx, computeClientOptions...)
+	if err != nil {
+		return nil, err
+	}
+	gcp := newCloudProvider(computeService, config)
+	gcp.clientset = clientset
+
+	if config.SpotNodePoolPreflightCheck != nil {
+		containerService, cluster, err := newContainerService(ctx, config.SpotNodePoolPreflightCheck.Endpoint, config.SpotNodePoolPreflightCheck.Cluster, clientOptions)
+		if err != nil {
+			return nil, err
+		}
+		gcp.containerService = containerService
+		gcp.cluster = cluster
+	}
+
+	if config.NodePoolMinimumSizeCheck != nil {
+		containerService, cluster, err := newContainerService(ctx, config.NodePoolMinimumSizeCheck.Endpoint, config.NodePoolMinimumSizeCheck.Cluster, clientOptions)
+		if err != nil {
+			return nil, err
+		}
+		action := v1alpha1.GKENodePoolMinimumSizeActionWarn
+		if config.NodePoolMinimumSizeCheck.Action != "" {
+			action = config.NodePoolMinimumSizeCheck.Action
+		}
+		gcp.nodePoolMinimumSizeCheck = &nodePoolMinimumSizeCheck{
+			containerService: containerService,
+			cluster:          cluster,
+			action:           action,
+		}
+	}
+
+	return gcp, nil
+}
+
+// newContainerService creates a GKE API service, determining the cluster using the metadata server
+// if it is not specified
+func newContainerService(ctx context.Context, endpoint, cluster string, clientOptions []option.ClientOption) (*container.Service, string, error) {
+	if endpoint != "" {
+		clientOptions = append(slices.Clone(clientOptions), option.WithEndpoint(endpoint))
+	}
+	containerService, err := container.NewService(ctx, clientOptions...)
+	if err != nil {
+		return nil, "", err
+	}
+	if cluster == "" {
+		cluster, err = getClusterFromMetadataServer()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return containerService, cluster, nil
+}
+
+// newClientOptions returns the client options that are used to create GCP API services based on
+// the configured credentials, quota project and user agent
+func newClientOptions(ctx context.Context, config *v1alpha1.GCPCloudProvider) ([]option.ClientOption, error) {
+	var clientOptions []option.ClientOption
+	if config.CredentialsFile != "" {
+		clientOptions = append(clientOptions, option.WithCredentialsFile(config.CredentialsFile))
+	}
+	if config.ImpersonateServiceAccount != "" {
+		// The credentials (or Application Default Credentials if not set) are used to generate
+		// short-lived access tokens for the impersonated service account
+		tokenSource, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+			TargetPrincipal: config.ImpersonateServiceAccount,
+			Scopes:          []string{compute.CloudPlatformScope},
+		}, clientOptions...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to impersonate service account %s", config.ImpersonateServiceAccount)
+		}
+		clientOptions = []option.ClientOption{option.WithTokenSource(tokenSource)}
+	}
+	if config.QuotaProject != "" {
+		clientOptions = append(clientOptions, option.WithQuotaProject(config.QuotaProject))
+	}
+	if config.UserAgent != "" {
+		clientOptions = append(clientOptions, option.WithUserAgent(config.UserAgent))
+	}
+	return clientOptions, nil
+}
+
+func newCloudProvider(computeService *compute.Service, config *v1alpha1.GCPCloudProvider) *CloudProvider {
+	if config == nil {
+		config = &v1alpha1.GCPCloudProvider{}
+	}
+	operationTimeout := defaultOperationTimeout
+	if config.OperationTimeout != nil {
+		operationTimeout = config.OperationTimeout.Duration
+	}
+	managedInstanceGroupStabilityTimeout := defaultManagedInstanceGroupStabilityTimeout
+	if config.ManagedInstanceGroupStabilityTimeout != nil {
+		managedInstanceGroupStabilityTimeout = config.ManagedInstanceGroupStabilityTimeout.Duration
+	}
+	loadBalancerDrainDelay := defaultLoadBalancerDrainDelay
+	if config.LoadBalancerDrainDelay != nil {
+		loadBalancerDrainDelay = config.LoadBalancerDrainDelay.Duration
+	}
+	backendServiceHealthTimeout := defaultBackendServiceHealthTimeout
+	if config.BackendServiceHealthTimeout != nil {
+		backendServiceHealthTimeout = config.BackendServiceHealthTimeout.Duration
+	}
+	deletionMode := v1alpha1.GCPDeletionModeDeleteInstance
+	if config.DeletionMode != "" {
+		deletionMode = config.DeletionMode
+	}
+	taint := corev1.Taint{
+		Key:    kubernetes.DeleteTaint,
+		Effect: corev1.TaintEffectNoSchedule,
+	}
+	if config.Taint != nil {
+		taint = *config.Taint
+	}
+	gcp := &CloudProvider{
+		computeService:                       computeService,
+		operationTimeout:                     operationTimeout,
+		managedInstanceGroupStabilityTimeout: managedInstanceGroupStabilityTimeout,
+		loadBalancerDrainDelay:               loadBalancerDrainDelay,
+		waitForBackendServiceHealth:          config.WaitForBackendServiceHealth,
+		backendServiceHealthTimeout:          backendServiceHealthTimeout,
+		initialPollInterval:                  initialPollInterval,
+		maxPollInterval:                      maxPollInterval,
+		instancePrices:                       config.InstancePrices,
+		deletionMode:                         deletionMode,
+		taint:                                taint,
+	}
+	gcp.instanceInfoCache = instanceinfo.NewCache(gcp.getInstanceInfo, instanceInfoCacheTTL)
+	return gcp
 }
 
 // DeleteInstance drains any connections from GCP load balancers, retrieves the underlying compute
-// instance of the Kubernetes Node and then deletes it from its managed instance group
+// instance of the Kubernetes Node and then deletes it from its managed instance group. When using
+// the Taint deletion mode the Node is instead tainted and its removal is left to the cluster
+// autoscaler
 func (gcp *CloudProvider) DeleteInstance(ctx context.Context, node *corev1.Node) error {
-	// GCP Network Load Balancer health checks have an interval of 8 seconds with a timeout of 1
-	// second and an unhealthy threshold of 3 so we wait for 3 * 8 + 1 = 25 seconds for instances to
-	// be marked as unhealthy which triggers connection draining. We add an additional 30 seconds
-	// since this is the connection draining timeout used when GKE subsetting is enabled. We then
-	// add an additional 5 seconds to allow processing time for the various components involved
-	// (e.g. GCP probes and kube-proxy):
-	// https://github.com/kubernetes/ingress-gce/blob/2a08b1e4111a21c71455bbb2bcca13349bb6f4c0/pkg/healthchecksl4/healthchecksl4.go#L42
-	time.Sleep(time.Minute - timeSinceToBeDeletedTaintAdded(node, time.Now()))
+	logger := log.FromContext(ctx, "node", node.Name, "deletionMode", gcp.deletionMode)
+	err := gcp.annotateDeletionMode(ctx, node.Name)
+	if err != nil {
+		return err
+	}
+
+	if gcp.deletionMode == v1alpha1.GCPDeletionModeTaint {
+		// The Node has already been cordoned when it was drained so we only need to taint it
+		logger.Info("Tainting Node for removal by the cluster autoscaler")
+		err := kubernetes.AddTaint(ctx, gcp.clientset, node.Name, gcp.taint)
+		if err != nil {
+			return errors.Wrapf(err, "failed to add taint %s to Node %s", gcp.taint.Key, node.Name)
+		}
+		return nil
+	}
+
+	if gcp.nodePoolMinimumSizeCheck != nil {
+		reason, err := gcp.checkNodePoolMinimumSize(ctx, node)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			// Nodes in node pools at their minimum size are not selected for deletion when using the
+			// Refuse action so we only need to warn here
+			logger.Info("Deleting instance from node pool at its minimum size; the cluster autoscaler is expected to replace it with an on-demand instance", "reason", reason)
+		}
+	}
+
+	// The Node is tainted with ToBeDeletedByClusterAutoscaler before this function is called which
+	// causes it to start failing load balancer health checks so we measure the delay from then
+	select {
+	case <-time.After(gcp.loadBalancerDrainDelay - kubernetes.TimeSinceToBeDeletedTaintAdded(node, time.Now())):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 
 	// Retrieve instance details from the provider ID
 	project, zone, instanceName, err := parseProviderID(node.Spec.ProviderID)
@@ -69,32 +279,70 @@ func (gcp *CloudProvider) DeleteInstance(ctx context.Context, node *corev1.Node)
 	}
 
 	// Retrieve the compute instance corresponding to the Node
-	instance, err := gcp.computeService.Instances.Get(project, zone, instanceName).Do()
+	var instance *compute.Instance
+	err = gcp.retry(ctx, gcp.operationTimeout, func(ctx context.Context) error {
+		var err error
+		instance, err = gcp.computeService.Instances.Get(project, zone, instanceName).Context(ctx).Do()
+		return err
+	})
 	if err != nil {
 		return errors.Wrapf(err, "failed to get compute instance: %s/%s/%s", project, zone, instanceName)
 	}
 
 	// Determine the managed instance group that created the instance
-	managedInstanceGroupName, err := getManagedInstanceGroupFromInstance(instance)
+	managedInstanceGroup, err := getManagedInstanceGroupFromInstance(instance)
 	if err != nil {
 		return err
 	}
 
-	// Delete the instance from the managed instance group
-	instanceGroupManagedsDeleteInstancesRequest := &compute.InstanceGroupManagersDeleteInstancesRequest{
-		Instances: []string{instance.SelfLink},
-		// Do not error if the instance has already been deleted or is being deleted
-		SkipInstancesOnValidationError: true,
-	}
-	r, err := gcp.computeService.InstanceGroupManagers.DeleteInstances(project, zone, managedInstanceGroupName, instanceGroupManagedsDeleteInstancesRequest).Do()
-	if err != nil {
-		return errors.Wrap(err, "failed to delete managed instance")
+	if gcp.waitForBackendServiceHealth {
+		err = gcp.waitForInstanceToBeUnhealthy(ctx, project, managedInstanceGroup, instance)
+		if err != nil {
+			return errors.Wrap(err, "failed to wait for backend services to report instance as not healthy")
+		}
 	}
-	err = gcp.waitForZonalComputeOperation(project, zone, r.Name)
-	if err != nil {
-		return errors.Wrap(err, "failed to wait for compute operation to complete successfully")
+
+	// Delete the instance from the managed instance group
+	if managedInstanceGroup.regional {
+		regionInstanceGroupManagersDeleteInstancesRequest := &compute.RegionInstanceGroupManagersDeleteInstancesRequest{
+			Instances: []string{instance.SelfLink},
+			// Do not error if the instance has already been deleted or is being deleted
+			SkipInstancesOnValidationError: true,
+		}
+		var r *compute.Operation
+		err = gcp.retry(ctx, gcp.operationTimeout, func(ctx context.Context) error {
+			var err error
+			r, err = gcp.computeService.RegionInstanceGroupManagers.DeleteInstances(project, managedInstanceGroup.location, managedInstanceGroup.name, regionInstanceGroupManagersDeleteInstancesRequest).Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to delete managed instance")
+		}
+		err = gcp.waitForRegionalComputeOperation(ctx, project, managedInstanceGroup.location, r.Name)
+		if err != nil {
+			return errors.Wrap(err, "failed to wait for compute operation to complete successfully")
+		}
+	} else {
+		instanceGroupManagedsDeleteInstancesRequest := &compute.InstanceGroupManagersDeleteInstancesRequest{
+			Instances: []string{instance.SelfLink},
+			// Do not error if the instance has already been deleted or is being deleted
+			SkipInstancesOnValidationError: true,
+		}
+		var r *compute.Operation
+		err = gcp.retry(ctx, gcp.operationTimeout, func(ctx context.Context) error {
+			var err error
+			r, err = gcp.computeService.InstanceGroupManagers.DeleteInstances(project, managedInstanceGroup.location, managedInstanceGroup.name, instanceGroupManagedsDeleteInstancesRequest).Context(ctx).Do()
+			return err
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to delete managed instance")
+		}
+		err = gcp.waitForZonalComputeOperation(ctx, project, managedInstanceGroup.location, r.Name)
+		if err != nil {
+			return errors.Wrap(err, "failed to wait for compute operation to complete successfully")
+		}
 	}
-	err = gcp.waitForManagedInstanceGroupStability(project, zone, managedInstanceGroupName)
+	err = gcp.waitForManagedInstanceGroupStability(ctx, project, managedInstanceGroup)
 	if err != nil {
 		return errors.Wrap(err, "failed to wait for managed instance group stability")
 	}
@@ -102,6 +350,12 @@ func (gcp *CloudProvider) DeleteInstance(ctx context.Context, node *corev1.Node)
 	return nil
 }
 
+// RemovalDeferred returns true when using the Taint deletion mode since the removal of tainted
+// Nodes is left to the cluster autoscaler
+func (gcp *CloudProvider) RemovalDeferred() bool {
+	return gcp.deletionMode == v1alpha1.GCPDeletionModeTaint
+}
+
 // IsSpotInstance determines whether the underlying compute instance is a spot VM. We consider
 // preemptible VMs to be spot VMs to align with the cluster autoscaler:
 // https://github.com/kubernetes/autoscaler/blob/10fafe758c118adeb55b28718dc826511cc5ba40/cluster-autoscaler/cloudprovider/gce/gce_price_model.go#L220-L230
@@ -112,26 +366,12 @@ func (gcp *CloudProvider) IsSpotInstance(ctx context.Context, node *corev1.Node)
 	return node.Labels[spotNodeLabelKey] == "true" || node.Labels[preemptibleNodeLabelKey] == "true", nil
 }
 
-func timeSinceToBeDeletedTaintAdded(node *corev1.Node, now time.Time) time.Duration {
-	// Retrieve taint value
-	toBeDeletedTaintAddedValue := ""
-	for _, taint := range node.Spec.Taints {
-		if taint.Key == kubernetes.ToBeDeletedTaint && taint.Effect == corev1.TaintEffectNoSchedule {
-			toBeDeletedTaintAddedValue = taint.Value
-			break
-		}
-	}
-
-	// Attempt to parse taint value as Unix timestamp
-	unixTimeSeconds, err := strconv.ParseInt(toBeDeletedTaintAddedValue, 10, 64)
+// annotateDeletionMode annotates the Node with the deletion mode that is used to remove it
+func (gcp *CloudProvider) annotateDeletionMode(ctx context.Context, nodeName string) error {
+	patch := []byte(fmt.Sprintf(`{"metadata":{"annotations":{"%s":"%s"}}}`, deletionModeAnnotationKey, gcp.deletionMode))
+	_, err := gcp.clientset.CoreV1().Nodes().Patch(ctx, nodeName, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
 	if err != nil {
-		return 0
+		return errors.Wrapf(err, "failed to annotate Node %s with deletion mode", nodeName)
 	}
-
-	timeSinceToBeDeletedTaintAdded := now.Sub(time.Unix(unixTimeSeconds, 0))
-	// Ignore negative durations to avoid waiting for an unbounded amount of time
-	if timeSinceToBeDeletedTaintAdded < 0 {
-		return 0
-	}
-	return timeSinceToBeDeletedTaintAdded
+	return nil
 }
@@ -2,13 +2,28 @@ package gcp
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/gcp/fakecompute"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestIsSpotInstance(t *testing.T) {
@@ -83,52 +98,212 @@ func TestIsSpotInstance(t *testing.T) {
 	}
 }
 
-func TestTimeSinceToBeDeletedTaintAdded(t *testing.T) {
+func TestDeleteInstance(t *testing.T) {
+	const (
+		project  = "my-project"
+		zone     = "europe-west2-a"
+		region   = "europe-west2"
+		instance = "my-instance"
+	)
+	instancePath := fmt.Sprintf("projects/%s/zones/%s/instances/%s", project, zone, instance)
 	tests := map[string]struct {
-		node                           *corev1.Node
-		now                            time.Time
-		timeSinceToBeDeletedTaintAdded time.Duration
+		regional        bool
+		operationWaits  int
+		operationErrors []string
+		stabilityChecks int
+		errors          map[string]int
+		valid           bool
+		instanceDeleted bool
 	}{
-		"missingTaint": {
-			node:                           &corev1.Node{},
-			now:                            time.Now(),
-			timeSinceToBeDeletedTaintAdded: 0,
+		"zonal": {
+			valid:           true,
+			instanceDeleted: true,
 		},
-		"recentTaint": {
-			node: &corev1.Node{
-				Spec: corev1.NodeSpec{
-					Taints: []corev1.Taint{
-						{
-							Key:    "ToBeDeletedByClusterAutoscaler",
-							Value:  fmt.Sprint(time.Date(0, 0, 0, 0, 0, 0, 0, time.UTC).Unix()),
-							Effect: corev1.TaintEffectNoSchedule,
-						},
-					},
-				},
+		"regional": {
+			regional:        true,
+			valid:           true,
+			instanceDeleted: true,
+		},
+		"waitForOperationAndStability": {
+			operationWaits:  2,
+			stabilityChecks: 2,
+			valid:           true,
+			instanceDeleted: true,
+		},
+		"retryTransientErrors": {
+			errors: map[string]int{
+				"GET " + instancePath: http.StatusServiceUnavailable,
+				"POST projects/my-project/zones/europe-west2-a/instanceGroupManagers/my-managed-instance-group/deleteInstances": http.StatusTooManyRequests,
 			},
-			now:                            time.Date(0, 0, 0, 0, 1, 0, 0, time.UTC),
-			timeSinceToBeDeletedTaintAdded: time.Minute,
+			valid:           true,
+			instanceDeleted: true,
 		},
-		"futureTaint": {
-			node: &corev1.Node{
-				Spec: corev1.NodeSpec{
-					Taints: []corev1.Taint{
-						{
-							Key:    "ToBeDeletedByClusterAutoscaler",
-							Value:  fmt.Sprint(time.Date(0, 0, 0, 0, 1, 0, 0, time.UTC).Unix()),
-							Effect: corev1.TaintEffectNoSchedule,
-						},
-					},
-				},
+		"instanceNotFound": {
+			errors: map[string]int{
+				"GET " + instancePath: http.StatusNotFound,
 			},
-			now:                            time.Date(0, 0, 0, 0, 0, 0, 0, time.UTC),
-			timeSinceToBeDeletedTaintAdded: 0,
+			valid: false,
+		},
+		"deleteInstancesFailed": {
+			errors: map[string]int{
+				"POST projects/my-project/zones/europe-west2-a/instanceGroupManagers/my-managed-instance-group/deleteInstances": http.StatusBadRequest,
+			},
+			valid: false,
+		},
+		"operationFailed": {
+			operationErrors: []string{"failed"},
+			valid:           false,
+		},
+		// The instance is deleted but we fail to wait for the managed instance group to be stable
+		"managedInstanceGroupNotStable": {
+			stabilityChecks: 1000,
+			valid:           false,
+			instanceDeleted: true,
 		},
 	}
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
-			timeSinceToBeDeletedTaintAdded := timeSinceToBeDeletedTaintAdded(test.node, test.now)
-			require.Equal(t, test.timeSinceToBeDeletedTaintAdded, timeSinceToBeDeletedTaintAdded)
+			server := fakecompute.NewServer()
+			defer server.Close()
+			server.OperationWaits = test.operationWaits
+			server.OperationErrors = test.operationErrors
+			server.StabilityChecks = test.stabilityChecks
+			location := zone
+			if test.regional {
+				location = region
+			}
+			createdBy := server.AddManagedInstanceGroup(project, location, "my-managed-instance-group", test.regional)
+			server.AddInstance(project, zone, instance, createdBy)
+			for request, statusCode := range test.errors {
+				method, path, _ := strings.Cut(request, " ")
+				server.AddError(method, path, statusCode, 1)
+			}
+
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: instance,
+					Labels: map[string]string{
+						corev1.LabelTopologyZone: zone,
+					},
+				},
+				Spec: corev1.NodeSpec{
+					ProviderID: fmt.Sprintf("gce://%s/%s/%s", project, zone, instance),
+				},
+			}
+			clientset := fake.NewSimpleClientset(node)
+
+			gcp, err := newCloudProviderWithClientOptions(context.Background(), &v1alpha1.GCPCloudProvider{
+				OperationTimeout:                     &metav1.Duration{Duration: time.Second},
+				ManagedInstanceGroupStabilityTimeout: &metav1.Duration{Duration: 100 * time.Millisecond},
+				LoadBalancerDrainDelay:               &metav1.Duration{},
+				Endpoint:                             server.Endpoint(),
+			}, clientset, option.WithoutAuthentication())
+			require.Nil(t, err)
+			gcp.initialPollInterval = time.Millisecond
+			gcp.maxPollInterval = 10 * time.Millisecond
+			require.False(t, gcp.RemovalDeferred())
+
+			err = gcp.DeleteInstance(context.Background(), node)
+			if test.valid {
+				require.Nil(t, err)
+			} else {
+				require.NotNil(t, err)
+			}
+			require.Equal(t, !test.instanceDeleted, server.HasInstance(project, zone, instance))
+
+			// The Node should be annotated with the deletion mode
+			node, err = clientset.CoreV1().Nodes().Get(context.Background(), node.Name, metav1.GetOptions{})
+			require.Nil(t, err)
+			require.Equal(t, "DeleteInstance", node.Annotations[deletionModeAnnotationKey])
 		})
 	}
 }
+
+func TestDeleteInstanceTaintDeletionMode(t *testing.T) {
+	ctx := context.Background()
+	server := fakecompute.NewServer()
+	defer server.Close()
+	createdBy := server.AddManagedInstanceGroup("my-project", "my-zone", "my-managed-instance-group", false)
+	server.AddInstance("my-project", "my-zone", "my-instance", createdBy)
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "my-instance",
+		},
+		Spec: corev1.NodeSpec{
+			ProviderID: "gce://my-project/my-zone/my-instance",
+		},
+	}
+	clientset := fake.NewSimpleClientset(node)
+	gcp, err := newCloudProviderWithClientOptions(ctx, &v1alpha1.GCPCloudProvider{
+		DeletionMode: v1alpha1.GCPDeletionModeTaint,
+		Endpoint:     server.Endpoint(),
+	}, clientset, option.WithoutAuthentication())
+	require.Nil(t, err)
+	require.True(t, gcp.RemovalDeferred())
+
+	err = gcp.DeleteInstance(ctx, node)
+	require.Nil(t, err)
+
+	// The instance should be left for the cluster autoscaler to remove
+	require.True(t, server.HasInstance("my-project", "my-zone", "my-instance"))
+	require.Empty(t, server.Requests())
+
+	node, err = clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+	require.Nil(t, err)
+	require.Equal(t, "Taint", node.Annotations[deletionModeAnnotationKey])
+	require.Equal(t, []corev1.Taint{{Key: "cost-manager.io/delete", Effect: corev1.TaintEffectNoSchedule}}, node.Spec.Taints)
+}
+
+func TestNewCloudProviderClientOptions(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Token endpoint used by the service account credentials
+		if r.URL.Path == "/token" {
+			_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "token", "token_type": "Bearer", "expires_in": 3600})
+			return
+		}
+		header = r.Header.Clone()
+		_ = json.NewEncoder(w).Encode(&compute.Instance{Name: "my-instance"})
+	}))
+	defer server.Close()
+
+	// Generate service account credentials that use the server as the token endpoint
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.Nil(t, err)
+	credentials, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "my-project",
+		"private_key_id": "my-private-key",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyBytes})),
+		"client_email":   "cost-manager@my-project.iam.gserviceaccount.com",
+		"token_uri":      server.URL + "/token",
+	})
+	require.Nil(t, err)
+	credentialsFile := filepath.Join(t.TempDir(), "credentials.json")
+	err = os.WriteFile(credentialsFile, credentials, 0600)
+	require.Nil(t, err)
+
+	gcp, err := NewCloudProvider(context.Background(), &v1alpha1.GCPCloudProvider{
+		CredentialsFile: credentialsFile,
+		QuotaProject:    "my-quota-project",
+		Endpoint:        server.URL + "/compute/v1/",
+		UserAgent:       "cost-manager-test",
+	}, fake.NewSimpleClientset())
+	require.Nil(t, err)
+	_, err = gcp.computeService.Instances.Get("my-project", "my-zone", "my-instance").Do()
+	require.Nil(t, err)
+	require.Equal(t, "cost-manager-test", header.Get("User-Agent"))
+	require.Equal(t, "my-quota-project", header.Get("X-Goog-User-Project"))
+	require.True(t, strings.HasPrefix(header.Get("Authorization"), "Bearer "))
+
+	// Impersonation uses the credentials file as the source credentials
+	_, err = NewCloudProvider(context.Background(), &v1alpha1.GCPCloudProvider{
+		CredentialsFile:           credentialsFile,
+		ImpersonateServiceAccount: "other@my-project.iam.gserviceaccount.com",
+	}, fake.NewSimpleClientset())
+	require.Nil(t, err)
+}
@@ -1,72 +1,175 @@
 package gcp
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 const (
-	operationPollInterval = 10 * time.Second
+	defaultOperationTimeout                     = 10 * time.Minute
+	defaultManagedInstanceGroupStabilityTimeout = 10 * time.Minute
+
+	initialPollInterval = time.Second
+	maxPollInterval     = 30 * time.Second
 )
 
+// managedInstanceGroup identifies a zonal or regional managed instance group
+type managedInstanceGroup struct {
+	// regional is true if the managed instance group is regional rather than zonal
+	regional bool
+	// location is the zone or region of the managed instance group
+	location string
+	name     string
+}
+
 // getManagedInstanceGroupFromInstance determines the managed instance group that created the
 // instance; instances created by managed instance groups should have a metadata label with key
-// `created-by` and a value of the form:
-// projects/[PROJECT_ID]/zones/[ZONE]/instanceGroupManagers/[INSTANCE_GROUP_MANAGER_NAME]:
+// `created-by` and a value of the form
+// projects/[PROJECT_ID]/zones/[ZONE]/instanceGroupManagers/[INSTANCE_GROUP_MANAGER_NAME] for zonal
+// managed instance groups or
+// projects/[PROJECT_ID]/regions/[REGION]/instanceGroupManagers/[INSTANCE_GROUP_MANAGER_NAME] for
+// regional managed instance groups:
 // https://cloud.google.com/compute/docs/instance-groups/getting-info-about-migs#checking_if_a_vm_instance_is_part_of_a_mig
-func getManagedInstanceGroupFromInstance(instance *compute.Instance) (string, error) {
+func getManagedInstanceGroupFromInstance(instance *compute.Instance) (managedInstanceGroup, error) {
 	if instance.Metadata != nil {
 		for _, item := range instance.Metadata.Items {
 			if item != nil && item.Key == "created-by" && item.Value != nil {
 				createdBy := *item.Value
 				tokens := strings.Split(createdBy, "/")
-				if len(tokens) > 2 && tokens[len(tokens)-2] == "instanceGroupManagers" {
-					return tokens[len(tokens)-1], nil
+				if len(tokens) > 4 && tokens[len(tokens)-2] == "instanceGroupManagers" {
+					switch tokens[len(tokens)-4] {
+					case "zones":
+						return managedInstanceGroup{location: tokens[len(tokens)-3], name: tokens[len(tokens)-1]}, nil
+					case "regions":
+						return managedInstanceGroup{regional: true, location: tokens[len(tokens)-3], name: tokens[len(tokens)-1]}, nil
+					}
 				}
 			}
 		}
 	}
-	return "", fmt.Errorf("failed to determine managed instance group for instance %s", instance.Name)
+	return managedInstanceGroup{}, fmt.Errorf("failed to determine managed instance group for instance %s", instance.Name)
 }
 
-func (gcp *CloudProvider) waitForManagedInstanceGroupStability(project, zone, managedInstanceGroupName string) error {
-	for {
-		r, err := gcp.computeService.InstanceGroupManagers.Get(project, zone, managedInstanceGroupName).Do()
+func (gcp *CloudProvider) waitForManagedInstanceGroupStability(ctx context.Context, project string, managedInstanceGroup managedInstanceGroup) error {
+	return gcp.poll(ctx, gcp.managedInstanceGroupStabilityTimeout, func(ctx context.Context) (bool, error) {
+		var status *compute.InstanceGroupManagerStatus
+		if managedInstanceGroup.regional {
+			r, err := gcp.computeService.RegionInstanceGroupManagers.Get(project, managedInstanceGroup.location, managedInstanceGroup.name).Context(ctx).Do()
+			if err != nil {
+				return false, err
+			}
+			status = r.Status
+		} else {
+			r, err := gcp.computeService.InstanceGroupManagers.Get(project, managedInstanceGroup.location, managedInstanceGroup.name).Context(ctx).Do()
+			if err != nil {
+				return false, err
+			}
+			status = r.Status
+		}
+		return status != nil && status.IsStable, nil
+	})
+}
+
+// waitForZonalComputeOperation waits for a zonal compute operation to complete. The Wait method is
+// used which returns as soon as the operation is done or after approximately 2 minutes:
+// https://cloud.google.com/compute/docs/reference/rest/v1/zoneOperations/wait
+func (gcp *CloudProvider) waitForZonalComputeOperation(ctx context.Context, project, zone, operationName string) error {
+	return gcp.waitForComputeOperation(ctx, func(ctx context.Context) (*compute.Operation, error) {
+		return gcp.computeService.ZoneOperations.Wait(project, zone, operationName).Context(ctx).Do()
+	})
+}
+
+// waitForRegionalComputeOperation waits for a regional compute operation to complete using the
+// Wait method: https://cloud.google.com/compute/docs/reference/rest/v1/regionOperations/wait
+func (gcp *CloudProvider) waitForRegionalComputeOperation(ctx context.Context, project, region, operationName string) error {
+	return gcp.waitForComputeOperation(ctx, func(ctx context.Context) (*compute.Operation, error) {
+		return gcp.computeService.RegionOperations.Wait(project, region, operationName).Context(ctx).Do()
+	})
+}
+
+func (gcp *CloudProvider) waitForComputeOperation(ctx context.Context, waitForOperation func(ctx context.Context) (*compute.Operation, error)) error {
+	return gcp.poll(ctx, gcp.operationTimeout, func(ctx context.Context) (bool, error) {
+		operation, err := waitForOperation(ctx)
 		if err != nil {
-			return err
+			return false, err
 		}
-		if r.Status != nil && r.Status.IsStable {
-			return nil
+		if operation.Status != "DONE" {
+			return false, nil
 		}
-		time.Sleep(operationPollInterval)
-	}
+		if operation.Error != nil {
+			var operationErrorErrors []string
+			for _, operationErrorError := range operation.Error.Errors {
+				operationErrorErrors = append(operationErrorErrors, operationErrorError.Message)
+			}
+			return false, fmt.Errorf("compute operation failed with errors: %s", strings.Join(operationErrorErrors, ", "))
+		}
+		return true, nil
+	})
 }
 
-func (gcp *CloudProvider) waitForZonalComputeOperation(project, zone, operationName string) error {
-	return waitForComputeOperation(func() (*compute.Operation, error) {
-		return gcp.computeService.ZoneOperations.Get(project, zone, operationName).Do()
+// retry calls the function until it succeeds, retrying transient errors with exponential backoff
+func (gcp *CloudProvider) retry(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	return gcp.poll(ctx, timeout, func(ctx context.Context) (bool, error) {
+		err := fn(ctx)
+		if err != nil {
+			return false, err
+		}
+		return true, nil
 	})
 }
 
-func waitForComputeOperation(getOperation func() (*compute.Operation, error)) error {
+// poll calls the condition with exponential backoff until it returns true, it returns a
+// non-transient error or the timeout is reached. Transient errors (i.e. 429 and 5xx responses) are
+// retried
+func (gcp *CloudProvider) poll(ctx context.Context, timeout time.Duration, condition func(ctx context.Context) (bool, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	interval := gcp.initialPollInterval
 	for {
-		operation, err := getOperation()
+		done, err := condition(ctx)
 		if err != nil {
-			return err
-		}
-		if operation.Status == "DONE" {
-			if operation.Error != nil {
-				var operationErrorErrors []string
-				for _, operationErrorError := range operation.Error.Errors {
-					operationErrorErrors = append(operationErrorErrors, operationErrorError.Message)
-				}
-				return fmt.Errorf("compute operation failed with errors: %s", strings.Join(operationErrorErrors, ", "))
+			if !isTransientError(err) {
+				return err
 			}
+			// If the context has expired then the error was most likely caused by this so we
+			// return the context error to make this clear
+			if ctx.Err() != nil {
+				return errors.Wrap(ctx.Err(), err.Error())
+			}
+			log.FromContext(ctx).Info("Retrying transient compute API error", "error", err.Error())
+		} else if done {
 			return nil
 		}
-		time.Sleep(operationPollInterval)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait.Jitter(interval, 0.1)):
+		}
+		interval = min(2*interval, gcp.maxPollInterval)
+	}
+}
+
+// isTransientError determines whether an error returned by the compute API should be retried
+func isTransientError(err error) bool {
+	var googleapiError *googleapi.Error
+	if errors.As(err, &googleapiError) {
+		return googleapiError.Code == http.StatusTooManyRequests || googleapiError.Code >= http.StatusInternalServerError
 	}
+	return false
+}
+
+// lastURLSegment returns the last segment of a compute resource URL (e.g. the name of a zone)
+func lastURLSegment(url string) string {
+	return url[strings.LastIndex(url, "/")+1:]
 }
@@ -1,29 +1,201 @@
 package gcp
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 	"knative.dev/pkg/ptr"
 )
 
 func TestGetManagedInstanceGroupFromInstance(t *testing.T) {
-	instance := &compute.Instance{
-		Metadata: &compute.Metadata{
-			Items: []*compute.MetadataItems{
-				{
-					Key:   "instance-template",
-					Value: ptr.String("projects/my-project-number/global/instanceTemplates/my-instance-template"),
+	tests := map[string]struct {
+		createdBy            string
+		valid                bool
+		managedInstanceGroup managedInstanceGroup
+	}{
+		"zonal": {
+			createdBy: "projects/my-project-number/zones/my-zone/instanceGroupManagers/my-managed-instance-group",
+			valid:     true,
+			managedInstanceGroup: managedInstanceGroup{
+				location: "my-zone",
+				name:     "my-managed-instance-group",
+			},
+		},
+		"regional": {
+			createdBy: "projects/my-project-number/regions/my-region/instanceGroupManagers/my-managed-instance-group",
+			valid:     true,
+			managedInstanceGroup: managedInstanceGroup{
+				regional: true,
+				location: "my-region",
+				name:     "my-managed-instance-group",
+			},
+		},
+		"unknownLocationType": {
+			createdBy: "projects/my-project-number/global/instanceGroupManagers/my-managed-instance-group",
+			valid:     false,
+		},
+		"notCreatedByManagedInstanceGroup": {
+			createdBy: "projects/my-project-number/zones/my-zone/instances/my-instance",
+			valid:     false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			instance := &compute.Instance{
+				Metadata: &compute.Metadata{
+					Items: []*compute.MetadataItems{
+						{
+							Key:   "instance-template",
+							Value: ptr.String("projects/my-project-number/global/instanceTemplates/my-instance-template"),
+						},
+						{
+							Key:   "created-by",
+							Value: ptr.String(test.createdBy),
+						},
+					},
 				},
+			}
+			managedInstanceGroup, err := getManagedInstanceGroupFromInstance(instance)
+			if test.valid {
+				require.Nil(t, err)
+				require.Equal(t, test.managedInstanceGroup, managedInstanceGroup)
+			} else {
+				require.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func newTestCloudProvider() *CloudProvider {
+	return &CloudProvider{
+		operationTimeout:                     time.Second,
+		managedInstanceGroupStabilityTimeout: time.Second,
+		initialPollInterval:                  time.Millisecond,
+		maxPollInterval:                      10 * time.Millisecond,
+	}
+}
+
+func TestPoll(t *testing.T) {
+	tests := map[string]struct {
+		results []error
+		// done is the number of calls after which the condition returns true
+		done  int
+		valid bool
+	}{
+		"doneImmediately": {
+			done:  1,
+			valid: true,
+		},
+		"doneEventually": {
+			done:  3,
+			valid: true,
+		},
+		"retryTooManyRequests": {
+			results: []error{&googleapi.Error{Code: http.StatusTooManyRequests}},
+			done:    2,
+			valid:   true,
+		},
+		"retryServiceUnavailable": {
+			results: []error{&googleapi.Error{Code: http.StatusServiceUnavailable}, &googleapi.Error{Code: http.StatusInternalServerError}},
+			done:    3,
+			valid:   true,
+		},
+		"notFound": {
+			results: []error{&googleapi.Error{Code: http.StatusNotFound}},
+			done:    2,
+			valid:   false,
+		},
+		"otherError": {
+			results: []error{errors.New("failed")},
+			done:    2,
+			valid:   false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			err := newTestCloudProvider().poll(context.Background(), time.Second, func(ctx context.Context) (bool, error) {
+				calls++
+				if calls <= len(test.results) {
+					return false, test.results[calls-1]
+				}
+				return calls >= test.done, nil
+			})
+			if test.valid {
+				require.Nil(t, err)
+				require.Equal(t, test.done, calls)
+			} else {
+				require.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestPollTimeout(t *testing.T) {
+	err := newTestCloudProvider().poll(context.Background(), 50*time.Millisecond, func(ctx context.Context) (bool, error) {
+		return false, nil
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	err = newTestCloudProvider().poll(context.Background(), 50*time.Millisecond, func(ctx context.Context) (bool, error) {
+		return false, &googleapi.Error{Code: http.StatusServiceUnavailable}
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestPollContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := newTestCloudProvider().poll(ctx, time.Minute, func(ctx context.Context) (bool, error) {
+		return false, nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestWaitForComputeOperation(t *testing.T) {
+	tests := map[string]struct {
+		operations []*compute.Operation
+		valid      bool
+	}{
+		"done": {
+			operations: []*compute.Operation{
+				{Status: "RUNNING"},
+				{Status: "DONE"},
+			},
+			valid: true,
+		},
+		"failed": {
+			operations: []*compute.Operation{
 				{
-					Key:   "created-by",
-					Value: ptr.String("projects/my-project-number/zones/my-zone/instanceGroupManagers/my-managed-instance-group"),
+					Status: "DONE",
+					Error: &compute.OperationError{
+						Errors: []*compute.OperationErrorErrors{{Message: "failed"}},
+					},
 				},
 			},
+			valid: false,
 		},
 	}
-	managedInstanceGroupName, err := getManagedInstanceGroupFromInstance(instance)
-	require.Nil(t, err)
-	require.Equal(t, "my-managed-instance-group", managedInstanceGroupName)
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			err := newTestCloudProvider().waitForComputeOperation(context.Background(), func(ctx context.Context) (*compute.Operation, error) {
+				operation := test.operations[calls]
+				calls++
+				return operation, nil
+			})
+			if test.valid {
+				require.Nil(t, err)
+				require.Equal(t, len(test.operations), calls)
+			} else {
+				require.NotNil(t, err)
+			}
+		})
+	}
 }
@@ -0,0 +1,330 @@
+package fakecompute
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/compute/v1"
+)
+
+const (
+	basePath = "/compute/v1/"
+
+	operationStatusRunning = "RUNNING"
+	operationStatusDone    = "DONE"
+)
+
+// Server is a fake implementation of the subset of the GCP Compute API that is used by the gcp
+// cloud provider. It models instances, managed instance groups and operations and can be
+// configured to return error responses:
+// https://cloud.google.com/compute/docs/reference/rest/v1
+type Server struct {
+	*httptest.Server
+
+	// OperationWaits is the number of times that waiting for an operation returns before the
+	// operation is done
+	OperationWaits int
+	// OperationErrors are the errors that operations fail with when they are done; the instances
+	// are not deleted if an operation fails
+	OperationErrors []string
+	// StabilityChecks is the number of times that a managed instance group is reported as not
+	// stable after instances have been deleted from it
+	StabilityChecks int
+
+	mu                    sync.Mutex
+	instances             map[string]*compute.Instance
+	managedInstanceGroups map[string]*managedInstanceGroup
+	operations            map[string]*operation
+	errors                map[string]*injectedError
+	requests              []string
+}
+
+type managedInstanceGroup struct {
+	instanceGroupManager *compute.InstanceGroupManager
+	// stabilityChecks is the number of remaining times that the managed instance group will be
+	// reported as not stable
+	stabilityChecks int
+}
+
+type operation struct {
+	operation *compute.Operation
+	// instances are the instances that are deleted when the operation is done
+	instances            []string
+	managedInstanceGroup string
+	// waits is the number of remaining times that waiting for the operation will return before it
+	// is done
+	waits int
+}
+
+type injectedError struct {
+	statusCode int
+	// count is the number of remaining times that the error will be returned
+	count int
+}
+
+// NewServer starts a new fake Compute API server; the caller should call Close when finished
+func NewServer() *Server {
+	server := &Server{
+		instances:             map[string]*compute.Instance{},
+		managedInstanceGroups: map[string]*managedInstanceGroup{},
+		operations:            map[string]*operation{},
+		errors:                map[string]*injectedError{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+basePath+"projects/{project}/zones/{zone}/instances/{instance}", server.getInstance)
+	mux.HandleFunc("GET "+basePath+"projects/{project}/{locationType}/{location}/instanceGroupManagers/{instanceGroupManager}", server.getInstanceGroupManager)
+	mux.HandleFunc("POST "+basePath+"projects/{project}/{locationType}/{location}/instanceGroupManagers/{instanceGroupManager}/deleteInstances", server.deleteInstances)
+	mux.HandleFunc("POST "+basePath+"projects/{project}/{locationType}/{location}/operations/{operation}/wait", server.waitOperation)
+	mux.HandleFunc("GET "+basePath+"projects/{project}/aggregated/backendServices", server.listBackendServices)
+
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, basePath)
+		server.mu.Lock()
+		server.requests = append(server.requests, fmt.Sprintf("%s %s", r.Method, path))
+		injectedError, ok := server.errors[r.Method+" "+path]
+		if ok && injectedError.count > 0 {
+			injectedError.count--
+			server.mu.Unlock()
+			writeError(w, injectedError.statusCode, fmt.Sprintf("injected error for %s %s", r.Method, path))
+			return
+		}
+		server.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+
+	return server
+}
+
+// Endpoint returns the endpoint that should be used by compute API clients to send requests to
+// the server
+func (server *Server) Endpoint() string {
+	return server.URL + basePath
+}
+
+// AddManagedInstanceGroup adds a zonal or regional managed instance group. The location should be
+// a zone for zonal managed instance groups or a region for regional managed instance groups. The
+// returned value should be set as the created-by metadata of instances in the managed instance
+// group
+func (server *Server) AddManagedInstanceGroup(project, location, name string, regional bool) string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	locationType := "zones"
+	if regional {
+		locationType = "regions"
+	}
+	key := fmt.Sprintf("projects/%s/%s/%s/instanceGroupManagers/%s", project, locationType, location, name)
+	server.managedInstanceGroups[key] = &managedInstanceGroup{
+		instanceGroupManager: &compute.InstanceGroupManager{
+			Name:          name,
+			SelfLink:      server.Endpoint() + key,
+			InstanceGroup: fmt.Sprintf("%sprojects/%s/%s/%s/instanceGroups/%s", server.Endpoint(), project, locationType, location, name),
+			Status: &compute.InstanceGroupManagerStatus{
+				IsStable: true,
+			},
+		},
+	}
+	return key
+}
+
+// AddInstance adds an instance that was created by the managed instance group returned by
+// AddManagedInstanceGroup
+func (server *Server) AddInstance(project, zone, name, createdBy string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	key := fmt.Sprintf("projects/%s/zones/%s/instances/%s", project, zone, name)
+	server.instances[key] = &compute.Instance{
+		Name:     name,
+		SelfLink: server.Endpoint() + key,
+		Zone:     fmt.Sprintf("%sprojects/%s/zones/%s", server.Endpoint(), project, zone),
+		Metadata: &compute.Metadata{
+			Items: []*compute.MetadataItems{
+				{
+					Key:   "created-by",
+					Value: &createdBy,
+				},
+			},
+		},
+	}
+	if managedInstanceGroup, ok := server.managedInstanceGroups[createdBy]; ok {
+		managedInstanceGroup.instanceGroupManager.TargetSize++
+	}
+}
+
+// HasInstance determines whether the instance exists
+func (server *Server) HasInstance(project, zone, name string) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	_, ok := server.instances[fmt.Sprintf("projects/%s/zones/%s/instances/%s", project, zone, name)]
+	return ok
+}
+
+// AddError configures the server to respond to the next count requests with the method and path
+// (relative to the endpoint) with an error response with the status code
+func (server *Server) AddError(method, path string, statusCode, count int) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.errors[method+" "+path] = &injectedError{statusCode: statusCode, count: count}
+}
+
+// Requests returns the method and path (relative to the endpoint) of each request that has been
+// received by the server in order
+func (server *Server) Requests() []string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return append([]string{}, server.requests...)
+}
+
+func (server *Server) getInstance(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	instance, ok := server.instances[strings.TrimPrefix(r.URL.Path, basePath)]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("instance %s not found", r.PathValue("instance")))
+		return
+	}
+	writeJSON(w, instance)
+}
+
+func (server *Server) getInstanceGroupManager(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	managedInstanceGroup, ok := server.managedInstanceGroups[strings.TrimPrefix(r.URL.Path, basePath)]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("managed instance group %s not found", r.PathValue("instanceGroupManager")))
+		return
+	}
+	instanceGroupManager := *managedInstanceGroup.instanceGroupManager
+	if managedInstanceGroup.stabilityChecks > 0 {
+		managedInstanceGroup.stabilityChecks--
+		instanceGroupManager.Status = &compute.InstanceGroupManagerStatus{IsStable: false}
+	}
+	writeJSON(w, &instanceGroupManager)
+}
+
+// deleteInstances handles both zonal and regional requests; the request bodies have the same
+// fields that we care about
+func (server *Server) deleteInstances(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	key := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, basePath), "/deleteInstances")
+	if _, ok := server.managedInstanceGroups[key]; !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("managed instance group %s not found", r.PathValue("instanceGroupManager")))
+		return
+	}
+
+	request := &compute.InstanceGroupManagersDeleteInstancesRequest{}
+	err := json.NewDecoder(r.Body).Decode(request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	instances := []string{}
+	for _, instance := range request.Instances {
+		instanceKey := relativeResourceName(instance)
+		if _, ok := server.instances[instanceKey]; !ok {
+			if request.SkipInstancesOnValidationError {
+				continue
+			}
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("instance %s is not a member of managed instance group %s", instance, r.PathValue("instanceGroupManager")))
+			return
+		}
+		instances = append(instances, instanceKey)
+	}
+
+	operationName := fmt.Sprintf("operation-%d", len(server.operations))
+	locationKey := fmt.Sprintf("projects/%s/%s/%s", r.PathValue("project"), r.PathValue("locationType"), r.PathValue("location"))
+	server.operations[locationKey+"/operations/"+operationName] = &operation{
+		operation: &compute.Operation{
+			Name:          operationName,
+			OperationType: "deleteInstances",
+			Status:        operationStatusRunning,
+			TargetLink:    server.Endpoint() + key,
+		},
+		instances:            instances,
+		managedInstanceGroup: key,
+		waits:                server.OperationWaits,
+	}
+	writeJSON(w, server.operations[locationKey+"/operations/"+operationName].operation)
+}
+
+func (server *Server) waitOperation(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	operation, ok := server.operations[strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, basePath), "/wait")]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("operation %s not found", r.PathValue("operation")))
+		return
+	}
+	if operation.operation.Status == operationStatusDone {
+		writeJSON(w, operation.operation)
+		return
+	}
+	if operation.waits > 0 {
+		operation.waits--
+		writeJSON(w, operation.operation)
+		return
+	}
+
+	operation.operation.Status = operationStatusDone
+	if len(server.OperationErrors) > 0 {
+		operation.operation.Error = &compute.OperationError{}
+		for _, operationError := range server.OperationErrors {
+			operation.operation.Error.Errors = append(operation.operation.Error.Errors, &compute.OperationErrorErrors{Message: operationError})
+		}
+		writeJSON(w, operation.operation)
+		return
+	}
+	for _, instance := range operation.instances {
+		delete(server.instances, instance)
+	}
+	if managedInstanceGroup, ok := server.managedInstanceGroups[operation.managedInstanceGroup]; ok {
+		managedInstanceGroup.instanceGroupManager.TargetSize -= int64(len(operation.instances))
+		managedInstanceGroup.stabilityChecks = server.StabilityChecks
+	}
+	writeJSON(w, operation.operation)
+}
+
+// listBackendServices always returns an empty list since load balancers are not modelled
+func (server *Server) listBackendServices(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, &compute.BackendServiceAggregatedList{})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response in the format expected by googleapi.CheckResponse
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"code":    statusCode,
+			"message": message,
+		},
+	})
+}
+
+// relativeResourceName converts a full compute resource URL to a relative resource name (e.g.
+// projects/my-project/zones/my-zone/instances/my-instance)
+func relativeResourceName(url string) string {
+	if i := strings.Index(url, "projects/"); i >= 0 {
+		return url[i:]
+	}
+	return url
+}
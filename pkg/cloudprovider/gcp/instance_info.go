@@ -0,0 +1,103 @@
+package gcp
+
+import (
+	"context"
+	"time"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/instanceinfo"
+	"github.com/pkg/errors"
+	"google.golang.org/api/compute/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Instance information rarely changes so we cache it for long enough to avoid calling the
+	// Compute API for every Node on every spot-migrator iteration
+	instanceInfoCacheTTL = time.Hour
+)
+
+// GetInstanceInfo returns information about the underlying compute instance of the Node; the
+// information is cached to reduce calls to the Compute API
+func (gcp *CloudProvider) GetInstanceInfo(ctx context.Context, node *corev1.Node) (*instanceinfo.InstanceInfo, error) {
+	return gcp.instanceInfoCache.Get(ctx, node)
+}
+
+func (gcp *CloudProvider) getInstanceInfo(ctx context.Context, node *corev1.Node) (*instanceinfo.InstanceInfo, error) {
+	project, zone, instanceName, err := parseProviderID(node.Spec.ProviderID)
+	if err != nil {
+		return nil, err
+	}
+	var instance *compute.Instance
+	err = gcp.retry(ctx, gcp.operationTimeout, func(ctx context.Context) error {
+		var err error
+		instance, err = gcp.computeService.Instances.Get(project, zone, instanceName).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get compute instance: %s/%s/%s", project, zone, instanceName)
+	}
+	return newInstanceInfo(node, instance, gcp.instancePrices)
+}
+
+// newInstanceInfo converts a compute instance into InstanceInfo. The node group is the GKE node
+// pool of the Node or otherwise the managed instance group of the instance
+func newInstanceInfo(node *corev1.Node, instance *compute.Instance, instancePrices []v1alpha1.InstancePrice) (*instanceinfo.InstanceInfo, error) {
+	instanceInfo := &instanceinfo.InstanceInfo{
+		MachineType:       lastURLSegment(instance.MachineType),
+		Zone:              lastURLSegment(instance.Zone),
+		ProvisioningModel: getProvisioningModel(instance),
+	}
+
+	if nodePoolName, ok := node.Labels[nodePoolLabelKey]; ok {
+		instanceInfo.NodeGroup = nodePoolName
+	} else if managedInstanceGroup, err := getManagedInstanceGroupFromInstance(instance); err == nil {
+		instanceInfo.NodeGroup = managedInstanceGroup.name
+	}
+
+	if instance.CreationTimestamp != "" {
+		creationTime, err := time.Parse(time.RFC3339, instance.CreationTimestamp)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse creation timestamp of instance %s", instance.Name)
+		}
+		instanceInfo.CreationTime = creationTime
+	}
+
+	instanceInfo.HourlyPrice = getHourlyPrice(instancePrices, instanceInfo.MachineType, instanceInfo.ProvisioningModel)
+
+	return instanceInfo, nil
+}
+
+// getProvisioningModel returns the provisioning model of the instance; preemptible instances do
+// not have a provisioning model set so we return PREEMPTIBLE for these
+func getProvisioningModel(instance *compute.Instance) string {
+	if instance.Scheduling == nil {
+		return instanceinfo.ProvisioningModelStandard
+	}
+	if instance.Scheduling.ProvisioningModel != "" {
+		return instance.Scheduling.ProvisioningModel
+	}
+	if instance.Scheduling.Preemptible {
+		return instanceinfo.ProvisioningModelPreemptible
+	}
+	return instanceinfo.ProvisioningModelStandard
+}
+
+// getHourlyPrice returns the configured hourly price for the machine type and provisioning model
+// preferring prices that specify the provisioning model
+func getHourlyPrice(instancePrices []v1alpha1.InstancePrice, machineType, provisioningModel string) *float64 {
+	var hourlyPrice *float64
+	for _, instancePrice := range instancePrices {
+		if instancePrice.MachineType != machineType {
+			continue
+		}
+		price := instancePrice.HourlyPrice
+		if instancePrice.ProvisioningModel == provisioningModel {
+			return &price
+		}
+		if instancePrice.ProvisioningModel == "" {
+			hourlyPrice = &price
+		}
+	}
+	return hourlyPrice
+}
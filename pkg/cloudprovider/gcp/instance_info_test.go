@@ -0,0 +1,98 @@
+package gcp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/instanceinfo"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/ptr"
+)
+
+func TestNewInstanceInfo(t *testing.T) {
+	instancePrices := []v1alpha1.InstancePrice{
+		{MachineType: "n2-standard-4", HourlyPrice: 0.2},
+		{MachineType: "n2-standard-4", ProvisioningModel: "SPOT", HourlyPrice: 0.05},
+	}
+	instance := &compute.Instance{
+		Name:              "my-instance",
+		MachineType:       "https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west2-a/machineTypes/n2-standard-4",
+		Zone:              "https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west2-a",
+		CreationTimestamp: "2024-01-02T03:04:05.678-08:00",
+		Metadata: &compute.Metadata{
+			Items: []*compute.MetadataItems{
+				{
+					Key:   "created-by",
+					Value: ptr.String("projects/my-project-number/zones/europe-west2-a/instanceGroupManagers/my-managed-instance-group"),
+				},
+			},
+		},
+	}
+	tests := map[string]struct {
+		nodeLabels   map[string]string
+		scheduling   *compute.Scheduling
+		instanceInfo *instanceinfo.InstanceInfo
+	}{
+		"standard": {
+			nodeLabels: map[string]string{"cloud.google.com/gke-nodepool": "my-node-pool"},
+			scheduling: &compute.Scheduling{ProvisioningModel: "STANDARD"},
+			instanceInfo: &instanceinfo.InstanceInfo{
+				MachineType:       "n2-standard-4",
+				Zone:              "europe-west2-a",
+				NodeGroup:         "my-node-pool",
+				ProvisioningModel: "STANDARD",
+				CreationTime:      time.Date(2024, 1, 2, 11, 4, 5, 678000000, time.UTC),
+				HourlyPrice:       ptr.Float64(0.2),
+			},
+		},
+		"spot": {
+			nodeLabels: map[string]string{"cloud.google.com/gke-nodepool": "my-node-pool"},
+			scheduling: &compute.Scheduling{ProvisioningModel: "SPOT"},
+			instanceInfo: &instanceinfo.InstanceInfo{
+				MachineType:       "n2-standard-4",
+				Zone:              "europe-west2-a",
+				NodeGroup:         "my-node-pool",
+				ProvisioningModel: "SPOT",
+				CreationTime:      time.Date(2024, 1, 2, 11, 4, 5, 678000000, time.UTC),
+				HourlyPrice:       ptr.Float64(0.05),
+			},
+		},
+		"preemptibleWithoutNodePool": {
+			scheduling: &compute.Scheduling{Preemptible: true},
+			instanceInfo: &instanceinfo.InstanceInfo{
+				MachineType:       "n2-standard-4",
+				Zone:              "europe-west2-a",
+				NodeGroup:         "my-managed-instance-group",
+				ProvisioningModel: "PREEMPTIBLE",
+				CreationTime:      time.Date(2024, 1, 2, 11, 4, 5, 678000000, time.UTC),
+				HourlyPrice:       ptr.Float64(0.2),
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: test.nodeLabels}}
+			instance := *instance
+			instance.Scheduling = test.scheduling
+			instanceInfo, err := newInstanceInfo(node, &instance, instancePrices)
+			require.Nil(t, err)
+			require.True(t, test.instanceInfo.CreationTime.Equal(instanceInfo.CreationTime))
+			instanceInfo.CreationTime = test.instanceInfo.CreationTime
+			require.Equal(t, test.instanceInfo, instanceInfo)
+		})
+	}
+}
+
+func TestGetHourlyPrice(t *testing.T) {
+	instancePrices := []v1alpha1.InstancePrice{
+		{MachineType: "n2-standard-4", ProvisioningModel: "SPOT", HourlyPrice: 0.05},
+		{MachineType: "n2-standard-4", HourlyPrice: 0.2},
+	}
+	require.Equal(t, ptr.Float64(0.05), getHourlyPrice(instancePrices, "n2-standard-4", "SPOT"))
+	require.Equal(t, ptr.Float64(0.2), getHourlyPrice(instancePrices, "n2-standard-4", "STANDARD"))
+	require.Nil(t, getHourlyPrice(instancePrices, "e2-standard-4", "STANDARD"))
+}
@@ -0,0 +1,91 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/pkg/errors"
+	"google.golang.org/api/container/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+type nodePoolMinimumSizeCheck struct {
+	containerService *container.Service
+	cluster          string
+	action           v1alpha1.GKENodePoolMinimumSizeAction
+}
+
+// CanDisruptNode prevents Nodes from being selected for deletion if their node pool is at its
+// minimum size when the node pool minimum size check is configured to refuse deletion
+func (gcp *CloudProvider) CanDisruptNode(ctx context.Context, node *corev1.Node) (bool, error) {
+	if gcp.deletionMode != v1alpha1.GCPDeletionModeDeleteInstance ||
+		gcp.nodePoolMinimumSizeCheck == nil ||
+		gcp.nodePoolMinimumSizeCheck.action != v1alpha1.GKENodePoolMinimumSizeActionRefuse {
+		return true, nil
+	}
+	reason, err := gcp.checkNodePoolMinimumSize(ctx, node)
+	if err != nil {
+		return false, err
+	}
+	if reason != "" {
+		log.FromContext(ctx).Info("Node cannot be deleted since its node pool is at its minimum size", "node", node.Name, "reason", reason)
+		return false, nil
+	}
+	return true, nil
+}
+
+// checkNodePoolMinimumSize uses the GKE API to return a non-empty reason if the node pool of the
+// Node is at the minimum size of the cluster autoscaler
+func (gcp *CloudProvider) checkNodePoolMinimumSize(ctx context.Context, node *corev1.Node) (string, error) {
+	nodePoolName, ok := node.Labels[nodePoolLabelKey]
+	if !ok {
+		return "", fmt.Errorf("failed to determine node pool for Node %s", node.Name)
+	}
+	var nodePool *container.NodePool
+	err := gcp.retry(ctx, gcp.operationTimeout, func(ctx context.Context) error {
+		var err error
+		nodePool, err = gcp.nodePoolMinimumSizeCheck.containerService.Projects.Locations.Clusters.NodePools.Get(fmt.Sprintf("%s/nodePools/%s", gcp.nodePoolMinimumSizeCheck.cluster, nodePoolName)).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get node pool %s", nodePoolName)
+	}
+	nodeList, err := gcp.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", nodePoolLabelKey, nodePoolName),
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to list Nodes in node pool %s", nodePoolName)
+	}
+	return checkNodePoolMinimumSize(nodePool, node, nodeList.Items), nil
+}
+
+// checkNodePoolMinimumSize returns a non-empty reason if removing the Node would reduce the node
+// pool below the minimum size of the cluster autoscaler. Note that minNodeCount is per zone whereas
+// totalMinNodeCount is for the node pool as a whole:
+// https://cloud.google.com/kubernetes-engine/docs/reference/rest/v1/projects.locations.clusters.nodePools#nodepoolautoscaling
+func checkNodePoolMinimumSize(nodePool *container.NodePool, node *corev1.Node, nodePoolNodes []corev1.Node) string {
+	// If autoscaling is disabled then the cluster autoscaler will not scale the node pool back up
+	if nodePool.Autoscaling == nil || !nodePool.Autoscaling.Enabled {
+		return ""
+	}
+	if nodePool.Autoscaling.TotalMinNodeCount > 0 {
+		if int64(len(nodePoolNodes)) <= nodePool.Autoscaling.TotalMinNodeCount {
+			return fmt.Sprintf("node pool %s has %d Nodes and a minimum size of %d", nodePool.Name, len(nodePoolNodes), nodePool.Autoscaling.TotalMinNodeCount)
+		}
+		return ""
+	}
+	zone := node.Labels[corev1.LabelTopologyZone]
+	var zoneNodeCount int64
+	for _, nodePoolNode := range nodePoolNodes {
+		if nodePoolNode.Labels[corev1.LabelTopologyZone] == zone {
+			zoneNodeCount++
+		}
+	}
+	if zoneNodeCount <= nodePool.Autoscaling.MinNodeCount {
+		return fmt.Sprintf("node pool %s has %d Nodes in zone %s and a minimum size of %d per zone", nodePool.Name, zoneNodeCount, zone, nodePool.Autoscaling.MinNodeCount)
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/option"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newZonalNodePoolNode(name, nodePoolName, zone string) *corev1.Node {
+	node := newNodePoolNode(name, nodePoolName)
+	node.Labels[corev1.LabelTopologyZone] = zone
+	return node
+}
+
+func TestCheckNodePoolMinimumSize(t *testing.T) {
+	tests := map[string]struct {
+		autoscaling *container.NodePoolAutoscaling
+		nodes       []*corev1.Node
+		atMinimum   bool
+	}{
+		"autoscalingDisabled": {
+			nodes: []*corev1.Node{
+				newZonalNodePoolNode("a", "on-demand", "europe-west2-a"),
+			},
+			atMinimum: false,
+		},
+		"aboveMinimumPerZone": {
+			autoscaling: &container.NodePoolAutoscaling{Enabled: true, MinNodeCount: 1},
+			nodes: []*corev1.Node{
+				newZonalNodePoolNode("a", "on-demand", "europe-west2-a"),
+				newZonalNodePoolNode("b", "on-demand", "europe-west2-a"),
+			},
+			atMinimum: false,
+		},
+		"atMinimumPerZone": {
+			autoscaling: &container.NodePoolAutoscaling{Enabled: true, MinNodeCount: 1},
+			nodes: []*corev1.Node{
+				newZonalNodePoolNode("a", "on-demand", "europe-west2-a"),
+				newZonalNodePoolNode("b", "on-demand", "europe-west2-b"),
+			},
+			atMinimum: true,
+		},
+		"aboveTotalMinimum": {
+			autoscaling: &container.NodePoolAutoscaling{Enabled: true, TotalMinNodeCount: 1},
+			nodes: []*corev1.Node{
+				newZonalNodePoolNode("a", "on-demand", "europe-west2-a"),
+				newZonalNodePoolNode("b", "on-demand", "europe-west2-b"),
+			},
+			atMinimum: false,
+		},
+		"atTotalMinimum": {
+			autoscaling: &container.NodePoolAutoscaling{Enabled: true, TotalMinNodeCount: 2},
+			nodes: []*corev1.Node{
+				newZonalNodePoolNode("a", "on-demand", "europe-west2-a"),
+				newZonalNodePoolNode("b", "on-demand", "europe-west2-b"),
+			},
+			atMinimum: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			nodePool := &container.NodePool{
+				Name:        "on-demand",
+				Autoscaling: test.autoscaling,
+			}
+			var nodePoolNodes []corev1.Node
+			for _, node := range test.nodes {
+				nodePoolNodes = append(nodePoolNodes, *node)
+			}
+			reason := checkNodePoolMinimumSize(nodePool, test.nodes[0], nodePoolNodes)
+			if test.atMinimum {
+				require.NotEmpty(t, reason)
+			} else {
+				require.Empty(t, reason)
+			}
+		})
+	}
+}
+
+func TestCanDisruptNode(t *testing.T) {
+	ctx := context.Background()
+	cluster := "projects/my-project/locations/europe-west2/clusters/my-cluster"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/"+cluster+"/nodePools/on-demand" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&container.NodePool{
+			Name:        "on-demand",
+			Autoscaling: &container.NodePoolAutoscaling{Enabled: true, TotalMinNodeCount: 1},
+		})
+	}))
+	defer server.Close()
+
+	node := newZonalNodePoolNode("a", "on-demand", "europe-west2-a")
+	clientset := fake.NewSimpleClientset(node)
+	newCloudProvider := func(action v1alpha1.GKENodePoolMinimumSizeAction) *CloudProvider {
+		gcp, err := newCloudProviderWithClientOptions(ctx, &v1alpha1.GCPCloudProvider{
+			NodePoolMinimumSizeCheck: &v1alpha1.GKENodePoolMinimumSizeCheck{
+				Action:   action,
+				Cluster:  cluster,
+				Endpoint: server.URL,
+			},
+		}, clientset, option.WithoutAuthentication())
+		require.Nil(t, err)
+		return gcp
+	}
+
+	// The node pool is at its minimum size so the Node cannot be disrupted
+	canDisruptNode, err := newCloudProvider(v1alpha1.GKENodePoolMinimumSizeActionRefuse).CanDisruptNode(ctx, node)
+	require.Nil(t, err)
+	require.False(t, canDisruptNode)
+
+	// The Node can be disrupted when only warning
+	canDisruptNode, err = newCloudProvider(v1alpha1.GKENodePoolMinimumSizeActionWarn).CanDisruptNode(ctx, node)
+	require.Nil(t, err)
+	require.True(t, canDisruptNode)
+
+	// The Node can be disrupted once the node pool is above its minimum size
+	_, err = clientset.CoreV1().Nodes().Create(ctx, newZonalNodePoolNode("b", "on-demand", "europe-west2-b"), metav1.CreateOptions{})
+	require.Nil(t, err)
+	canDisruptNode, err = newCloudProvider(v1alpha1.GKENodePoolMinimumSizeActionRefuse).CanDisruptNode(ctx, node)
+	require.Nil(t, err)
+	require.True(t, canDisruptNode)
+}
@@ -0,0 +1,168 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/compute/metadata"
+	"github.com/pkg/errors"
+	"google.golang.org/api/container/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// https://cloud.google.com/kubernetes-engine/docs/how-to/node-pools#view_node_pools
+	nodePoolLabelKey = "cloud.google.com/gke-nodepool"
+)
+
+// getClusterFromMetadataServer determines the full resource name of the GKE cluster using the
+// cluster-name and cluster-location instance attributes set by GKE on each Node
+func getClusterFromMetadataServer() (string, error) {
+	project, err := metadata.ProjectID()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to determine project from metadata server")
+	}
+	location, err := metadata.InstanceAttributeValue("cluster-location")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to determine cluster location from metadata server")
+	}
+	name, err := metadata.InstanceAttributeValue("cluster-name")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to determine cluster name from metadata server")
+	}
+	return fmt.Sprintf("projects/%s/locations/%s/clusters/%s", project, location, name), nil
+}
+
+// PreflightCheck uses the GKE API to check that the node pool of each on-demand Node has a
+// corresponding spot node pool that workloads can be migrated to; if the check is not enabled then
+// it always passes
+func (gcp *CloudProvider) PreflightCheck(ctx context.Context, onDemandNodes, spotNodes []*corev1.Node) (string, error) {
+	if gcp.containerService == nil {
+		return "", nil
+	}
+	var nodePools []*container.NodePool
+	err := gcp.retry(ctx, gcp.operationTimeout, func(ctx context.Context) error {
+		r, err := gcp.containerService.Projects.Locations.Clusters.NodePools.List(gcp.cluster).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+		nodePools = r.NodePools
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to list node pools for cluster %s", gcp.cluster)
+	}
+	return checkSpotNodePools(nodePools, onDemandNodes, spotNodes), nil
+}
+
+// checkSpotNodePools returns a non-empty reason if the node pool of any of the on-demand Nodes does
+// not have a spot node pool with autoscaling enabled and headroom to scale up that can satisfy the
+// same labels and taints
+func checkSpotNodePools(nodePools []*container.NodePool, onDemandNodes, spotNodes []*corev1.Node) string {
+	nodePoolsByName := map[string]*container.NodePool{}
+	for _, nodePool := range nodePools {
+		nodePoolsByName[nodePool.Name] = nodePool
+	}
+	nodeCounts := map[string]int64{}
+	for _, node := range append(append([]*corev1.Node{}, onDemandNodes...), spotNodes...) {
+		nodeCounts[node.Labels[nodePoolLabelKey]]++
+	}
+
+	// Find the spot node pools that can currently scale up
+	var spotNodePools []*container.NodePool
+	for _, nodePool := range nodePools {
+		if isSpotNodePool(nodePool) && nodeCounts[nodePool.Name] < maxNodeCount(nodePool) {
+			spotNodePools = append(spotNodePools, nodePool)
+		}
+	}
+
+	// Determine the node pools of the on-demand Nodes, sorting them so that the reason is
+	// deterministic
+	onDemandNodePoolNames := []string{}
+	for _, node := range onDemandNodes {
+		nodePoolName, ok := node.Labels[nodePoolLabelKey]
+		if !ok {
+			return fmt.Sprintf("failed to determine node pool for Node %s", node.Name)
+		}
+		if _, ok := nodePoolsByName[nodePoolName]; !ok {
+			return fmt.Sprintf("node pool %s of Node %s does not exist", nodePoolName, node.Name)
+		}
+		onDemandNodePoolNames = append(onDemandNodePoolNames, nodePoolName)
+	}
+	sort.Strings(onDemandNodePoolNames)
+
+	for _, onDemandNodePoolName := range onDemandNodePoolNames {
+		onDemandNodePool := nodePoolsByName[onDemandNodePoolName]
+		satisfied := false
+		for _, spotNodePool := range spotNodePools {
+			if canSatisfy(spotNodePool, onDemandNodePool) {
+				satisfied = true
+				break
+			}
+		}
+		if !satisfied {
+			return fmt.Sprintf("no spot node pool with autoscaling headroom can satisfy the labels and taints of on-demand node pool %s", onDemandNodePoolName)
+		}
+	}
+
+	return ""
+}
+
+// isSpotNodePool determines whether the node pool creates spot VMs; we consider preemptible VMs to
+// be spot VMs to align with IsSpotInstance
+func isSpotNodePool(nodePool *container.NodePool) bool {
+	return nodePool.Config != nil && (nodePool.Config.Spot || nodePool.Config.Preemptible)
+}
+
+// maxNodeCount returns the maximum number of Nodes that the cluster autoscaler can scale the node
+// pool up to or 0 if autoscaling is disabled. Note that maxNodeCount is per zone whereas
+// totalMaxNodeCount is for the node pool as a whole:
+// https://cloud.google.com/kubernetes-engine/docs/reference/rest/v1/projects.locations.clusters.nodePools#nodepoolautoscaling
+func maxNodeCount(nodePool *container.NodePool) int64 {
+	if nodePool.Autoscaling == nil || !nodePool.Autoscaling.Enabled {
+		return 0
+	}
+	if nodePool.Autoscaling.TotalMaxNodeCount > 0 {
+		return nodePool.Autoscaling.TotalMaxNodeCount
+	}
+	return nodePool.Autoscaling.MaxNodeCount * max(int64(len(nodePool.Locations)), 1)
+}
+
+// canSatisfy determines whether Pods scheduled to the on-demand node pool can also be scheduled to
+// the spot node pool; the spot node pool must have all labels of the on-demand node pool and must
+// not have any taints that the on-demand node pool does not have
+func canSatisfy(spotNodePool, onDemandNodePool *container.NodePool) bool {
+	var spotLabels, onDemandLabels map[string]string
+	var spotTaints, onDemandTaints []*container.NodeTaint
+	if spotNodePool.Config != nil {
+		spotLabels = spotNodePool.Config.Labels
+		spotTaints = spotNodePool.Config.Taints
+	}
+	if onDemandNodePool.Config != nil {
+		onDemandLabels = onDemandNodePool.Config.Labels
+		onDemandTaints = onDemandNodePool.Config.Taints
+	}
+
+	for key, value := range onDemandLabels {
+		spotValue, ok := spotLabels[key]
+		if !ok || spotValue != value {
+			return false
+		}
+	}
+
+	for _, spotTaint := range spotTaints {
+		tolerated := false
+		for _, onDemandTaint := range onDemandTaints {
+			if spotTaint.Key == onDemandTaint.Key && spotTaint.Value == onDemandTaint.Value && spotTaint.Effect == onDemandTaint.Effect {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+
+	return true
+}
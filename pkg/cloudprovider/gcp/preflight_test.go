@@ -0,0 +1,210 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/option"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newNodePool(name string, spot bool, maxNodeCount int64, labels map[string]string, taints ...*container.NodeTaint) *container.NodePool {
+	nodePool := &container.NodePool{
+		Name: name,
+		Config: &container.NodeConfig{
+			Spot:   spot,
+			Labels: labels,
+			Taints: taints,
+		},
+		Locations: []string{"europe-west2-a"},
+	}
+	if maxNodeCount > 0 {
+		nodePool.Autoscaling = &container.NodePoolAutoscaling{
+			Enabled:      true,
+			MaxNodeCount: maxNodeCount,
+		}
+	}
+	return nodePool
+}
+
+func newNodePoolNode(name, nodePoolName string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"cloud.google.com/gke-nodepool": nodePoolName,
+			},
+		},
+	}
+}
+
+func TestCheckSpotNodePools(t *testing.T) {
+	tests := map[string]struct {
+		nodePools     []*container.NodePool
+		onDemandNodes []*corev1.Node
+		spotNodes     []*corev1.Node
+		passed        bool
+	}{
+		"spotNodePoolWithHeadroom": {
+			nodePools: []*container.NodePool{
+				newNodePool("on-demand", false, 0, nil),
+				newNodePool("spot", true, 3, nil),
+			},
+			onDemandNodes: []*corev1.Node{newNodePoolNode("a", "on-demand")},
+			spotNodes:     []*corev1.Node{newNodePoolNode("b", "spot")},
+			passed:        true,
+		},
+		"spotNodePoolAtMaximumSize": {
+			nodePools: []*container.NodePool{
+				newNodePool("on-demand", false, 0, nil),
+				newNodePool("spot", true, 1, nil),
+			},
+			onDemandNodes: []*corev1.Node{newNodePoolNode("a", "on-demand")},
+			spotNodes:     []*corev1.Node{newNodePoolNode("b", "spot")},
+			passed:        false,
+		},
+		"spotNodePoolWithTotalMaxNodeCount": {
+			nodePools: []*container.NodePool{
+				newNodePool("on-demand", false, 0, nil),
+				{
+					Name:        "spot",
+					Config:      &container.NodeConfig{Spot: true},
+					Autoscaling: &container.NodePoolAutoscaling{Enabled: true, TotalMaxNodeCount: 2},
+				},
+			},
+			onDemandNodes: []*corev1.Node{newNodePoolNode("a", "on-demand")},
+			spotNodes:     []*corev1.Node{newNodePoolNode("b", "spot")},
+			passed:        true,
+		},
+		"spotNodePoolWithoutAutoscaling": {
+			nodePools: []*container.NodePool{
+				newNodePool("on-demand", false, 0, nil),
+				newNodePool("spot", true, 0, nil),
+			},
+			onDemandNodes: []*corev1.Node{newNodePoolNode("a", "on-demand")},
+			passed:        false,
+		},
+		"preemptibleNodePool": {
+			nodePools: []*container.NodePool{
+				newNodePool("on-demand", false, 0, nil),
+				{
+					Name:        "preemptible",
+					Config:      &container.NodeConfig{Preemptible: true},
+					Autoscaling: &container.NodePoolAutoscaling{Enabled: true, MaxNodeCount: 1},
+				},
+			},
+			onDemandNodes: []*corev1.Node{newNodePoolNode("a", "on-demand")},
+			passed:        true,
+		},
+		"noSpotNodePool": {
+			nodePools: []*container.NodePool{
+				newNodePool("on-demand", false, 3, nil),
+			},
+			onDemandNodes: []*corev1.Node{newNodePoolNode("a", "on-demand")},
+			passed:        false,
+		},
+		"spotNodePoolWithMatchingLabelsAndTaints": {
+			nodePools: []*container.NodePool{
+				newNodePool("on-demand", false, 0, map[string]string{"workload": "batch"}, &container.NodeTaint{Key: "batch", Value: "true", Effect: "NO_SCHEDULE"}),
+				newNodePool("spot", true, 3, map[string]string{"workload": "batch", "spot": "true"}, &container.NodeTaint{Key: "batch", Value: "true", Effect: "NO_SCHEDULE"}),
+			},
+			onDemandNodes: []*corev1.Node{newNodePoolNode("a", "on-demand")},
+			passed:        true,
+		},
+		"spotNodePoolMissingLabel": {
+			nodePools: []*container.NodePool{
+				newNodePool("on-demand", false, 0, map[string]string{"workload": "batch"}),
+				newNodePool("spot", true, 3, map[string]string{"workload": "web"}),
+			},
+			onDemandNodes: []*corev1.Node{newNodePoolNode("a", "on-demand")},
+			passed:        false,
+		},
+		"spotNodePoolWithAdditionalTaint": {
+			nodePools: []*container.NodePool{
+				newNodePool("on-demand", false, 0, nil),
+				newNodePool("spot", true, 3, nil, &container.NodeTaint{Key: "spot", Value: "true", Effect: "NO_SCHEDULE"}),
+			},
+			onDemandNodes: []*corev1.Node{newNodePoolNode("a", "on-demand")},
+			passed:        false,
+		},
+		"oneOfTwoOnDemandNodePoolsUnsatisfied": {
+			nodePools: []*container.NodePool{
+				newNodePool("on-demand-web", false, 0, map[string]string{"workload": "web"}),
+				newNodePool("on-demand-batch", false, 0, map[string]string{"workload": "batch"}),
+				newNodePool("spot-web", true, 3, map[string]string{"workload": "web"}),
+			},
+			onDemandNodes: []*corev1.Node{newNodePoolNode("a", "on-demand-web"), newNodePoolNode("b", "on-demand-batch")},
+			passed:        false,
+		},
+		"onDemandNodeWithoutNodePool": {
+			nodePools: []*container.NodePool{
+				newNodePool("spot", true, 3, nil),
+			},
+			onDemandNodes: []*corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "a"}}},
+			passed:        false,
+		},
+		"onDemandNodeWithUnknownNodePool": {
+			nodePools: []*container.NodePool{
+				newNodePool("spot", true, 3, nil),
+			},
+			onDemandNodes: []*corev1.Node{newNodePoolNode("a", "unknown")},
+			passed:        false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			reason := checkSpotNodePools(test.nodePools, test.onDemandNodes, test.spotNodes)
+			if test.passed {
+				require.Empty(t, reason)
+			} else {
+				require.NotEmpty(t, reason)
+			}
+		})
+	}
+}
+
+func TestPreflightCheck(t *testing.T) {
+	cluster := "projects/my-project/locations/europe-west2/clusters/my-cluster"
+	nodePools := []*container.NodePool{
+		newNodePool("on-demand", false, 0, nil),
+		newNodePool("spot", true, 1, nil),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/"+cluster+"/nodePools" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&container.ListNodePoolsResponse{NodePools: nodePools})
+	}))
+	defer server.Close()
+
+	containerService, err := container.NewService(context.Background(), option.WithEndpoint(server.URL), option.WithoutAuthentication())
+	require.Nil(t, err)
+	gcp := newTestCloudProvider()
+	gcp.containerService = containerService
+	gcp.cluster = cluster
+
+	onDemandNodes := []*corev1.Node{newNodePoolNode("a", "on-demand")}
+
+	// The spot node pool has headroom to scale up
+	reason, err := gcp.PreflightCheck(context.Background(), onDemandNodes, nil)
+	require.Nil(t, err)
+	require.Empty(t, reason)
+
+	// The spot node pool is at its maximum size
+	reason, err = gcp.PreflightCheck(context.Background(), onDemandNodes, []*corev1.Node{newNodePoolNode("b", "spot")})
+	require.Nil(t, err)
+	require.Contains(t, reason, "on-demand node pool on-demand")
+
+	// The pre-flight check always passes when it is not enabled
+	reason, err = newTestCloudProvider().PreflightCheck(context.Background(), onDemandNodes, []*corev1.Node{newNodePoolNode("b", "spot")})
+	require.Nil(t, err)
+	require.Empty(t, reason)
+}
@@ -0,0 +1,92 @@
+package generic
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/hsbc/cost-manager/pkg/kubernetes"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientgo "k8s.io/client-go/kubernetes"
+)
+
+// CloudProvider supports environments without a cloud API that cost-manager should call (e.g.
+// on-premises clusters). Spot instances are identified using a label selector and Nodes are
+// removed by deleting the Node object or by tainting the Node and leaving its removal to an
+// external autoscaler
+type CloudProvider struct {
+	clientset            clientgo.Interface
+	spotInstanceSelector labels.Selector
+	deletionPolicy       v1alpha1.GenericDeletionPolicy
+	taint                corev1.Taint
+}
+
+// NewCloudProvider creates a new generic cloud provider
+func NewCloudProvider(clientset clientgo.Interface, config *v1alpha1.GenericCloudProvider) (*CloudProvider, error) {
+	if config == nil || config.SpotInstanceSelector == "" {
+		return nil, errors.New("spot instance selector must be configured for the generic cloud provider")
+	}
+	spotInstanceSelector, err := labels.Parse(config.SpotInstanceSelector)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse spot instance selector")
+	}
+
+	deletionPolicy := v1alpha1.GenericDeletionPolicyDelete
+	if config.DeletionPolicy != "" {
+		deletionPolicy = config.DeletionPolicy
+	}
+	switch deletionPolicy {
+	case v1alpha1.GenericDeletionPolicyDelete, v1alpha1.GenericDeletionPolicyTaint:
+	default:
+		return nil, fmt.Errorf("unknown deletion policy: %s", deletionPolicy)
+	}
+
+	taint := corev1.Taint{
+		Key:    kubernetes.DeleteTaint,
+		Effect: corev1.TaintEffectNoSchedule,
+	}
+	if config.Taint != nil {
+		taint = *config.Taint
+	}
+
+	return &CloudProvider{
+		clientset:            clientset,
+		spotInstanceSelector: spotInstanceSelector,
+		deletionPolicy:       deletionPolicy,
+		taint:                taint,
+	}, nil
+}
+
+// IsSpotInstance determines whether the Node is a spot instance using the configured selector
+func (generic *CloudProvider) IsSpotInstance(ctx context.Context, node *corev1.Node) (bool, error) {
+	return generic.spotInstanceSelector.Matches(labels.Set(node.Labels)), nil
+}
+
+// DeleteInstance deletes the Node object or, when using the Taint deletion policy, taints the Node
+// so that an external autoscaler can remove it. In both cases the underlying instance is left for
+// other components to clean up
+func (generic *CloudProvider) DeleteInstance(ctx context.Context, node *corev1.Node) error {
+	switch generic.deletionPolicy {
+	case v1alpha1.GenericDeletionPolicyTaint:
+		err := kubernetes.AddTaint(ctx, generic.clientset, node.Name, generic.taint)
+		if err != nil {
+			return errors.Wrapf(err, "failed to add taint %s to Node %s", generic.taint.Key, node.Name)
+		}
+	default:
+		err := generic.clientset.CoreV1().Nodes().Delete(ctx, node.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to delete Node %s", node.Name)
+		}
+	}
+	return nil
+}
+
+// RemovalDeferred returns true when using the Taint deletion policy since the removal of tainted
+// Nodes is left to an external autoscaler
+func (generic *CloudProvider) RemovalDeferred() bool {
+	return generic.deletionPolicy == v1alpha1.GenericDeletionPolicyTaint
+}
@@ -0,0 +1,154 @@
+package generic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNewCloudProvider(t *testing.T) {
+	tests := map[string]struct {
+		config *v1alpha1.GenericCloudProvider
+		valid  bool
+	}{
+		"valid": {
+			config: &v1alpha1.GenericCloudProvider{
+				SpotInstanceSelector: "node.kubernetes.io/lifecycle=spot",
+			},
+			valid: true,
+		},
+		"taintDeletionPolicy": {
+			config: &v1alpha1.GenericCloudProvider{
+				SpotInstanceSelector: "node.kubernetes.io/lifecycle=spot",
+				DeletionPolicy:       v1alpha1.GenericDeletionPolicyTaint,
+			},
+			valid: true,
+		},
+		"nilConfig": {
+			config: nil,
+			valid:  false,
+		},
+		"missingSpotInstanceSelector": {
+			config: &v1alpha1.GenericCloudProvider{},
+			valid:  false,
+		},
+		"invalidSpotInstanceSelector": {
+			config: &v1alpha1.GenericCloudProvider{
+				SpotInstanceSelector: "node.kubernetes.io/lifecycle in spot",
+			},
+			valid: false,
+		},
+		"unknownDeletionPolicy": {
+			config: &v1alpha1.GenericCloudProvider{
+				SpotInstanceSelector: "node.kubernetes.io/lifecycle=spot",
+				DeletionPolicy:       "Drain",
+			},
+			valid: false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewCloudProvider(fake.NewSimpleClientset(), test.config)
+			if test.valid {
+				require.Nil(t, err)
+			} else {
+				require.NotNil(t, err)
+			}
+		})
+	}
+}
+
+func TestIsSpotInstance(t *testing.T) {
+	tests := map[string]struct {
+		spotInstanceSelector string
+		labels               map[string]string
+		isSpotInstance       bool
+	}{
+		"equalityMatch": {
+			spotInstanceSelector: "node.kubernetes.io/lifecycle=spot",
+			labels:               map[string]string{"node.kubernetes.io/lifecycle": "spot"},
+			isSpotInstance:       true,
+		},
+		"equalityMismatch": {
+			spotInstanceSelector: "node.kubernetes.io/lifecycle=spot",
+			labels:               map[string]string{"node.kubernetes.io/lifecycle": "normal"},
+			isSpotInstance:       false,
+		},
+		"setMatch": {
+			spotInstanceSelector: "example.com/capacity-type in (spot,preemptible)",
+			labels:               map[string]string{"example.com/capacity-type": "preemptible"},
+			isSpotInstance:       true,
+		},
+		"noLabels": {
+			spotInstanceSelector: "node.kubernetes.io/lifecycle=spot",
+			labels:               nil,
+			isSpotInstance:       false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			generic, err := NewCloudProvider(fake.NewSimpleClientset(), &v1alpha1.GenericCloudProvider{
+				SpotInstanceSelector: test.spotInstanceSelector,
+			})
+			require.Nil(t, err)
+			node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: test.labels}}
+			isSpotInstance, err := generic.IsSpotInstance(context.Background(), node)
+			require.Nil(t, err)
+			require.Equal(t, test.isSpotInstance, isSpotInstance)
+		})
+	}
+}
+
+func TestDeleteInstance(t *testing.T) {
+	ctx := context.Background()
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test"}}
+	clientset := fake.NewSimpleClientset(node)
+	generic, err := NewCloudProvider(clientset, &v1alpha1.GenericCloudProvider{
+		SpotInstanceSelector: "node.kubernetes.io/lifecycle=spot",
+	})
+	require.Nil(t, err)
+	require.False(t, generic.RemovalDeferred())
+
+	err = generic.DeleteInstance(ctx, node)
+	require.Nil(t, err)
+	_, err = clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+	require.True(t, apierrors.IsNotFound(err))
+
+	// Deleting the instance again should succeed since the Node has already been deleted
+	err = generic.DeleteInstance(ctx, node)
+	require.Nil(t, err)
+}
+
+func TestDeleteInstanceTaintDeletionPolicy(t *testing.T) {
+	ctx := context.Background()
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test"}}
+	clientset := fake.NewSimpleClientset(node)
+	taint := corev1.Taint{
+		Key:    "example.com/remove",
+		Value:  "true",
+		Effect: corev1.TaintEffectNoExecute,
+	}
+	generic, err := NewCloudProvider(clientset, &v1alpha1.GenericCloudProvider{
+		SpotInstanceSelector: "node.kubernetes.io/lifecycle=spot",
+		DeletionPolicy:       v1alpha1.GenericDeletionPolicyTaint,
+		Taint:                &taint,
+	})
+	require.Nil(t, err)
+	// The removal of tainted Nodes is left to an external autoscaler
+	require.True(t, generic.RemovalDeferred())
+
+	// Tainting should be idempotent
+	for i := 0; i < 2; i++ {
+		err = generic.DeleteInstance(ctx, node)
+		require.Nil(t, err)
+		node, err := clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+		require.Nil(t, err)
+		require.Equal(t, []corev1.Taint{taint}, node.Spec.Taints)
+	}
+}
@@ -0,0 +1,108 @@
+package instanceinfo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	ProvisioningModelStandard    = "STANDARD"
+	ProvisioningModelSpot        = "SPOT"
+	ProvisioningModelPreemptible = "PREEMPTIBLE"
+)
+
+// InstanceInfo describes the underlying instance of a Node
+type InstanceInfo struct {
+	// MachineType is the machine type of the instance (e.g. n2-standard-4)
+	MachineType string
+	// Zone is the zone of the instance
+	Zone string
+	// NodeGroup is the node group or node pool that the instance belongs to
+	NodeGroup string
+	// ProvisioningModel is the provisioning model of the instance (e.g. STANDARD or SPOT)
+	ProvisioningModel string
+	// CreationTime is the time at which the instance was created
+	CreationTime time.Time
+	// HourlyPrice is the price of running the instance for an hour or nil if it is not known
+	HourlyPrice *float64
+}
+
+// DeepCopy returns a copy of the InstanceInfo
+func (in *InstanceInfo) DeepCopy() *InstanceInfo {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.HourlyPrice != nil {
+		hourlyPrice := *in.HourlyPrice
+		out.HourlyPrice = &hourlyPrice
+	}
+	return &out
+}
+
+// Cache caches InstanceInfo for each Node to avoid calling cloud provider APIs every time it is
+// needed. Entries are keyed by Node UID and provider ID so that a new instance with the same Node
+// name is never served stale information
+type Cache struct {
+	getInstanceInfo func(ctx context.Context, node *corev1.Node) (*InstanceInfo, error)
+	ttl             time.Duration
+	now             func() time.Time
+
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+}
+
+type cacheKey struct {
+	uid        string
+	providerID string
+}
+
+type cacheEntry struct {
+	instanceInfo *InstanceInfo
+	expiry       time.Time
+}
+
+// NewCache returns a Cache that retrieves InstanceInfo using the specified function and caches it
+// for the specified amount of time
+func NewCache(getInstanceInfo func(ctx context.Context, node *corev1.Node) (*InstanceInfo, error), ttl time.Duration) *Cache {
+	return &Cache{
+		getInstanceInfo: getInstanceInfo,
+		ttl:             ttl,
+		now:             time.Now,
+		entries:         map[cacheKey]cacheEntry{},
+	}
+}
+
+// Get returns a copy of the cached InstanceInfo for the Node or retrieves it if it is not cached or
+// has expired; errors are not cached
+func (c *Cache) Get(ctx context.Context, node *corev1.Node) (*InstanceInfo, error) {
+	key := cacheKey{uid: string(node.UID), providerID: node.Spec.ProviderID}
+	now := c.now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiry) {
+		return entry.instanceInfo.DeepCopy(), nil
+	}
+
+	instanceInfo, err := c.getInstanceInfo(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Remove expired entries so that the cache does not grow as Nodes are replaced
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiry) {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[key] = cacheEntry{instanceInfo: instanceInfo, expiry: now.Add(c.ttl)}
+
+	return instanceInfo.DeepCopy(), nil
+}
@@ -0,0 +1,72 @@
+package instanceinfo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	var err error
+	cache := NewCache(func(ctx context.Context, node *corev1.Node) (*InstanceInfo, error) {
+		calls++
+		if err != nil {
+			return nil, err
+		}
+		return &InstanceInfo{MachineType: node.Name}, nil
+	}, time.Hour)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "a", UID: "1"},
+		Spec:       corev1.NodeSpec{ProviderID: "fake://a"},
+	}
+
+	// The first call should retrieve the instance info and subsequent calls should be cached
+	for i := 0; i < 3; i++ {
+		instanceInfo, err := cache.Get(ctx, node)
+		require.Nil(t, err)
+		require.Equal(t, "a", instanceInfo.MachineType)
+	}
+	require.Equal(t, 1, calls)
+
+	// Changing the returned instance info should not change the cached instance info
+	instanceInfo, err := cache.Get(ctx, node)
+	require.Nil(t, err)
+	instanceInfo.MachineType = "b"
+	instanceInfo, err = cache.Get(ctx, node)
+	require.Nil(t, err)
+	require.Equal(t, "a", instanceInfo.MachineType)
+	require.Equal(t, 1, calls)
+
+	// A new Node with the same name should not be served the cached instance info
+	newNode := node.DeepCopy()
+	newNode.UID = "2"
+	_, err = cache.Get(ctx, newNode)
+	require.Nil(t, err)
+	require.Equal(t, 2, calls)
+
+	// Instance info should be retrieved again once it has expired
+	now = now.Add(time.Hour)
+	_, err = cache.Get(ctx, node)
+	require.Nil(t, err)
+	require.Equal(t, 3, calls)
+	require.Len(t, cache.entries, 1)
+
+	// Errors should not be cached
+	now = now.Add(time.Hour)
+	err = errors.New("failed")
+	_, getErr := cache.Get(ctx, node)
+	require.NotNil(t, getErr)
+	_, getErr = cache.Get(ctx, node)
+	require.NotNil(t, getErr)
+	require.Equal(t, 5, calls)
+}
@@ -0,0 +1,136 @@
+package karpenter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// https://karpenter.sh/docs/reference/well-known-labels/
+	capacityTypeLabelKey = "karpenter.sh/capacity-type"
+	capacityTypeSpot     = "spot"
+	nodePoolLabelKey     = "karpenter.sh/nodepool"
+
+	// https://karpenter.sh/docs/concepts/disruption/#pod-level-controls
+	doNotDisruptAnnotationKey = "karpenter.sh/do-not-disrupt"
+
+	// Karpenter adds this taint to Nodes that it is disrupting
+	disruptedTaintKey = "karpenter.sh/disrupted"
+)
+
+var (
+	nodeClaimGVR = schema.GroupVersionResource{Group: "karpenter.sh", Version: "v1", Resource: "nodeclaims"}
+	nodePoolGVR  = schema.GroupVersionResource{Group: "karpenter.sh", Version: "v1", Resource: "nodepools"}
+)
+
+// CloudProvider supports clusters that are provisioned by Karpenter rather than the cluster
+// autoscaler. Instead of calling a cloud API, Nodes are removed by deleting their NodeClaim which
+// causes Karpenter to terminate the underlying instance
+type CloudProvider struct {
+	clientset     kubernetes.Interface
+	dynamicClient dynamic.Interface
+}
+
+// NewCloudProvider creates a new Karpenter cloud provider
+func NewCloudProvider(restConfig *rest.Config) (*CloudProvider, error) {
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create clientset")
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create dynamic client")
+	}
+	return &CloudProvider{
+		clientset:     clientset,
+		dynamicClient: dynamicClient,
+	}, nil
+}
+
+// IsSpotInstance determines whether the Node was provisioned using spot capacity:
+// https://karpenter.sh/docs/concepts/scheduling/#well-known-labels
+func (k *CloudProvider) IsSpotInstance(ctx context.Context, node *corev1.Node) (bool, error) {
+	if node.Labels == nil {
+		return false, nil
+	}
+	return node.Labels[capacityTypeLabelKey] == capacityTypeSpot, nil
+}
+
+// DeleteInstance deletes the NodeClaim that owns the Node; Karpenter then terminates the
+// underlying instance and deletes the Node
+func (k *CloudProvider) DeleteInstance(ctx context.Context, node *corev1.Node) error {
+	nodeClaim, err := k.getNodeClaim(ctx, node)
+	if err != nil {
+		return err
+	}
+	err = k.dynamicClient.Resource(nodeClaimGVR).Delete(ctx, nodeClaim.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete NodeClaim %s", nodeClaim.Name)
+	}
+	return nil
+}
+
+// nodeClaim contains the NodeClaim fields that we need:
+// https://github.com/kubernetes-sigs/karpenter/blob/v1.0.0/pkg/apis/v1/nodeclaim_status.go
+type nodeClaim struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Status            struct {
+		NodeName   string `json:"nodeName,omitempty"`
+		ProviderID string `json:"providerID,omitempty"`
+	} `json:"status,omitempty"`
+}
+
+// listNodeClaims lists all NodeClaims, optionally restricted to a single NodePool
+func (k *CloudProvider) listNodeClaims(ctx context.Context, nodePoolName string) ([]nodeClaim, error) {
+	listOptions := metav1.ListOptions{}
+	if nodePoolName != "" {
+		listOptions.LabelSelector = fmt.Sprintf("%s=%s", nodePoolLabelKey, nodePoolName)
+	}
+	nodeClaimList, err := k.dynamicClient.Resource(nodeClaimGVR).List(ctx, listOptions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list NodeClaims")
+	}
+	nodeClaims := []nodeClaim{}
+	for _, item := range nodeClaimList.Items {
+		nodeClaim := nodeClaim{}
+		err := fromUnstructured(&item, &nodeClaim)
+		if err != nil {
+			return nil, err
+		}
+		nodeClaims = append(nodeClaims, nodeClaim)
+	}
+	return nodeClaims, nil
+}
+
+// getNodeClaim returns the NodeClaim that owns the Node
+func (k *CloudProvider) getNodeClaim(ctx context.Context, node *corev1.Node) (*nodeClaim, error) {
+	nodeClaims, err := k.listNodeClaims(ctx, node.Labels[nodePoolLabelKey])
+	if err != nil {
+		return nil, err
+	}
+	for _, nodeClaim := range nodeClaims {
+		if nodeClaim.Status.NodeName == node.Name || (node.Spec.ProviderID != "" && nodeClaim.Status.ProviderID == node.Spec.ProviderID) {
+			return &nodeClaim, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to find NodeClaim for Node %s", node.Name)
+}
+
+func fromUnstructured(u *unstructured.Unstructured, obj interface{}) error {
+	err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, obj)
+	if err != nil {
+		return errors.Wrapf(err, "failed to convert %s %s", u.GetKind(), u.GetName())
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package karpenter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"knative.dev/pkg/ptr"
+)
+
+func newNode(name, nodePoolName string) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				nodePoolLabelKey:     nodePoolName,
+				capacityTypeLabelKey: "on-demand",
+			},
+		},
+		Spec: corev1.NodeSpec{
+			ProviderID: "aws:///us-east-1a/" + name,
+		},
+	}
+}
+
+func newNodeClaim(name, nodePoolName, nodeName string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "karpenter.sh/v1",
+			"kind":       "NodeClaim",
+			"metadata": map[string]interface{}{
+				"name": name,
+				"labels": map[string]interface{}{
+					nodePoolLabelKey: nodePoolName,
+				},
+			},
+			"status": map[string]interface{}{
+				"nodeName":   nodeName,
+				"providerID": "aws:///us-east-1a/" + nodeName,
+			},
+		},
+	}
+}
+
+func newNodePool(name string, budgets ...map[string]interface{}) *unstructured.Unstructured {
+	budgetList := []interface{}{}
+	for _, budget := range budgets {
+		budgetList = append(budgetList, budget)
+	}
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "karpenter.sh/v1",
+			"kind":       "NodePool",
+			"metadata": map[string]interface{}{
+				"name": name,
+			},
+			"spec": map[string]interface{}{
+				"disruption": map[string]interface{}{
+					"budgets": budgetList,
+				},
+			},
+		},
+	}
+}
+
+func newFakeCloudProvider(kubernetesObjects []runtime.Object, karpenterObjects ...runtime.Object) *CloudProvider {
+	return &CloudProvider{
+		clientset: fake.NewSimpleClientset(kubernetesObjects...),
+		dynamicClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+			nodeClaimGVR: "NodeClaimList",
+			nodePoolGVR:  "NodePoolList",
+		}, karpenterObjects...),
+	}
+}
+
+func TestIsSpotInstance(t *testing.T) {
+	tests := map[string]struct {
+		node           *corev1.Node
+		isSpotInstance bool
+	}{
+		"spot": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"karpenter.sh/capacity-type": "spot",
+					},
+				},
+			},
+			isSpotInstance: true,
+		},
+		"onDemand": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"karpenter.sh/capacity-type": "on-demand",
+					},
+				},
+			},
+			isSpotInstance: false,
+		},
+		"noLabels": {
+			node:           &corev1.Node{},
+			isSpotInstance: false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			isSpotInstance, err := (&CloudProvider{}).IsSpotInstance(context.Background(), test.node)
+			require.Nil(t, err)
+			require.Equal(t, test.isSpotInstance, isSpotInstance)
+		})
+	}
+}
+
+func TestDeleteInstance(t *testing.T) {
+	ctx := context.Background()
+	node := newNode("node-0", "default")
+	k := newFakeCloudProvider(
+		[]runtime.Object{node},
+		newNodeClaim("default-abcde", "default", "node-0"),
+		newNodeClaim("default-fghij", "default", "node-1"),
+	)
+
+	err := k.DeleteInstance(ctx, node)
+	require.Nil(t, err)
+
+	_, err = k.dynamicClient.Resource(nodeClaimGVR).Get(ctx, "default-abcde", metav1.GetOptions{})
+	require.True(t, apierrors.IsNotFound(err))
+	_, err = k.dynamicClient.Resource(nodeClaimGVR).Get(ctx, "default-fghij", metav1.GetOptions{})
+	require.Nil(t, err)
+}
+
+func TestCanDisruptNode(t *testing.T) {
+	tests := map[string]struct {
+		node           *corev1.Node
+		otherNodes     []*corev1.Node
+		pods           []*corev1.Pod
+		nodeClaim      *unstructured.Unstructured
+		budgets        []map[string]interface{}
+		canDisruptNode bool
+	}{
+		"noDisruptionControls": {
+			node:           newNode("node-0", "default"),
+			nodeClaim:      newNodeClaim("default-0", "default", "node-0"),
+			canDisruptNode: true,
+		},
+		"nodeDoNotDisrupt": {
+			node: func() *corev1.Node {
+				node := newNode("node-0", "default")
+				node.Annotations = map[string]string{"karpenter.sh/do-not-disrupt": "true"}
+				return node
+			}(),
+			nodeClaim:      newNodeClaim("default-0", "default", "node-0"),
+			canDisruptNode: false,
+		},
+		"nodeClaimDoNotDisrupt": {
+			node: newNode("node-0", "default"),
+			nodeClaim: func() *unstructured.Unstructured {
+				nodeClaim := newNodeClaim("default-0", "default", "node-0")
+				nodeClaim.SetAnnotations(map[string]string{"karpenter.sh/do-not-disrupt": "true"})
+				return nodeClaim
+			}(),
+			canDisruptNode: false,
+		},
+		"podDoNotDisrupt": {
+			node:      newNode("node-0", "default"),
+			nodeClaim: newNodeClaim("default-0", "default", "node-0"),
+			pods: []*corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace:   "default",
+						Name:        "foo",
+						Annotations: map[string]string{"karpenter.sh/do-not-disrupt": "true"},
+					},
+					Spec: corev1.PodSpec{
+						NodeName: "node-0",
+					},
+				},
+			},
+			canDisruptNode: false,
+		},
+		"succeededPodDoNotDisrupt": {
+			node:      newNode("node-0", "default"),
+			nodeClaim: newNodeClaim("default-0", "default", "node-0"),
+			pods: []*corev1.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace:   "default",
+						Name:        "foo",
+						Annotations: map[string]string{"karpenter.sh/do-not-disrupt": "true"},
+					},
+					Spec: corev1.PodSpec{
+						NodeName: "node-0",
+					},
+					Status: corev1.PodStatus{
+						Phase: corev1.PodSucceeded,
+					},
+				},
+			},
+			canDisruptNode: true,
+		},
+		"budgetExhausted": {
+			node:      newNode("node-0", "default"),
+			nodeClaim: newNodeClaim("default-0", "default", "node-0"),
+			otherNodes: []*corev1.Node{
+				func() *corev1.Node {
+					node := newNode("node-1", "default")
+					node.Spec.Taints = []corev1.Taint{{Key: "karpenter.sh/disrupted", Effect: corev1.TaintEffectNoSchedule}}
+					return node
+				}(),
+			},
+			budgets: []map[string]interface{}{
+				{"nodes": "1"},
+			},
+			canDisruptNode: false,
+		},
+		"zeroBudget": {
+			node:      newNode("node-0", "default"),
+			nodeClaim: newNodeClaim("default-0", "default", "node-0"),
+			budgets: []map[string]interface{}{
+				{"nodes": "0"},
+			},
+			canDisruptNode: false,
+		},
+		"activeScheduledZeroBudget": {
+			node:      newNode("node-0", "default"),
+			nodeClaim: newNodeClaim("default-0", "default", "node-0"),
+			budgets: []map[string]interface{}{
+				{"nodes": "10"},
+				// This budget is always active since the schedule is hit every minute
+				{"nodes": "0", "schedule": "* * * * *", "duration": "1h"},
+			},
+			canDisruptNode: false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			kubernetesObjects := []runtime.Object{test.node}
+			for _, node := range test.otherNodes {
+				kubernetesObjects = append(kubernetesObjects, node)
+			}
+			for _, pod := range test.pods {
+				kubernetesObjects = append(kubernetesObjects, pod)
+			}
+			karpenterObjects := []runtime.Object{test.nodeClaim, newNodePool("default", test.budgets...)}
+			for _, node := range test.otherNodes {
+				karpenterObjects = append(karpenterObjects, newNodeClaim(node.Name+"-claim", "default", node.Name))
+			}
+			k := newFakeCloudProvider(kubernetesObjects, karpenterObjects...)
+
+			canDisruptNode, err := k.CanDisruptNode(context.Background(), test.node)
+			require.Nil(t, err)
+			require.Equal(t, test.canDisruptNode, canDisruptNode)
+		})
+	}
+}
+
+func TestMinDisruptionBudgetNodes(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		budgets  []disruptionBudget
+		numNodes int
+		expected int
+	}{
+		"defaultBudget": {
+			numNodes: 20,
+			expected: 2,
+		},
+		"percentageRoundedUp": {
+			budgets:  []disruptionBudget{{Nodes: "5%"}},
+			numNodes: 10,
+			expected: 1,
+		},
+		"minimumOfBudgets": {
+			budgets:  []disruptionBudget{{Nodes: "50%"}, {Nodes: "3"}},
+			numNodes: 10,
+			expected: 3,
+		},
+		"activeScheduledBudget": {
+			budgets:  []disruptionBudget{{Nodes: "5"}, {Nodes: "0", Schedule: ptr.String("0 9 * * *"), Duration: &metav1.Duration{Duration: 8 * time.Hour}}},
+			numNodes: 10,
+			expected: 0,
+		},
+		"inactiveScheduledBudget": {
+			budgets:  []disruptionBudget{{Nodes: "5"}, {Nodes: "0", Schedule: ptr.String("0 9 * * *"), Duration: &metav1.Duration{Duration: time.Hour}}},
+			numNodes: 10,
+			expected: 5,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			nodes, err := minDisruptionBudgetNodes(test.budgets, test.numNodes, now)
+			require.Nil(t, err)
+			require.Equal(t, test.expected, nodes)
+		})
+	}
+}
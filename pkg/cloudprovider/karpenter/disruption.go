@@ -0,0 +1,199 @@
+package karpenter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Karpenter defaults NodePools to allowing 10% of Nodes to be disrupted at once:
+	// https://karpenter.sh/docs/concepts/disruption/#disruption-budgets
+	defaultDisruptionBudgetNodes = "10%"
+)
+
+// nodePool contains the NodePool fields that we need:
+// https://github.com/kubernetes-sigs/karpenter/blob/v1.0.0/pkg/apis/v1/nodepool.go
+type nodePool struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              struct {
+		Disruption struct {
+			Budgets []disruptionBudget `json:"budgets,omitempty"`
+		} `json:"disruption,omitempty"`
+	} `json:"spec,omitempty"`
+}
+
+type disruptionBudget struct {
+	Nodes    string           `json:"nodes"`
+	Schedule *string          `json:"schedule,omitempty"`
+	Duration *metav1.Duration `json:"duration,omitempty"`
+}
+
+// CanDisruptNode determines whether Karpenter's disruption controls allow the Node to be disrupted.
+// The Node cannot be disrupted if it, its NodeClaim or any of its Pods have the
+// karpenter.sh/do-not-disrupt annotation or if disrupting it would exceed the disruption budgets of
+// its NodePool. Since spot migration is not one of Karpenter's own disruption reasons we
+// conservatively apply all active budgets regardless of the reasons that they are scoped to
+func (k *CloudProvider) CanDisruptNode(ctx context.Context, node *corev1.Node) (bool, error) {
+	logger := log.FromContext(ctx, "node", node.Name)
+
+	if node.Annotations[doNotDisruptAnnotationKey] == "true" {
+		logger.Info("Node cannot be disrupted since it has the do-not-disrupt annotation")
+		return false, nil
+	}
+
+	nodeClaim, err := k.getNodeClaim(ctx, node)
+	if err != nil {
+		return false, err
+	}
+	if nodeClaim.Annotations[doNotDisruptAnnotationKey] == "true" {
+		logger.Info("Node cannot be disrupted since its NodeClaim has the do-not-disrupt annotation")
+		return false, nil
+	}
+
+	podList, err := k.clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node.Name).String(),
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to list Pods")
+	}
+	for _, pod := range podList.Items {
+		if pod.Spec.NodeName != node.Name || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if pod.Annotations[doNotDisruptAnnotationKey] == "true" {
+			logger.WithValues("pod", fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)).Info("Node cannot be disrupted since it is running a Pod with the do-not-disrupt annotation")
+			return false, nil
+		}
+	}
+
+	nodePoolName := node.Labels[nodePoolLabelKey]
+	if nodePoolName == "" {
+		return true, nil
+	}
+	allowedDisruptions, err := k.allowedDisruptions(ctx, nodePoolName, node, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if allowedDisruptions <= 0 {
+		logger.WithValues("nodePool", nodePoolName).Info("Node cannot be disrupted since it would exceed the disruption budget of its NodePool")
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// allowedDisruptions returns the number of additional Nodes of the NodePool that can be disrupted
+// without exceeding its disruption budgets, not counting the specified Node
+func (k *CloudProvider) allowedDisruptions(ctx context.Context, nodePoolName string, node *corev1.Node, now time.Time) (int, error) {
+	u, err := k.dynamicClient.Resource(nodePoolGVR).Get(ctx, nodePoolName, metav1.GetOptions{})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get NodePool %s", nodePoolName)
+	}
+	nodePool := &nodePool{}
+	err = fromUnstructured(u, nodePool)
+	if err != nil {
+		return 0, err
+	}
+
+	nodeClaims, err := k.listNodeClaims(ctx, nodePoolName)
+	if err != nil {
+		return 0, err
+	}
+	budgetNodes, err := minDisruptionBudgetNodes(nodePool.Spec.Disruption.Budgets, len(nodeClaims), now)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to calculate disruption budget for NodePool %s", nodePoolName)
+	}
+
+	// Count the Nodes of the NodePool that are already being disrupted
+	disruptingNodeNames := map[string]bool{}
+	for _, nodeClaim := range nodeClaims {
+		if nodeClaim.DeletionTimestamp != nil {
+			disruptingNodeNames[nodeClaim.Status.NodeName] = true
+		}
+	}
+	nodeList, err := k.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", nodePoolLabelKey, nodePoolName),
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list Nodes")
+	}
+	for _, nodePoolNode := range nodeList.Items {
+		if isDisrupting(&nodePoolNode) {
+			disruptingNodeNames[nodePoolNode.Name] = true
+		}
+	}
+	delete(disruptingNodeNames, node.Name)
+
+	return budgetNodes - len(disruptingNodeNames), nil
+}
+
+// isDisrupting returns true if the Node is being disrupted by Karpenter or has been cordoned
+func isDisrupting(node *corev1.Node) bool {
+	if node.DeletionTimestamp != nil || node.Spec.Unschedulable {
+		return true
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == disruptedTaintKey {
+			return true
+		}
+	}
+	return false
+}
+
+// minDisruptionBudgetNodes returns the minimum number of Nodes allowed to be disrupted across all
+// active disruption budgets in the same way as Karpenter:
+// https://github.com/kubernetes-sigs/karpenter/blob/v1.0.0/pkg/apis/v1/nodepool.go#L350-L394
+func minDisruptionBudgetNodes(budgets []disruptionBudget, numNodes int, now time.Time) (int, error) {
+	if len(budgets) == 0 {
+		budgets = []disruptionBudget{{Nodes: defaultDisruptionBudgetNodes}}
+	}
+	minNodes := math.MaxInt32
+	for _, budget := range budgets {
+		active, err := isDisruptionBudgetActive(budget, now)
+		if err != nil {
+			return 0, err
+		}
+		if !active {
+			continue
+		}
+		nodes := intstr.FromString(budget.Nodes)
+		if intValue, err := strconv.Atoi(budget.Nodes); err == nil {
+			nodes = intstr.FromInt(intValue)
+		}
+		// Percentages are rounded up in the same way as PodDisruptionBudgets
+		value, err := intstr.GetScaledValueFromIntOrPercent(&nodes, numNodes, true)
+		if err != nil {
+			return 0, err
+		}
+		minNodes = min(minNodes, value)
+	}
+	return minNodes, nil
+}
+
+// isDisruptionBudgetActive returns true if the budget does not have a schedule or if the schedule
+// was last hit within the budget's duration
+func isDisruptionBudgetActive(budget disruptionBudget, now time.Time) (bool, error) {
+	if budget.Schedule == nil && budget.Duration == nil {
+		return true, nil
+	}
+	if budget.Schedule == nil || budget.Duration == nil {
+		return false, errors.New("disruption budget schedule and duration must be set together")
+	}
+	schedule, err := cron.ParseStandard(fmt.Sprintf("TZ=UTC %s", *budget.Schedule))
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to parse disruption budget schedule %s", *budget.Schedule)
+	}
+	now = now.UTC()
+	return !schedule.Next(now.Add(-budget.Duration.Duration)).After(now), nil
+}
@@ -0,0 +1,127 @@
+package karpenter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// TestCloudProviderWithEnvtest runs the Karpenter cloud provider against a real API server with
+// the Karpenter CRDs installed. The CRDs in testdata are copied from the Karpenter v1.0.0 release:
+// https://github.com/kubernetes-sigs/karpenter/tree/v1.0.0/pkg/apis/crds
+func TestCloudProviderWithEnvtest(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set; run `make test-envtest` to install envtest binaries")
+	}
+	ctx := context.Background()
+
+	testEnv := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("testdata", "crds")},
+		ErrorIfCRDPathMissing: true,
+	}
+	restConfig, err := testEnv.Start()
+	require.Nil(t, err)
+	defer func() {
+		require.Nil(t, testEnv.Stop())
+	}()
+
+	k, err := NewCloudProvider(restConfig)
+	require.Nil(t, err)
+
+	// Create a NodePool that allows a single Node to be disrupted at a time
+	nodePool := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "karpenter.sh/v1",
+			"kind":       "NodePool",
+			"metadata": map[string]interface{}{
+				"name": "default",
+			},
+			"spec": map[string]interface{}{
+				"disruption": map[string]interface{}{
+					"consolidateAfter": "Never",
+					"budgets": []interface{}{
+						map[string]interface{}{"nodes": "1"},
+					},
+				},
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"nodeClassRef": testNodeClassRef(),
+						"requirements": testRequirements(),
+					},
+				},
+			},
+		},
+	}
+	_, err = k.dynamicClient.Resource(nodePoolGVR).Create(ctx, nodePool, metav1.CreateOptions{})
+	require.Nil(t, err)
+
+	// Create two on-demand Nodes with their NodeClaims
+	nodes := []*corev1.Node{}
+	for _, name := range []string{"node-0", "node-1"} {
+		node, err := k.clientset.CoreV1().Nodes().Create(ctx, newNode(name, "default"), metav1.CreateOptions{})
+		require.Nil(t, err)
+		nodes = append(nodes, node)
+
+		nodeClaim := newNodeClaim(name+"-claim", "default", name)
+		status := nodeClaim.Object["status"]
+		delete(nodeClaim.Object, "status")
+		nodeClaim.Object["spec"] = map[string]interface{}{
+			"nodeClassRef": testNodeClassRef(),
+			"requirements": testRequirements(),
+		}
+		nodeClaim, err = k.dynamicClient.Resource(nodeClaimGVR).Create(ctx, nodeClaim, metav1.CreateOptions{})
+		require.Nil(t, err)
+		nodeClaim.Object["status"] = status
+		_, err = k.dynamicClient.Resource(nodeClaimGVR).UpdateStatus(ctx, nodeClaim, metav1.UpdateOptions{})
+		require.Nil(t, err)
+	}
+
+	isSpotInstance, err := k.IsSpotInstance(ctx, nodes[0])
+	require.Nil(t, err)
+	require.False(t, isSpotInstance)
+
+	canDisruptNode, err := k.CanDisruptNode(ctx, nodes[0])
+	require.Nil(t, err)
+	require.True(t, canDisruptNode)
+
+	// Once the first Node is being disrupted the budget should prevent the second Node from being
+	// disrupted
+	nodes[0].Spec.Unschedulable = true
+	_, err = k.clientset.CoreV1().Nodes().Update(ctx, nodes[0], metav1.UpdateOptions{})
+	require.Nil(t, err)
+	canDisruptNode, err = k.CanDisruptNode(ctx, nodes[1])
+	require.Nil(t, err)
+	require.False(t, canDisruptNode)
+
+	// Deleting the instance should delete the NodeClaim
+	err = k.DeleteInstance(ctx, nodes[0])
+	require.Nil(t, err)
+	_, err = k.dynamicClient.Resource(nodeClaimGVR).Get(ctx, "node-0-claim", metav1.GetOptions{})
+	require.True(t, apierrors.IsNotFound(err))
+}
+
+func testNodeClassRef() map[string]interface{} {
+	return map[string]interface{}{
+		"group": "karpenter.k8s.aws",
+		"kind":  "EC2NodeClass",
+		"name":  "default",
+	}
+}
+
+func testRequirements() []interface{} {
+	return []interface{}{
+		map[string]interface{}{
+			"key":      capacityTypeLabelKey,
+			"operator": "In",
+			"values":   []interface{}{"on-demand", "spot"},
+		},
+	}
+}
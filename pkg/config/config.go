@@ -5,9 +5,14 @@ import (
 	"fmt"
 	"os"
 	"slices"
+	"strings"
 
 	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider"
 	"github.com/hsbc/cost-manager/pkg/controller"
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 )
@@ -66,5 +71,177 @@ func validate(config *v1alpha1.CostManagerConfiguration) error {
 		}
 	}
 
+	// Ensure that only the selected cloud provider is configured since configuration for any other
+	// cloud provider would be silently ignored
+	cloudProviderConfigs := []struct {
+		name       string
+		configured bool
+	}{
+		{cloudprovider.GCPCloudProviderName, config.CloudProvider.GCP != nil},
+		{cloudprovider.AWSCloudProviderName, config.CloudProvider.AWS != nil},
+		{cloudprovider.AzureCloudProviderName, config.CloudProvider.Azure != nil},
+		{cloudprovider.ClusterAPICloudProviderName, config.CloudProvider.ClusterAPI != nil},
+		{cloudprovider.GenericCloudProviderName, config.CloudProvider.Generic != nil},
+		{cloudprovider.ExternalCloudProviderName, config.CloudProvider.External != nil},
+	}
+	for _, cloudProviderConfig := range cloudProviderConfigs {
+		if cloudProviderConfig.configured && cloudProviderConfig.name != config.CloudProvider.Name {
+			return fmt.Errorf("%s cloud provider options cannot be used with cloud provider: %s", cloudProviderConfig.name, config.CloudProvider.Name)
+		}
+	}
+
+	// Ensure that cloud providers that require configuration are configured
+	if config.CloudProvider.Name == cloudprovider.ClusterAPICloudProviderName && (config.CloudProvider.ClusterAPI == nil || config.CloudProvider.ClusterAPI.SpotInstanceLabelKey == "") {
+		return errors.New("spot instance label key must be configured for the Cluster API cloud provider")
+	}
+	if config.CloudProvider.Name == cloudprovider.ExternalCloudProviderName && (config.CloudProvider.External == nil || config.CloudProvider.External.Endpoint == "") {
+		return errors.New("endpoint must be configured for the external cloud provider")
+	}
+	if config.CloudProvider.Name == cloudprovider.GenericCloudProviderName {
+		generic := config.CloudProvider.Generic
+		if generic == nil || generic.SpotInstanceSelector == "" {
+			return errors.New("spot instance selector must be configured for the generic cloud provider")
+		}
+		_, err := labels.Parse(generic.SpotInstanceSelector)
+		if err != nil {
+			return fmt.Errorf("failed to parse spot instance selector: %s", err)
+		}
+		switch generic.DeletionPolicy {
+		case "", v1alpha1.GenericDeletionPolicyDelete, v1alpha1.GenericDeletionPolicyTaint:
+		default:
+			return fmt.Errorf("unknown deletion policy: %s", generic.DeletionPolicy)
+		}
+	}
+
+	if config.CloudProvider.GCP != nil {
+		if config.CloudProvider.GCP.ImpersonateServiceAccount != "" && !strings.Contains(config.CloudProvider.GCP.ImpersonateServiceAccount, "@") {
+			return fmt.Errorf("impersonated service account must be an email address: %s", config.CloudProvider.GCP.ImpersonateServiceAccount)
+		}
+		switch config.CloudProvider.GCP.DeletionMode {
+		case "", v1alpha1.GCPDeletionModeDeleteInstance, v1alpha1.GCPDeletionModeTaint:
+		default:
+			return fmt.Errorf("unknown deletion mode: %s", config.CloudProvider.GCP.DeletionMode)
+		}
+		if config.CloudProvider.GCP.NodePoolMinimumSizeCheck != nil {
+			switch config.CloudProvider.GCP.NodePoolMinimumSizeCheck.Action {
+			case "", v1alpha1.GKENodePoolMinimumSizeActionWarn, v1alpha1.GKENodePoolMinimumSizeActionRefuse:
+			default:
+				return fmt.Errorf("unknown node pool minimum size action: %s", config.CloudProvider.GCP.NodePoolMinimumSizeCheck.Action)
+			}
+		}
+		for _, instancePrice := range config.CloudProvider.GCP.InstancePrices {
+			if instancePrice.MachineType == "" {
+				return errors.New("instance price machine type must be specified")
+			}
+			if instancePrice.HourlyPrice < 0 {
+				return fmt.Errorf("hourly price of machine type %s must not be negative", instancePrice.MachineType)
+			}
+		}
+	}
+
+	if config.SpotMigrator != nil {
+		err := validateSpotMigrationSettings(config.SpotMigrator.MinOnDemandNodes, config.SpotMigrator.MinOnDemandFraction, config.SpotMigrator.MaxRunDurationAction, config.SpotMigrator.HealthGate)
+		if err != nil {
+			return err
+		}
+		policyNames := map[string]bool{}
+		for _, policy := range config.SpotMigrator.Policies {
+			if policy.Name == "" {
+				return errors.New("spot migration policy name must not be empty")
+			}
+			if policyNames[policy.Name] {
+				return fmt.Errorf("duplicate spot migration policy: %s", policy.Name)
+			}
+			policyNames[policy.Name] = true
+			if policy.NodeSelector != nil {
+				_, err := metav1.LabelSelectorAsSelector(policy.NodeSelector)
+				if err != nil {
+					return fmt.Errorf("invalid Node selector for spot migration policy %s: %s", policy.Name, err)
+				}
+			}
+			if policy.SpotNodeSelector != nil {
+				_, err := metav1.LabelSelectorAsSelector(policy.SpotNodeSelector)
+				if err != nil {
+					return fmt.Errorf("invalid spot Node selector for spot migration policy %s: %s", policy.Name, err)
+				}
+			}
+			// The Node selector of a policy typically only matches on-demand Nodes so the minimum
+			// on-demand fraction of a policy is only meaningful if its spot Nodes are selected
+			// explicitly
+			if (policy.MinOnDemandFraction != nil || config.SpotMigrator.MinOnDemandFraction != nil) && policy.SpotNodeSelector == nil {
+				return fmt.Errorf("spot Node selector must be set for spot migration policy %s to use the minimum on-demand fraction", policy.Name)
+			}
+			if policy.MigrationSchedule != nil {
+				_, err := cron.ParseStandard(*policy.MigrationSchedule)
+				if err != nil {
+					return fmt.Errorf("invalid migration schedule for spot migration policy %s: %s", policy.Name, err)
+				}
+			}
+			err := validateSpotMigrationSettings(policy.MinOnDemandNodes, policy.MinOnDemandFraction, policy.MaxRunDurationAction, policy.HealthGate)
+			if err != nil {
+				return fmt.Errorf("invalid spot migration policy %s: %s", policy.Name, err)
+			}
+		}
+	}
+
+	if config.SpotPreemptionHandler != nil && config.SpotPreemptionHandler.MaxConcurrentDrains != nil && *config.SpotPreemptionHandler.MaxConcurrentDrains < 1 {
+		return fmt.Errorf("maximum concurrent drains must be positive: %d", *config.SpotPreemptionHandler.MaxConcurrentDrains)
+	}
+
+	if config.PodSafeToEvictAnnotator != nil {
+		selectors := map[string]*metav1.LabelSelector{
+			"Namespace selector":   config.PodSafeToEvictAnnotator.NamespaceSelector,
+			"Pod selector":         config.PodSafeToEvictAnnotator.PodSelector,
+			"exclude Pod selector": config.PodSafeToEvictAnnotator.ExcludePodSelector,
+		}
+		for name, selector := range selectors {
+			if selector == nil {
+				continue
+			}
+			_, err := metav1.LabelSelectorAsSelector(selector)
+			if err != nil {
+				return fmt.Errorf("invalid %s for pod-safe-to-evict-annotator: %s", name, err)
+			}
+		}
+		for _, ownerKind := range config.PodSafeToEvictAnnotator.OwnerKinds {
+			if ownerKind == "" {
+				return errors.New("owner kinds for pod-safe-to-evict-annotator must not be empty")
+			}
+			// Pods of owner kinds whose replicas cannot be determined would never be annotated
+			if config.PodSafeToEvictAnnotator.RequireMultipleReplicas && !slices.Contains(controller.ReplicaOwnerKinds, ownerKind) {
+				return fmt.Errorf("owner kind %s for pod-safe-to-evict-annotator must be one of %s when multiple replicas are required", ownerKind, strings.Join(controller.ReplicaOwnerKinds, ", "))
+			}
+		}
+		webhook := config.PodSafeToEvictAnnotator.Webhook
+		if webhook != nil && (webhook.Port < 0 || webhook.Port > 65535) {
+			return fmt.Errorf("invalid webhook port for pod-safe-to-evict-annotator: %d", webhook.Port)
+		}
+	}
+
+	return nil
+}
+
+// validateSpotMigrationSettings validates the settings that can be configured both for
+// spot-migrator as a whole and for individual spot migration policies
+func validateSpotMigrationSettings(minOnDemandNodes *int32, minOnDemandFraction *float64, maxRunDurationAction v1alpha1.MaxRunDurationAction, healthGate *v1alpha1.HealthGate) error {
+	// Ensure that the minimum on-demand guardrail is within range
+	if minOnDemandNodes != nil && *minOnDemandNodes < 0 {
+		return fmt.Errorf("minimum on-demand Nodes must not be negative: %d", *minOnDemandNodes)
+	}
+	if minOnDemandFraction != nil && (*minOnDemandFraction < 0 || *minOnDemandFraction > 1) {
+		return fmt.Errorf("minimum on-demand fraction must be between 0 and 1: %v", *minOnDemandFraction)
+	}
+	switch maxRunDurationAction {
+	case "", v1alpha1.MaxRunDurationActionFinish, v1alpha1.MaxRunDurationActionRollback:
+	default:
+		return fmt.Errorf("unknown maximum run duration action: %s", maxRunDurationAction)
+	}
+	if healthGate != nil {
+		switch healthGate.Action {
+		case "", v1alpha1.HealthGateActionPause, v1alpha1.HealthGateActionAbort:
+		default:
+			return fmt.Errorf("unknown health gate action: %s", healthGate.Action)
+		}
+	}
 	return nil
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
 	"github.com/stretchr/testify/require"
@@ -21,11 +22,28 @@ apiVersion: cost-manager.io/v1alpha1
 kind: CostManagerConfiguration
 controllers:
 - spot-migrator
+- spot-preemption-handler
 - pod-safe-to-evict-annotator
 cloudProvider:
   name: gcp
 spotMigrator:
   migrationSchedule: "* * * * *"
+  minOnDemandNodes: 1
+  minOnDemandFraction: 0.1
+  minOnDemandPerZone: true
+  policies:
+  - name: ingress
+    nodeSelector:
+      matchLabels:
+        cloud.google.com/gke-nodepool: ingress
+    spotNodeSelector:
+      matchLabels:
+        cloud.google.com/gke-nodepool: ingress-spot
+    migrationSchedule: "0 22 * * 0"
+    minOnDemandNodes: 2
+    drainTimeout: 10m
+spotPreemptionHandler:
+  drainTimeout: 20s
 podSafeToEvictAnnotator:
   namespaceSelector:
     matchExpressions:
@@ -42,13 +60,38 @@ podSafeToEvictAnnotator:
 				},
 				Controllers: []string{
 					"spot-migrator",
+					"spot-preemption-handler",
 					"pod-safe-to-evict-annotator",
 				},
 				CloudProvider: v1alpha1.CloudProvider{
 					Name: "gcp",
 				},
 				SpotMigrator: &v1alpha1.SpotMigrator{
-					MigrationSchedule: ptr.String("* * * * *"),
+					MigrationSchedule:   ptr.String("* * * * *"),
+					MinOnDemandNodes:    ptr.Int32(1),
+					MinOnDemandFraction: ptr.Float64(0.1),
+					MinOnDemandPerZone:  true,
+					Policies: []v1alpha1.SpotMigrationPolicy{
+						{
+							Name: "ingress",
+							NodeSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"cloud.google.com/gke-nodepool": "ingress",
+								},
+							},
+							SpotNodeSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"cloud.google.com/gke-nodepool": "ingress-spot",
+								},
+							},
+							MigrationSchedule: ptr.String("0 22 * * 0"),
+							MinOnDemandNodes:  ptr.Int32(2),
+							DrainTimeout:      &metav1.Duration{Duration: 10 * time.Minute},
+						},
+					},
+				},
+				SpotPreemptionHandler: &v1alpha1.SpotPreemptionHandler{
+					DrainTimeout: &metav1.Duration{Duration: 20 * time.Second},
 				},
 				PodSafeToEvictAnnotator: &v1alpha1.PodSafeToEvictAnnotator{
 					NamespaceSelector: &metav1.LabelSelector{
@@ -89,6 +132,17 @@ kind: CostManagerConfiguration
 			configData: []byte(`
 apiVersion: cost-manager.io/v1alpha1
 kind: FooConfiguration
+`),
+			valid: false,
+		},
+		"unknownCloudProviderField": {
+			configData: []byte(`
+apiVersion: cost-manager.io/v1alpha1
+kind: CostManagerConfiguration
+cloudProvider:
+  name: gcp
+  gcp:
+    foo: bar
 `),
 			valid: false,
 		},
@@ -135,6 +189,516 @@ func TestValidate(t *testing.T) {
 			},
 			valid: false,
 		},
+		"validMinOnDemandGuardrail": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotMigrator: &v1alpha1.SpotMigrator{
+					MinOnDemandNodes:    ptr.Int32(1),
+					MinOnDemandFraction: ptr.Float64(0.2),
+				},
+			},
+			valid: true,
+		},
+		"negativeMinOnDemandNodes": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotMigrator: &v1alpha1.SpotMigrator{
+					MinOnDemandNodes: ptr.Int32(-1),
+				},
+			},
+			valid: false,
+		},
+		"unknownMaxRunDurationAction": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotMigrator: &v1alpha1.SpotMigrator{
+					MaxRunDurationAction: "Foo",
+				},
+			},
+			valid: false,
+		},
+		"unknownHealthGateAction": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotMigrator: &v1alpha1.SpotMigrator{
+					HealthGate: &v1alpha1.HealthGate{
+						Action: "Foo",
+					},
+				},
+			},
+			valid: false,
+		},
+		"minOnDemandFractionGreaterThanOne": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotMigrator: &v1alpha1.SpotMigrator{
+					MinOnDemandFraction: ptr.Float64(1.5),
+				},
+			},
+			valid: false,
+		},
+		"validClusterAPICloudProvider": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "clusterapi",
+					ClusterAPI: &v1alpha1.ClusterAPICloudProvider{
+						SpotInstanceLabelKey: "example.com/spot",
+					},
+				},
+			},
+			valid: true,
+		},
+		"clusterAPICloudProviderWithoutSpotInstanceLabelKey": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "clusterapi",
+				},
+			},
+			valid: false,
+		},
+		"validExternalCloudProvider": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "external",
+					External: &v1alpha1.ExternalCloudProvider{
+						Endpoint: "unix:///var/run/cost-manager/plugin.sock",
+					},
+				},
+			},
+			valid: true,
+		},
+		"externalCloudProviderWithoutEndpoint": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "external",
+				},
+			},
+			valid: false,
+		},
+		"validGenericCloudProvider": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "generic",
+					Generic: &v1alpha1.GenericCloudProvider{
+						SpotInstanceSelector: "node.kubernetes.io/lifecycle=spot",
+						DeletionPolicy:       v1alpha1.GenericDeletionPolicyTaint,
+					},
+				},
+			},
+			valid: true,
+		},
+		"genericCloudProviderWithoutSpotInstanceSelector": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "generic",
+				},
+			},
+			valid: false,
+		},
+		"genericCloudProviderWithInvalidSpotInstanceSelector": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "generic",
+					Generic: &v1alpha1.GenericCloudProvider{
+						SpotInstanceSelector: "node.kubernetes.io/lifecycle in spot",
+					},
+				},
+			},
+			valid: false,
+		},
+		"genericCloudProviderWithUnknownDeletionPolicy": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "generic",
+					Generic: &v1alpha1.GenericCloudProvider{
+						SpotInstanceSelector: "node.kubernetes.io/lifecycle=spot",
+						DeletionPolicy:       "Drain",
+					},
+				},
+			},
+			valid: false,
+		},
+		"validInstancePrices": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "gcp",
+					GCP: &v1alpha1.GCPCloudProvider{
+						InstancePrices: []v1alpha1.InstancePrice{
+							{MachineType: "n2-standard-4", HourlyPrice: 0.2},
+							{MachineType: "n2-standard-4", ProvisioningModel: "SPOT", HourlyPrice: 0.05},
+						},
+					},
+				},
+			},
+			valid: true,
+		},
+		"validGCPClientOptions": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "gcp",
+					GCP: &v1alpha1.GCPCloudProvider{
+						CredentialsFile:           "/var/run/secrets/gcp/credentials.json",
+						ImpersonateServiceAccount: "cost-manager@my-project.iam.gserviceaccount.com",
+						QuotaProject:              "my-project",
+						Endpoint:                  "https://compute-my-endpoint.p.googleapis.com/compute/v1/",
+						UserAgent:                 "cost-manager",
+					},
+				},
+			},
+			valid: true,
+		},
+		"invalidImpersonateServiceAccount": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "gcp",
+					GCP: &v1alpha1.GCPCloudProvider{
+						ImpersonateServiceAccount: "cost-manager",
+					},
+				},
+			},
+			valid: false,
+		},
+		"optionsForOtherCloudProvider": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "aws",
+					GCP: &v1alpha1.GCPCloudProvider{
+						QuotaProject: "my-project",
+					},
+				},
+			},
+			valid: false,
+		},
+		"validAzureOptions": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "azure",
+					Azure: &v1alpha1.AzureCloudProvider{
+						ManagedIdentityClientID: "00000000-0000-0000-0000-000000000000",
+						LoadBalancerDrainDelay:  &metav1.Duration{Duration: time.Minute},
+					},
+				},
+			},
+			valid: true,
+		},
+		"azureOptionsForOtherCloudProvider": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "gcp",
+					Azure: &v1alpha1.AzureCloudProvider{
+						TenantID: "00000000-0000-0000-0000-000000000000",
+					},
+				},
+			},
+			valid: false,
+		},
+		"validGCPDeletionMode": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "gcp",
+					GCP: &v1alpha1.GCPCloudProvider{
+						DeletionMode: v1alpha1.GCPDeletionModeDeleteInstance,
+						NodePoolMinimumSizeCheck: &v1alpha1.GKENodePoolMinimumSizeCheck{
+							Action: v1alpha1.GKENodePoolMinimumSizeActionRefuse,
+						},
+					},
+				},
+			},
+			valid: true,
+		},
+		"unknownGCPDeletionMode": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "gcp",
+					GCP: &v1alpha1.GCPCloudProvider{
+						DeletionMode: "Resize",
+					},
+				},
+			},
+			valid: false,
+		},
+		"unknownNodePoolMinimumSizeAction": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "gcp",
+					GCP: &v1alpha1.GCPCloudProvider{
+						NodePoolMinimumSizeCheck: &v1alpha1.GKENodePoolMinimumSizeCheck{
+							Action: "Ignore",
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		"instancePriceWithoutMachineType": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "gcp",
+					GCP: &v1alpha1.GCPCloudProvider{
+						InstancePrices: []v1alpha1.InstancePrice{
+							{HourlyPrice: 0.2},
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		"negativeInstancePrice": {
+			config: &v1alpha1.CostManagerConfiguration{
+				CloudProvider: v1alpha1.CloudProvider{
+					Name: "gcp",
+					GCP: &v1alpha1.GCPCloudProvider{
+						InstancePrices: []v1alpha1.InstancePrice{
+							{MachineType: "n2-standard-4", HourlyPrice: -1},
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		"validPolicies": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotMigrator: &v1alpha1.SpotMigrator{
+					Policies: []v1alpha1.SpotMigrationPolicy{
+						{
+							Name: "batch",
+							NodeSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"cloud.google.com/gke-nodepool": "batch",
+								},
+							},
+							MigrationSchedule: ptr.String("*/15 * * * *"),
+						},
+						{
+							Name:             "default",
+							MinOnDemandNodes: ptr.Int32(1),
+						},
+						{
+							Name: "ingress",
+							NodeSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"cloud.google.com/gke-nodepool": "ingress",
+								},
+							},
+							SpotNodeSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"cloud.google.com/gke-nodepool": "ingress-spot",
+								},
+							},
+							MinOnDemandFraction: ptr.Float64(0.5),
+						},
+					},
+				},
+			},
+			valid: true,
+		},
+		"policyWithoutName": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotMigrator: &v1alpha1.SpotMigrator{
+					Policies: []v1alpha1.SpotMigrationPolicy{
+						{},
+					},
+				},
+			},
+			valid: false,
+		},
+		"duplicatePolicy": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotMigrator: &v1alpha1.SpotMigrator{
+					Policies: []v1alpha1.SpotMigrationPolicy{
+						{
+							Name: "default",
+						},
+						{
+							Name: "default",
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		"validPodSafeToEvictAnnotatorSelectors": {
+			config: &v1alpha1.CostManagerConfiguration{
+				PodSafeToEvictAnnotator: &v1alpha1.PodSafeToEvictAnnotator{
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"k8s-app": "kube-dns",
+						},
+					},
+					ExcludePodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"example.com/exclude": "true",
+						},
+					},
+				},
+			},
+			valid: true,
+		},
+		"invalidPodSelector": {
+			config: &v1alpha1.CostManagerConfiguration{
+				PodSafeToEvictAnnotator: &v1alpha1.PodSafeToEvictAnnotator{
+					PodSelector: &metav1.LabelSelector{
+						MatchExpressions: []metav1.LabelSelectorRequirement{
+							{
+								Key:      "foo",
+								Operator: "Foo",
+							},
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		"validSpotPreemptionHandlerMaxConcurrentDrains": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotPreemptionHandler: &v1alpha1.SpotPreemptionHandler{
+					MaxConcurrentDrains: ptr.Int32(20),
+				},
+			},
+			valid: true,
+		},
+		"invalidSpotPreemptionHandlerMaxConcurrentDrains": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotPreemptionHandler: &v1alpha1.SpotPreemptionHandler{
+					MaxConcurrentDrains: ptr.Int32(0),
+				},
+			},
+			valid: false,
+		},
+		"validPodSafeToEvictAnnotatorOwnerRules": {
+			config: &v1alpha1.CostManagerConfiguration{
+				PodSafeToEvictAnnotator: &v1alpha1.PodSafeToEvictAnnotator{
+					OwnerKinds:              []string{"ReplicaSet", "DaemonSet"},
+					RequireMultipleReplicas: true,
+				},
+			},
+			valid: true,
+		},
+		"podSafeToEvictAnnotatorOwnerKindWithUndeterminedReplicas": {
+			config: &v1alpha1.CostManagerConfiguration{
+				PodSafeToEvictAnnotator: &v1alpha1.PodSafeToEvictAnnotator{
+					OwnerKinds:              []string{"ReplicaSet", "Job"},
+					RequireMultipleReplicas: true,
+				},
+			},
+			valid: false,
+		},
+		"emptyPodSafeToEvictAnnotatorOwnerKind": {
+			config: &v1alpha1.CostManagerConfiguration{
+				PodSafeToEvictAnnotator: &v1alpha1.PodSafeToEvictAnnotator{
+					OwnerKinds: []string{""},
+				},
+			},
+			valid: false,
+		},
+		"validPodSafeToEvictAnnotatorWebhook": {
+			config: &v1alpha1.CostManagerConfiguration{
+				PodSafeToEvictAnnotator: &v1alpha1.PodSafeToEvictAnnotator{
+					Webhook: &v1alpha1.PodSafeToEvictAnnotatorWebhook{
+						Port:    9443,
+						CertDir: "/certs",
+					},
+				},
+			},
+			valid: true,
+		},
+		"invalidPodSafeToEvictAnnotatorWebhookPort": {
+			config: &v1alpha1.CostManagerConfiguration{
+				PodSafeToEvictAnnotator: &v1alpha1.PodSafeToEvictAnnotator{
+					Webhook: &v1alpha1.PodSafeToEvictAnnotatorWebhook{
+						Port: 100000,
+					},
+				},
+			},
+			valid: false,
+		},
+		"policyWithInvalidNodeSelector": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotMigrator: &v1alpha1.SpotMigrator{
+					Policies: []v1alpha1.SpotMigrationPolicy{
+						{
+							Name: "default",
+							NodeSelector: &metav1.LabelSelector{
+								MatchExpressions: []metav1.LabelSelectorRequirement{
+									{
+										Key:      "foo",
+										Operator: "Foo",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		"policyWithInvalidMigrationSchedule": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotMigrator: &v1alpha1.SpotMigrator{
+					Policies: []v1alpha1.SpotMigrationPolicy{
+						{
+							Name:              "default",
+							MigrationSchedule: ptr.String("every Sunday"),
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		"policyWithMinOnDemandFractionWithoutSpotNodeSelector": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotMigrator: &v1alpha1.SpotMigrator{
+					Policies: []v1alpha1.SpotMigrationPolicy{
+						{
+							Name: "default",
+							NodeSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"cloud.google.com/gke-nodepool": "default",
+								},
+							},
+							MinOnDemandFraction: ptr.Float64(0.5),
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		"policyWithInheritedMinOnDemandFractionWithoutSpotNodeSelector": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotMigrator: &v1alpha1.SpotMigrator{
+					MinOnDemandFraction: ptr.Float64(0.5),
+					Policies: []v1alpha1.SpotMigrationPolicy{
+						{
+							Name: "default",
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		"policyWithNegativeMinOnDemandNodes": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotMigrator: &v1alpha1.SpotMigrator{
+					Policies: []v1alpha1.SpotMigrationPolicy{
+						{
+							Name:             "default",
+							MinOnDemandNodes: ptr.Int32(-1),
+						},
+					},
+				},
+			},
+			valid: false,
+		},
+		"policyWithUnknownHealthGateAction": {
+			config: &v1alpha1.CostManagerConfiguration{
+				SpotMigrator: &v1alpha1.SpotMigrator{
+					Policies: []v1alpha1.SpotMigrationPolicy{
+						{
+							Name: "default",
+							HealthGate: &v1alpha1.HealthGate{
+								Action: "Foo",
+							},
+						},
+					},
+				},
+			},
+			valid: false,
+		},
 	}
 	for name, test := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -10,6 +10,8 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/controller-manager/app"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 var (
@@ -17,6 +19,7 @@ var (
 	// https://github.com/kubernetes/cloud-provider/blob/30270693811ff7d3c4646509eed7efd659332e72/names/controller_names.go
 	AllControllerNames = []string{
 		spotMigratorControllerName,
+		spotPreemptionHandlerControllerName,
 		podSafeToEvictAnnotatorControllerName,
 	}
 	// All controllers are disabled by default
@@ -31,15 +34,27 @@ func SetupWithManager(ctx context.Context, mgr ctrl.Manager, config *v1alpha1.Co
 		return errors.Wrapf(err, "failed to create clientset")
 	}
 
+	// The cloud provider is only instantiated if an enabled controller needs it
+	var cloudProvider cloudprovider.CloudProvider
+	getCloudProvider := func() (cloudprovider.CloudProvider, error) {
+		if cloudProvider != nil {
+			return cloudProvider, nil
+		}
+		cloudProvider, err = cloudprovider.NewCloudProvider(ctx, config.CloudProvider, mgr.GetConfig())
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to instantiate cloud provider")
+		}
+		return cloudProvider, nil
+	}
+
 	// Setup controllers
 	for _, controllerName := range AllControllerNames {
 		if app.IsControllerEnabled(controllerName, disabledByDefaultControllerNames, config.Controllers) {
 			switch controllerName {
 			case spotMigratorControllerName:
-				// Instantiate cloud provider
-				cloudProvider, err := cloudprovider.NewCloudProvider(ctx, config.CloudProvider.Name)
+				cloudProvider, err := getCloudProvider()
 				if err != nil {
-					return errors.Wrapf(err, "failed to instantiate cloud provider")
+					return err
 				}
 				err = mgr.Add(&spotMigrator{
 					Config:        config.SpotMigrator,
@@ -49,6 +64,20 @@ func SetupWithManager(ctx context.Context, mgr ctrl.Manager, config *v1alpha1.Co
 				if err != nil {
 					return errors.Wrapf(err, "failed to setup %s", spotMigratorControllerName)
 				}
+			case spotPreemptionHandlerControllerName:
+				cloudProvider, err := getCloudProvider()
+				if err != nil {
+					return err
+				}
+				err = (&spotPreemptionHandler{
+					Config:        config.SpotPreemptionHandler,
+					Client:        mgr.GetClient(),
+					Clientset:     clientset,
+					CloudProvider: cloudProvider,
+				}).SetupWithManager(ctx, mgr)
+				if err != nil {
+					return errors.Wrapf(err, "failed to setup %s", spotPreemptionHandlerControllerName)
+				}
 			case podSafeToEvictAnnotatorControllerName:
 				err := (&podSafeToEvictAnnotator{
 					Config: config.PodSafeToEvictAnnotator,
@@ -57,6 +86,15 @@ func SetupWithManager(ctx context.Context, mgr ctrl.Manager, config *v1alpha1.Co
 				if err != nil {
 					return errors.Wrapf(err, "failed to setup %s", podSafeToEvictAnnotatorControllerName)
 				}
+				if config.PodSafeToEvictAnnotator != nil && config.PodSafeToEvictAnnotator.Webhook != nil {
+					mgr.GetWebhookServer().Register(podSafeToEvictAnnotatorWebhookPath, &webhook.Admission{
+						Handler: &podSafeToEvictAnnotator{
+							Config:  config.PodSafeToEvictAnnotator,
+							Client:  mgr.GetClient(),
+							Decoder: admission.NewDecoder(mgr.GetScheme()),
+						},
+					})
+				}
 			default:
 				return errors.Errorf("unknown controller: %s", controllerName)
 			}
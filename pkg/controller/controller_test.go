@@ -2,12 +2,14 @@ package controller
 
 import (
 	"context"
+	"net/http"
 	"testing"
 
 	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
 	"github.com/hsbc/cost-manager/pkg/cloudprovider"
 	"github.com/hsbc/cost-manager/pkg/kubernetes"
 	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -46,7 +48,18 @@ func TestSetupWithManager(t *testing.T) {
 			// Create manager
 			scheme, err := kubernetes.NewScheme()
 			require.Nil(t, err)
-			mgr, err := ctrl.NewManager(&rest.Config{}, manager.Options{Scheme: scheme})
+			mgr, err := ctrl.NewManager(&rest.Config{}, manager.Options{
+				Scheme: scheme,
+				// Use a static REST mapper since there is no API server to discover resources from;
+				// this is needed to register field indexes
+				MapperProvider: func(*rest.Config, *http.Client) (meta.RESTMapper, error) {
+					mapper := meta.NewDefaultRESTMapper(scheme.PrioritizedVersionsAllGroups())
+					for gvk := range scheme.AllKnownTypes() {
+						mapper.Add(gvk, meta.RESTScopeNamespace)
+					}
+					return mapper, nil
+				},
+			})
 			require.Nil(t, err)
 
 			// Setup manager...
@@ -2,15 +2,28 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
 
+	"github.com/go-logr/logr"
 	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
 	"github.com/hsbc/cost-manager/pkg/kubernetes"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 const (
@@ -19,22 +32,49 @@ const (
 	// We copy the annotation key to avoid depending on the autoscaler respository:
 	// https://github.com/kubernetes/autoscaler/blob/389914758265a33e36683d6df7dbecf91de81802/cluster-autoscaler/utils/drain/drain.go#L33-L35
 	podSafeToEvictAnnotationKey = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+
+	// podSafeToEvictAnnotatorWebhookPath is the path of the mutating admission webhook that
+	// annotates Pods when they are created
+	podSafeToEvictAnnotatorWebhookPath = "/mutate-v1-pod-safe-to-evict"
 )
 
+// ReplicaOwnerKinds are the owner kinds whose replicas can be determined when multiple replicas
+// are required
+var ReplicaOwnerKinds = []string{kubernetes.ReplicaSetKind, kubernetes.StatefulSetKind, kubernetes.DaemonSetKind}
+
 // podSafeToEvictAnnotator adds the `cluster-autoscaler.kubernetes.io/safe-to-evict: "true"`
 // annotation to Pods to ensure that they do not prevent cluster scale down:
 // https://github.com/kubernetes/autoscaler/blob/master/cluster-autoscaler/FAQ.md#what-types-of-pods-can-prevent-ca-from-removing-a-node
 type podSafeToEvictAnnotator struct {
 	Config *v1alpha1.PodSafeToEvictAnnotator
 	Client client.Client
+	// Decoder decodes admission requests and is only required by the webhook
+	Decoder *admission.Decoder
 }
 
 var _ reconcile.Reconciler = &podSafeToEvictAnnotator{}
+var _ admission.Handler = &podSafeToEvictAnnotator{}
 
 func (r *podSafeToEvictAnnotator) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Pod{}).
-		Complete(r)
+	var podPredicates []predicate.Predicate
+	if r.ownerRulesConfigured() {
+		// Pod status changes do not affect whether a Pod is annotated so we only reconcile Pods
+		// when they are created or their labels or annotations change; this avoids looking up the
+		// owner of a Pod and logging the same decision every time the status of a Pod that is not
+		// annotated changes
+		podPredicates = append(podPredicates, predicate.Or(predicate.LabelChangedPredicate{}, predicate.AnnotationChangedPredicate{}))
+	}
+	controllerBuilder := ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Pod{}, builder.WithPredicates(podPredicates...))
+	// Pods that are not annotated because their owner has a single replica need to be reconciled
+	// again when their owner is scaled up
+	if r.Config != nil && r.Config.RequireMultipleReplicas {
+		controllerBuilder = controllerBuilder.
+			Watches(&appsv1.ReplicaSet{}, handler.EnqueueRequestsFromMapFunc(r.mapOwnerToPods), builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+			Watches(&appsv1.StatefulSet{}, handler.EnqueueRequestsFromMapFunc(r.mapOwnerToPods), builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+			Watches(&appsv1.DaemonSet{}, handler.EnqueueRequestsFromMapFunc(r.mapOwnerToPods), builder.WithPredicates(daemonSetDesiredNumberScheduledChangedPredicate()))
+	}
+	return controllerBuilder.Complete(r)
 }
 
 func (r *podSafeToEvictAnnotator) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
@@ -65,6 +105,15 @@ func (r *podSafeToEvictAnnotator) Reconcile(ctx context.Context, request reconci
 		return reconcile.Result{}, err
 	}
 
+	// We do nothing if the Pod does not match the Pod selectors
+	podSelectorMatchesLabels, err := r.podSelectorMatchesLabels(pod)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if !podSelectorMatchesLabels {
+		return reconcile.Result{}, nil
+	}
+
 	// If the annotation is not already set then we set it to true
 	if pod.Annotations == nil {
 		pod.Annotations = map[string]string{}
@@ -73,6 +122,15 @@ func (r *podSafeToEvictAnnotator) Reconcile(ctx context.Context, request reconci
 	if ok {
 		return reconcile.Result{}, nil
 	}
+
+	// We do nothing if the owner rules do not allow the Pod to be annotated
+	ownerRulesAllowAnnotation, err := r.ownerRulesAllowAnnotation(ctx, pod, request.Namespace)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if !ownerRulesAllowAnnotation {
+		return reconcile.Result{}, nil
+	}
 	// https://github.com/kubernetes/autoscaler/blob/389914758265a33e36683d6df7dbecf91de81802/cluster-autoscaler/utils/drain/drain.go#L118-L121
 	pod.Annotations[podSafeToEvictAnnotationKey] = "true"
 
@@ -85,10 +143,106 @@ func (r *podSafeToEvictAnnotator) Reconcile(ctx context.Context, request reconci
 	if err != nil {
 		return reconcile.Result{}, err
 	}
+	if r.ownerRulesConfigured() {
+		podLogger(ctx, pod, request.Namespace).Info("Annotated Pod as safe to evict")
+	}
 
 	return reconcile.Result{}, nil
 }
 
+// daemonSetDesiredNumberScheduledChangedPredicate filters DaemonSet updates that do not change the
+// number of Nodes that the DaemonSet should be running on; unlike the other owner kinds the replicas
+// of a DaemonSet are only recorded in its status
+func daemonSetDesiredNumberScheduledChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldDaemonSet, ok := e.ObjectOld.(*appsv1.DaemonSet)
+			if !ok {
+				return false
+			}
+			newDaemonSet, ok := e.ObjectNew.(*appsv1.DaemonSet)
+			if !ok {
+				return false
+			}
+			return oldDaemonSet.Status.DesiredNumberScheduled != newDaemonSet.Status.DesiredNumberScheduled
+		},
+	}
+}
+
+// mapOwnerToPods maps a workload to the Pods that it controls
+func (r *podSafeToEvictAnnotator) mapOwnerToPods(ctx context.Context, object client.Object) []reconcile.Request {
+	podList := &corev1.PodList{}
+	err := r.Client.List(ctx, podList, client.InNamespace(object.GetNamespace()))
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list Pods", "namespace", object.GetNamespace())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, pod := range podList.Items {
+		ownerReference := metav1.GetControllerOf(&pod)
+		if ownerReference != nil && ownerReference.UID == object.GetUID() {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}})
+		}
+	}
+	return requests
+}
+
+// Handle annotates Pods at admission using the same selectors as the controller. Errors are
+// returned to the API server which should be configured to ignore them since the controller will
+// annotate the Pod after it has been created
+func (r *podSafeToEvictAnnotator) Handle(ctx context.Context, request admission.Request) admission.Response {
+	pod := &corev1.Pod{}
+	err := r.Decoder.Decode(request, pod)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// We do nothing if the annotation is already set...
+	_, ok := pod.Annotations[podSafeToEvictAnnotationKey]
+	if ok {
+		return admission.Allowed("annotation already set")
+	}
+
+	// ...or if the Namespace or Pod do not match the selectors. Note that the Pod may not have its
+	// Namespace set when it is created so we use the Namespace of the request
+	namespace := &corev1.Namespace{}
+	err = r.Client.Get(ctx, types.NamespacedName{Name: request.Namespace}, namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	namespaceSelectorMatchesLabels, err := r.namespaceSelectorMatchesLabels(namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	podSelectorMatchesLabels, err := r.podSelectorMatchesLabels(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if !namespaceSelectorMatchesLabels || !podSelectorMatchesLabels {
+		return admission.Allowed("selectors do not match")
+	}
+	ownerRulesAllowAnnotation, err := r.ownerRulesAllowAnnotation(ctx, pod, request.Namespace)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if !ownerRulesAllowAnnotation {
+		return admission.Allowed("owner rules do not allow annotation")
+	}
+
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[podSafeToEvictAnnotationKey] = "true"
+	marshaledPod, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if r.ownerRulesConfigured() {
+		podLogger(ctx, pod, request.Namespace).Info("Annotating Pod as safe to evict")
+	}
+	return admission.PatchResponseFromRaw(request.Object.Raw, marshaledPod)
+}
+
 func (r *podSafeToEvictAnnotator) namespaceSelectorMatchesLabels(namespace *corev1.Namespace) (bool, error) {
 	// If the Namespace selector is nil then we match all Namespaces...
 	if r.Config == nil || r.Config.NamespaceSelector == nil {
@@ -97,3 +251,120 @@ func (r *podSafeToEvictAnnotator) namespaceSelectorMatchesLabels(namespace *core
 	// ...otherwise we match the Namespace against the selector
 	return kubernetes.SelectorMatchesLabels(r.Config.NamespaceSelector, namespace.Labels)
 }
+
+func (r *podSafeToEvictAnnotator) podSelectorMatchesLabels(pod *corev1.Pod) (bool, error) {
+	if r.Config == nil {
+		return true, nil
+	}
+	// If the Pod selector is nil then we match all Pods...
+	podSelectorMatchesLabels, err := kubernetes.SelectorMatchesLabels(r.Config.PodSelector, pod.Labels)
+	if err != nil || !podSelectorMatchesLabels {
+		return false, err
+	}
+	// ...unless they are excluded; note that we do not exclude any Pods if the exclude selector is
+	// nil since a nil selector matches everything
+	if r.Config.ExcludePodSelector == nil {
+		return true, nil
+	}
+	excludePodSelectorMatchesLabels, err := kubernetes.SelectorMatchesLabels(r.Config.ExcludePodSelector, pod.Labels)
+	if err != nil {
+		return false, err
+	}
+	return !excludePodSelectorMatchesLabels, nil
+}
+
+// ownerRulesAllowAnnotation determines whether the owner kind and replica rules allow the Pod to be
+// annotated and logs the reason if they do not. The Namespace is passed separately since Pods may
+// not have their Namespace set at admission
+func (r *podSafeToEvictAnnotator) ownerRulesAllowAnnotation(ctx context.Context, pod *corev1.Pod, namespace string) (bool, error) {
+	reason, err := r.checkOwnerRules(ctx, pod, namespace)
+	if err != nil {
+		return false, err
+	}
+	if reason != "" {
+		podLogger(ctx, pod, namespace).Info("Not annotating Pod as safe to evict", "reason", reason)
+		return false, nil
+	}
+	return true, nil
+}
+
+// ownerRulesConfigured returns true if any owner kind or replica rules are configured
+func (r *podSafeToEvictAnnotator) ownerRulesConfigured() bool {
+	return r.Config != nil && (len(r.Config.OwnerKinds) > 0 || r.Config.RequireMultipleReplicas)
+}
+
+// podLogger returns a logger for the Pod, identifying it by its generate name if it does not have a
+// name yet
+func podLogger(ctx context.Context, pod *corev1.Pod, namespace string) logr.Logger {
+	logger := log.FromContext(ctx).WithValues("pod", pod.Name, "namespace", namespace)
+	if pod.Name == "" {
+		logger = logger.WithValues("generateName", pod.GenerateName)
+	}
+	return logger
+}
+
+// checkOwnerRules returns a non-empty reason if the owner rules do not allow the Pod to be
+// annotated
+func (r *podSafeToEvictAnnotator) checkOwnerRules(ctx context.Context, pod *corev1.Pod, namespace string) (string, error) {
+	if !r.ownerRulesConfigured() {
+		return "", nil
+	}
+
+	// Pods without a controller will not be recreated elsewhere if they are evicted
+	ownerReference := metav1.GetControllerOf(pod)
+	if ownerReference == nil {
+		return "Pod does not have a controller", nil
+	}
+	if len(r.Config.OwnerKinds) > 0 && !slices.Contains(r.Config.OwnerKinds, ownerReference.Kind) {
+		return fmt.Sprintf("owner kind %s is not allowed", ownerReference.Kind), nil
+	}
+	if !r.Config.RequireMultipleReplicas {
+		return "", nil
+	}
+
+	// Replicas default to 1 if not set
+	replicas := int32(1)
+	switch ownerReference.Kind {
+	case kubernetes.ReplicaSetKind:
+		replicaSet := &appsv1.ReplicaSet{}
+		err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ownerReference.Name}, replicaSet)
+		if errors.IsNotFound(err) {
+			return fmt.Sprintf("owner %s %s not found", ownerReference.Kind, ownerReference.Name), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if replicaSet.Spec.Replicas != nil {
+			replicas = *replicaSet.Spec.Replicas
+		}
+	case kubernetes.StatefulSetKind:
+		statefulSet := &appsv1.StatefulSet{}
+		err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ownerReference.Name}, statefulSet)
+		if errors.IsNotFound(err) {
+			return fmt.Sprintf("owner %s %s not found", ownerReference.Kind, ownerReference.Name), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if statefulSet.Spec.Replicas != nil {
+			replicas = *statefulSet.Spec.Replicas
+		}
+	case kubernetes.DaemonSetKind:
+		// The replicas of a DaemonSet are the number of Nodes that it should be running on
+		daemonSet := &appsv1.DaemonSet{}
+		err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ownerReference.Name}, daemonSet)
+		if errors.IsNotFound(err) {
+			return fmt.Sprintf("owner %s %s not found", ownerReference.Kind, ownerReference.Name), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		replicas = daemonSet.Status.DesiredNumberScheduled
+	default:
+		return fmt.Sprintf("replicas of owner kind %s cannot be determined", ownerReference.Kind), nil
+	}
+	if replicas <= 1 {
+		return fmt.Sprintf("owner %s %s has %d replicas", ownerReference.Kind, ownerReference.Name, replicas), nil
+	}
+	return "", nil
+}
@@ -2,17 +2,23 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 
 	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
 	"github.com/hsbc/cost-manager/pkg/kubernetes"
 	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"knative.dev/pkg/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
 func TestPodSafeToEvictAnnotatorReconcile(t *testing.T) {
@@ -21,6 +27,7 @@ func TestPodSafeToEvictAnnotatorReconcile(t *testing.T) {
 	tests := map[string]struct {
 		pod            *corev1.Pod
 		namespace      *corev1.Namespace
+		owner          client.Object
 		config         *v1alpha1.PodSafeToEvictAnnotator
 		shouldAnnotate bool
 	}{
@@ -130,6 +137,210 @@ func TestPodSafeToEvictAnnotatorReconcile(t *testing.T) {
 			},
 			shouldAnnotate: false,
 		},
+		"annotationMissingWithMatchingPodSelector": {
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+					Labels: map[string]string{
+						"k8s-app": "kube-dns",
+					},
+				},
+			},
+			namespace: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: namespace,
+				},
+			},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				PodSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{
+							Key:      "k8s-app",
+							Operator: "In",
+							Values: []string{
+								"konnectivity-agent",
+								"kube-dns",
+							},
+						},
+					},
+				},
+			},
+			shouldAnnotate: true,
+		},
+		"annotationMissingWithNonMatchingPodSelector": {
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+					Labels: map[string]string{
+						"k8s-app": "metrics-server",
+					},
+				},
+			},
+			namespace: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: namespace,
+				},
+			},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				PodSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{
+							Key:      "k8s-app",
+							Operator: "In",
+							Values: []string{
+								"konnectivity-agent",
+								"kube-dns",
+							},
+						},
+					},
+				},
+			},
+			shouldAnnotate: false,
+		},
+		"annotationMissingWithMatchingExcludePodSelector": {
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+					Labels: map[string]string{
+						"k8s-app": "kube-dns",
+					},
+				},
+			},
+			namespace: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: namespace,
+				},
+			},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				ExcludePodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"k8s-app": "kube-dns",
+					},
+				},
+			},
+			shouldAnnotate: false,
+		},
+		"annotationMissingWithNonMatchingExcludePodSelector": {
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+					Labels: map[string]string{
+						"k8s-app": "konnectivity-agent",
+					},
+				},
+			},
+			namespace: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: namespace,
+				},
+			},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				ExcludePodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"k8s-app": "kube-dns",
+					},
+				},
+			},
+			shouldAnnotate: true,
+		},
+		"ownerKindAllowed": {
+			pod:       newOwnedPod(name, namespace, "ReplicaSet", "foo"),
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				OwnerKinds: []string{"ReplicaSet", "DaemonSet"},
+			},
+			shouldAnnotate: true,
+		},
+		"ownerKindNotAllowed": {
+			pod:       newOwnedPod(name, namespace, "StatefulSet", "foo"),
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				OwnerKinds: []string{"ReplicaSet", "DaemonSet"},
+			},
+			shouldAnnotate: false,
+		},
+		"ownerKindsWithBarePod": {
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+				},
+			},
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				OwnerKinds: []string{"ReplicaSet", "DaemonSet"},
+			},
+			shouldAnnotate: false,
+		},
+		"multipleReplicas": {
+			pod:       newOwnedPod(name, namespace, "ReplicaSet", "foo"),
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}},
+			owner: &appsv1.ReplicaSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: namespace},
+				Spec:       appsv1.ReplicaSetSpec{Replicas: ptr.Int32(2)},
+			},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				RequireMultipleReplicas: true,
+			},
+			shouldAnnotate: true,
+		},
+		"singleReplicaStatefulSet": {
+			pod:       newOwnedPod(name, namespace, "StatefulSet", "foo"),
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}},
+			owner: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: namespace},
+			},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				RequireMultipleReplicas: true,
+			},
+			shouldAnnotate: false,
+		},
+		"multipleReplicasWithDaemonSet": {
+			pod:       newOwnedPod(name, namespace, "DaemonSet", "foo"),
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}},
+			owner: &appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: namespace},
+				Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 3},
+			},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				OwnerKinds:              []string{"ReplicaSet", "DaemonSet"},
+				RequireMultipleReplicas: true,
+			},
+			shouldAnnotate: true,
+		},
+		"singleReplicaDaemonSet": {
+			pod:       newOwnedPod(name, namespace, "DaemonSet", "foo"),
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}},
+			owner: &appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: namespace},
+				Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 1},
+			},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				OwnerKinds:              []string{"ReplicaSet", "DaemonSet"},
+				RequireMultipleReplicas: true,
+			},
+			shouldAnnotate: false,
+		},
+		"multipleReplicasWithMissingOwner": {
+			pod:       newOwnedPod(name, namespace, "ReplicaSet", "foo"),
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				RequireMultipleReplicas: true,
+			},
+			shouldAnnotate: false,
+		},
+		"multipleReplicasWithUnsupportedOwnerKind": {
+			pod:       newOwnedPod(name, namespace, "Job", "foo"),
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				RequireMultipleReplicas: true,
+			},
+			shouldAnnotate: false,
+		},
 		"annotationMissingWithMissingNamespace": {
 			pod: &corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{
@@ -150,6 +361,9 @@ func TestPodSafeToEvictAnnotatorReconcile(t *testing.T) {
 			if test.namespace != nil {
 				objects = append(objects, test.namespace)
 			}
+			if test.owner != nil {
+				objects = append(objects, test.owner)
+			}
 			client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
 
 			// Setup controller
@@ -180,3 +394,179 @@ func TestPodSafeToEvictAnnotatorReconcile(t *testing.T) {
 		})
 	}
 }
+
+func newOwnedPod(name, namespace, ownerKind, ownerName string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: "apps/v1",
+					Kind:       ownerKind,
+					Name:       ownerName,
+					Controller: ptr.Bool(true),
+				},
+			},
+		},
+	}
+}
+
+func TestPodSafeToEvictAnnotatorMapOwnerToPods(t *testing.T) {
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar", UID: "foo"},
+	}
+	ownedPod := newOwnedPod("foo-1", "bar", "ReplicaSet", "foo")
+	ownedPod.OwnerReferences[0].UID = "foo"
+	// Pods with an owner of the same name in another Namespace are not controlled by the ReplicaSet
+	otherNamespacePod := newOwnedPod("foo-1", "baz", "ReplicaSet", "foo")
+	otherNamespacePod.OwnerReferences[0].UID = "baz"
+	otherOwnerPod := newOwnedPod("foo-2", "bar", "ReplicaSet", "qux")
+	otherOwnerPod.OwnerReferences[0].UID = "qux"
+	barePod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo-3", Namespace: "bar"}}
+
+	scheme, err := kubernetes.NewScheme()
+	require.Nil(t, err)
+	client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(replicaSet, ownedPod, otherNamespacePod, otherOwnerPod, barePod).Build()
+	podSafeToEvictAnnotator := &podSafeToEvictAnnotator{
+		Client: client,
+	}
+
+	requests := podSafeToEvictAnnotator.mapOwnerToPods(context.Background(), replicaSet)
+	require.Equal(t, []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "bar", Name: "foo-1"}}}, requests)
+}
+
+func TestPodSafeToEvictAnnotatorHandle(t *testing.T) {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "bar",
+			Labels: map[string]string{
+				"example.com/annotate": "true",
+			},
+		},
+	}
+	tests := map[string]struct {
+		pod            *corev1.Pod
+		config         *v1alpha1.PodSafeToEvictAnnotator
+		shouldAnnotate bool
+	}{
+		"annotationMissing": {
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "foo-",
+				},
+			},
+			shouldAnnotate: true,
+		},
+		"annotationAlreadySet": {
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "foo-",
+					Annotations: map[string]string{
+						"cluster-autoscaler.kubernetes.io/safe-to-evict": "false",
+					},
+				},
+			},
+			shouldAnnotate: false,
+		},
+		"namespaceSelectorMatches": {
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "foo-",
+				},
+			},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"example.com/annotate": "true",
+					},
+				},
+			},
+			shouldAnnotate: true,
+		},
+		"namespaceSelectorDoesNotMatch": {
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "foo-",
+				},
+			},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"example.com/annotate": "false",
+					},
+				},
+			},
+			shouldAnnotate: false,
+		},
+		"ownerKindNotAllowed": {
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "foo-",
+				},
+			},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				OwnerKinds: []string{"ReplicaSet"},
+			},
+			shouldAnnotate: false,
+		},
+		"excludePodSelectorMatches": {
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: "foo-",
+					Labels: map[string]string{
+						"k8s-app": "kube-dns",
+					},
+				},
+			},
+			config: &v1alpha1.PodSafeToEvictAnnotator{
+				ExcludePodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"k8s-app": "kube-dns",
+					},
+				},
+			},
+			shouldAnnotate: false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Create fake client
+			scheme, err := kubernetes.NewScheme()
+			require.Nil(t, err)
+			client := fake.NewClientBuilder().WithScheme(scheme).WithObjects(namespace).Build()
+
+			// Setup webhook handler
+			podSafeToEvictAnnotator := &podSafeToEvictAnnotator{
+				Client:  client,
+				Config:  test.config,
+				Decoder: admission.NewDecoder(scheme),
+			}
+
+			// Send admission request; note that the Pod does not have its Namespace set
+			rawPod, err := json.Marshal(test.pod)
+			require.Nil(t, err)
+			response := podSafeToEvictAnnotator.Handle(context.Background(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Operation: admissionv1.Create,
+					Namespace: namespace.Name,
+					Object:    runtime.RawExtension{Raw: rawPod},
+				},
+			})
+			require.True(t, response.Allowed)
+
+			// Determine whether the Pod has been annotated
+			annotated := false
+			for _, patch := range response.Patches {
+				if patch.Path == "/metadata/annotations" {
+					value, ok := patch.Value.(map[string]interface{})
+					annotated = ok && value["cluster-autoscaler.kubernetes.io/safe-to-evict"] == "true"
+				}
+				if patch.Path == "/metadata/annotations/cluster-autoscaler.kubernetes.io~1safe-to-evict" {
+					annotated = patch.Value == "true"
+				}
+			}
+			require.Equal(t, test.shouldAnnotate, annotated)
+		})
+	}
+}
@@ -16,9 +16,9 @@ import (
 	"github.com/robfig/cron/v3"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	clientgo "k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
@@ -36,6 +36,12 @@ const (
 
 	// https://kubernetes.io/docs/reference/labels-annotations-taints/#node-role-kubernetes-io-control-plane
 	controlPlaneNodeRoleLabelKey = "node-role.kubernetes.io/control-plane"
+
+	// Outcomes of a spot migration run used to label metrics
+	runOutcomeSuccess = "success"
+	runOutcomeFailure = "failure"
+	runOutcomeTimeout = "timeout"
+	runOutcomeSkipped = "skipped"
 )
 
 var (
@@ -47,9 +53,23 @@ var (
 		Name: "cost_manager_spot_migrator_operation_failure_total",
 		Help: "The total number of failed spot-migrator operations",
 	})
+	spotMigratorRunTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cost_manager_spot_migrator_run_total",
+		Help: "The total number of spot-migrator runs by outcome",
+	}, []string{"outcome"})
+
+	// errMaxRunDurationExceeded is returned when a spot migration run is stopped because it has
+	// reached the configured maximum run duration
+	errMaxRunDurationExceeded = errors.New("maximum run duration exceeded")
+	// errPreflightCheckFailed is returned when a spot migration run is skipped because the cloud
+	// provider pre-flight check failed
+	errPreflightCheckFailed = errors.New("pre-flight check failed")
 
 	// Label to add to Nodes before draining to allow them to be identified if we are restarted
 	nodeSelectedForDeletionLabelKey = fmt.Sprintf("%s/%s", v1alpha1.GroupName, "selected-for-deletion")
+	// Label to add to Nodes whose removal has been left to another component by the cloud provider
+	// so that they are not selected for deletion again
+	nodeRemovalDeferredLabelKey = fmt.Sprintf("%s/%s", v1alpha1.GroupName, "removal-deferred")
 )
 
 // spotMigrator periodically drains on-demand Nodes in an attempt to migrate workloads to spot
@@ -61,6 +81,12 @@ type spotMigrator struct {
 	Config        *v1alpha1.SpotMigrator
 	Clientset     clientgo.Interface
 	CloudProvider cloudprovider.CloudProvider
+
+	// The following fields are only set when migrating the Nodes of a single policy
+	policyName            string
+	nodeSelector          labels.Selector
+	excludedNodeSelectors []labels.Selector
+	spotNodeSelector      labels.Selector
 }
 
 var _ manager.Runnable = &spotMigrator{}
@@ -73,6 +99,30 @@ func (sm *spotMigrator) Start(ctx context.Context) error {
 	// Register Prometheus metrics
 	metrics.Registry.MustRegister(spotMigratorOperationSuccessTotal)
 	metrics.Registry.MustRegister(spotMigratorOperationFailureTotal)
+	metrics.Registry.MustRegister(spotMigratorRunTotal)
+	metrics.Registry.MustRegister(spotMigratorNextRunTimestampSeconds)
+	metrics.Registry.MustRegister(spotMigratorPolicyFailureTotal)
+	// Initialise all run outcomes so that they are exported before the first run
+	for _, runOutcome := range []string{runOutcomeSuccess, runOutcomeFailure, runOutcomeTimeout, runOutcomeSkipped} {
+		spotMigratorRunTotal.WithLabelValues(runOutcome)
+	}
+
+	if sm.Config == nil || len(sm.Config.Policies) == 0 {
+		return sm.runOnSchedule(ctx)
+	}
+
+	// Each policy is migrated independently on its own schedule
+	policyMigrators, err := sm.newPolicyMigrators()
+	if err != nil {
+		return err
+	}
+	return runPolicyMigrators(ctx, policyMigrators)
+}
+
+// runOnSchedule runs spot migration on the configured schedule and blocks until the context is
+// cancelled
+func (sm *spotMigrator) runOnSchedule(ctx context.Context) error {
+	logger := log.FromContext(ctx)
 
 	// Parse migration schedule
 	migrationSchedule := defaultMigrationSchedule
@@ -83,29 +133,45 @@ func (sm *spotMigrator) Start(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to parse migration schedule: %s", err)
 	}
+	migrationScheduleOffset, err := sm.migrationScheduleOffset(ctx)
+	if err != nil {
+		return err
+	}
 
 	// If spot-migrator drains itself then any ongoing migration operations will be cancelled. To
 	// mitigate this we first drain and delete any Nodes that have previously been selected for
 	// deletion. Note that we do not run a full migration in this case because otherwise we could
 	// get stuck in a continuous loop of draining and deleting the Node that spot-migrator is
 	// running on; we will need to wait for the next schedule time for the migration to continue
-	onDemandNodes, err := sm.listOnDemandNodes(ctx)
+	onDemandNodes, spotNodes, err := sm.listNodes(ctx)
 	if err != nil {
 		return err
 	}
 	for _, onDemandNode := range onDemandNodes {
 		if isSelectedForDeletion(onDemandNode) {
+			// The guardrail may have been reconfigured or spot Nodes may have been preempted since
+			// the Node was selected so we make sure that it still allows the Node to be deleted
+			if sm.guardrailBreached(onDemandNode, onDemandNodes, spotNodes) {
+				logger.WithValues("node", onDemandNode.Name).Info("Minimum on-demand guardrail would be breached; restoring Node previously selected for deletion")
+				err = sm.restoreNode(ctx, onDemandNode)
+				if err != nil {
+					return err
+				}
+				continue
+			}
 			err = sm.drainAndDeleteNode(ctx, onDemandNode)
 			if err != nil {
 				return err
 			}
+			onDemandNodes = removeNode(onDemandNodes, onDemandNode)
 		}
 	}
 
 	for {
 		// Wait until the next schedule time or the context is cancelled
 		now := time.Now()
-		nextScheduleTime := parsedMigrationSchedule.Next(now)
+		nextScheduleTime := nextMigrationTime(parsedMigrationSchedule, now, migrationScheduleOffset)
+		spotMigratorNextRunTimestampSeconds.WithLabelValues(sm.policyName).Set(float64(nextScheduleTime.Unix()))
 		sleepDuration := nextScheduleTime.Sub(now)
 		logger.WithValues("sleepDuration", sleepDuration.String()).Info("Waiting before next spot migration")
 		select {
@@ -115,12 +181,26 @@ func (sm *spotMigrator) Start(ctx context.Context) error {
 		}
 
 		err := sm.run(ctx)
+		if errors.Is(err, errMaxRunDurationExceeded) {
+			logger.Info("Spot migration stopped after reaching maximum run duration")
+			spotMigratorRunTotal.WithLabelValues(runOutcomeTimeout).Inc()
+			continue
+		}
+		if errors.Is(err, errPreflightCheckFailed) {
+			logger.Info("Spot migration skipped", "reason", err.Error())
+			spotMigratorRunTotal.WithLabelValues(runOutcomeSkipped).Inc()
+			continue
+		}
 		if err != nil {
 			// We do not return the error to make sure other cost-manager processes/controllers
 			// continue to run; we rely on Prometheus metrics to alert us to failures
 			logger.Error(err, "Failed to run spot migration")
 			spotMigratorOperationFailureTotal.Inc()
+			sm.recordPolicyFailure()
+			spotMigratorRunTotal.WithLabelValues(runOutcomeFailure).Inc()
+			continue
 		}
+		spotMigratorRunTotal.WithLabelValues(runOutcomeSuccess).Inc()
 	}
 }
 
@@ -131,6 +211,19 @@ func parseMigrationSchedule(migrationSchedule string) (cron.Schedule, error) {
 // run runs spot migration
 func (sm *spotMigrator) run(ctx context.Context) error {
 	logger := log.FromContext(ctx)
+	canaryVerified := false
+	preflightChecked := false
+	var runDeadline time.Time
+	if sm.Config != nil && sm.Config.MaxRunDuration != nil {
+		runDeadline = time.Now().Add(sm.Config.MaxRunDuration.Duration)
+	}
+	// Waiting for the cluster to become healthy is stopped once the maximum run duration is reached
+	// since no Node is being migrated at that point
+	runCtx, cancelRun := context.WithCancel(ctx)
+	if !runDeadline.IsZero() {
+		runCtx, cancelRun = context.WithDeadline(ctx, runDeadline)
+	}
+	defer cancelRun()
 	for {
 		// If the context has been cancelled then return instead of continuing with the migration
 		select {
@@ -139,8 +232,27 @@ func (sm *spotMigrator) run(ctx context.Context) error {
 		default:
 		}
 
+		// Make sure that the cluster is healthy before draining the next Node
+		err := sm.waitForHealthGate(runCtx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+			logger.Info("Maximum run duration reached while waiting for the cluster to become healthy; stopping spot migration")
+			return errMaxRunDurationExceeded
+		}
+		if err != nil {
+			return err
+		}
+
+		// Do not select another Node once the maximum run duration has been reached
+		if !runDeadline.IsZero() && !time.Now().Before(runDeadline) {
+			logger.Info("Maximum run duration reached; stopping spot migration")
+			return errMaxRunDurationExceeded
+		}
+
 		// List on-demand Nodes before draining
-		beforeDrainOnDemandNodes, err := sm.listOnDemandNodes(ctx)
+		beforeDrainOnDemandNodes, spotNodes, err := sm.listNodes(ctx)
 		if err != nil {
 			return err
 		}
@@ -152,12 +264,50 @@ func (sm *spotMigrator) run(ctx context.Context) error {
 			return nil
 		}
 
+		// Before draining the first Node make sure that the cloud provider is able to replace the
+		// on-demand Nodes with spot Nodes
+		if !preflightChecked {
+			err = sm.preflightCheck(ctx, beforeDrainOnDemandNodes, spotNodes)
+			if err != nil {
+				return err
+			}
+			preflightChecked = true
+		}
+
+		// Only consider Nodes that can be deleted without breaching the minimum on-demand guardrail
+		candidateNodes := []*corev1.Node{}
+		for _, node := range beforeDrainOnDemandNodes {
+			if !sm.guardrailBreached(node, beforeDrainOnDemandNodes, spotNodes) {
+				candidateNodes = append(candidateNodes, node)
+			}
+		}
+		if len(candidateNodes) == 0 {
+			logger.Info("Minimum on-demand guardrail reached; spot migration complete")
+			// Increment success metric since we have migrated as much as we are allowed to
+			spotMigratorOperationSuccessTotal.Inc()
+			return nil
+		}
+
+		// Only consider Nodes that the cloud provider allows to be disrupted
+		candidateNodes, err = sm.filterDisruptableNodes(ctx, candidateNodes)
+		if err != nil {
+			return err
+		}
+		if len(candidateNodes) == 0 {
+			logger.Info("No on-demand Nodes can currently be disrupted; spot migration complete")
+			// Increment success metric since we have migrated as much as we are allowed to
+			spotMigratorOperationSuccessTotal.Inc()
+			return nil
+		}
+
 		// Select one of the on-demand Nodes to delete
-		onDemandNode, err := selectNodeForDeletion(beforeDrainOnDemandNodes)
+		onDemandNode, err := selectNodeForDeletion(candidateNodes)
 		if err != nil {
 			return err
 		}
 
+		sm.logInstanceInfo(ctx, onDemandNode)
+
 		// Just before we drain and delete the Node we label it. If we happen to drain ourself this
 		// will allow us to identify the Node again and continue after rescheduling
 		err = sm.addSelectedForDeletionLabel(ctx, onDemandNode.Name)
@@ -165,12 +315,64 @@ func (sm *spotMigrator) run(ctx context.Context) error {
 			return err
 		}
 
-		// Drain and delete Node
-		err = sm.drainAndDeleteNode(ctx, onDemandNode)
+		// If this is the canary Node then we record the workloads running on it before draining so
+		// that we can verify that they recover afterwards
+		isCanaryNode := sm.isCanaryEnabled() && !canaryVerified
+		var canaryWorkloads []kubernetes.WorkloadReference
+		if isCanaryNode {
+			canaryWorkloads, err = kubernetes.ListNodeWorkloads(ctx, sm.Clientset, onDemandNode.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Drain Node. If the maximum run duration is reached while draining and we are configured
+		// to roll back then we stop draining and make the Node schedulable again
+		drainCtx := ctx
+		if sm.isRollbackOnMaxRunDuration() {
+			drainCtx = runCtx
+		}
+		err = sm.drainNode(drainCtx, onDemandNode)
+		if err != nil && ctx.Err() == nil && errors.Is(drainCtx.Err(), context.DeadlineExceeded) {
+			logger.WithValues("node", onDemandNode.Name).Info("Maximum run duration reached while draining; rolling back")
+			err = sm.restoreNode(ctx, onDemandNode)
+			if err != nil {
+				return err
+			}
+			return errMaxRunDurationExceeded
+		}
+		if err != nil {
+			return err
+		}
+
+		// Delete Node
+		err = sm.deleteNode(ctx, onDemandNode)
 		if err != nil {
 			return err
 		}
 
+		// Abort the migration if any of the workloads evicted from the canary Node do not recover
+		if isCanaryNode {
+			// Verifying the canary Node is part of migrating it so we only stop waiting once the
+			// maximum run duration is reached if we are configured to stop in-flight migrations
+			canaryCtx := ctx
+			if sm.isRollbackOnMaxRunDuration() {
+				canaryCtx = runCtx
+			}
+			err = sm.waitForCanaryWorkloads(canaryCtx, canaryWorkloads)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(canaryCtx.Err(), context.DeadlineExceeded) {
+				logger.Info("Maximum run duration reached while waiting for canary workloads to recover; stopping spot migration")
+				return errMaxRunDurationExceeded
+			}
+			if err != nil {
+				return errors.Wrap(err, "canary migration failed")
+			}
+			canaryVerified = true
+		}
+
 		// List on-demand Nodes after draining
 		afterDrainOnDemandNodes, err := sm.listOnDemandNodes(ctx)
 		if err != nil {
@@ -186,27 +388,117 @@ func (sm *spotMigrator) run(ctx context.Context) error {
 	}
 }
 
+// isRollbackOnMaxRunDuration returns true if an in-flight migration should be stopped once the
+// maximum run duration is reached
+func (sm *spotMigrator) isRollbackOnMaxRunDuration() bool {
+	return sm.Config != nil && sm.Config.MaxRunDurationAction == v1alpha1.MaxRunDurationActionRollback
+}
+
 // listOnDemandNodes lists all Nodes that are not backed by a spot instance
 func (sm *spotMigrator) listOnDemandNodes(ctx context.Context) ([]*corev1.Node, error) {
+	onDemandNodes, _, err := sm.listNodes(ctx)
+	return onDemandNodes, err
+}
+
+// listNodes lists all Nodes that are not part of the control plane, split by whether or not they
+// are backed by a spot instance. Only on-demand Nodes managed by this policy are returned whereas
+// spot Nodes are returned for the whole cluster since the spot Nodes that replace on-demand Nodes
+// are typically in a different node pool that the policy does not select; the minimum on-demand
+// guardrail only counts the spot Nodes managed by this policy
+func (sm *spotMigrator) listNodes(ctx context.Context) ([]*corev1.Node, []*corev1.Node, error) {
 	nodeList, err := sm.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	onDemandNodes := []*corev1.Node{}
+	spotNodes := []*corev1.Node{}
 	for _, node := range nodeList.Items {
 		// We always ignore control plane Nodes to make sure that we do not drain them
 		if isControlPlaneNode(&node) {
 			continue
 		}
+		// Nodes whose removal has been deferred have already been drained and are expected to be
+		// removed by another component
+		if isRemovalDeferred(&node) {
+			continue
+		}
 		isSpotInstance, err := sm.CloudProvider.IsSpotInstance(ctx, &node)
 		if err != nil {
-			return onDemandNodes, err
+			return onDemandNodes, spotNodes, err
+		}
+		if isSpotInstance {
+			spotNodes = append(spotNodes, node.DeepCopy())
+			continue
 		}
-		if !isSpotInstance {
+		// Ignore on-demand Nodes that are not managed by this policy
+		if sm.managesNode(&node) {
 			onDemandNodes = append(onDemandNodes, node.DeepCopy())
 		}
 	}
-	return onDemandNodes, nil
+	return onDemandNodes, spotNodes, nil
+}
+
+// filterDisruptableNodes removes any Nodes that the cloud provider does not currently allow to be
+// disrupted
+func (sm *spotMigrator) filterDisruptableNodes(ctx context.Context, nodes []*corev1.Node) ([]*corev1.Node, error) {
+	disruptionChecker, ok := sm.CloudProvider.(cloudprovider.DisruptionChecker)
+	if !ok {
+		return nodes, nil
+	}
+	disruptableNodes := []*corev1.Node{}
+	for _, node := range nodes {
+		canDisruptNode, err := disruptionChecker.CanDisruptNode(ctx, node)
+		if err != nil {
+			return nil, err
+		}
+		if canDisruptNode {
+			disruptableNodes = append(disruptableNodes, node)
+		}
+	}
+	return disruptableNodes, nil
+}
+
+// preflightCheck returns errPreflightCheckFailed if the cloud provider pre-flight check fails
+func (sm *spotMigrator) preflightCheck(ctx context.Context, onDemandNodes, spotNodes []*corev1.Node) error {
+	preflightChecker, ok := sm.CloudProvider.(cloudprovider.PreflightChecker)
+	if !ok {
+		return nil
+	}
+	reason, err := preflightChecker.PreflightCheck(ctx, onDemandNodes, spotNodes)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return errors.Wrap(errPreflightCheckFailed, reason)
+	}
+	return nil
+}
+
+// logInstanceInfo logs information about the underlying instance of the Node selected for deletion
+// if the cloud provider supports it; failing to retrieve this information does not prevent the
+// Node from being migrated
+func (sm *spotMigrator) logInstanceInfo(ctx context.Context, node *corev1.Node) {
+	instanceInfoProvider, ok := sm.CloudProvider.(cloudprovider.InstanceInfoProvider)
+	if !ok {
+		return
+	}
+	logger := log.FromContext(ctx, "node", node.Name)
+	instanceInfo, err := instanceInfoProvider.GetInstanceInfo(ctx, node)
+	if err != nil {
+		logger.Error(err, "Failed to get instance information")
+		return
+	}
+	keysAndValues := []interface{}{
+		"machineType", instanceInfo.MachineType,
+		"zone", instanceInfo.Zone,
+		"nodeGroup", instanceInfo.NodeGroup,
+		"provisioningModel", instanceInfo.ProvisioningModel,
+		"creationTime", instanceInfo.CreationTime,
+	}
+	if instanceInfo.HourlyPrice != nil {
+		keysAndValues = append(keysAndValues, "hourlyPrice", *instanceInfo.HourlyPrice)
+	}
+	logger.Info("Selected Node for deletion", keysAndValues...)
 }
 
 // isControlPlaneNode returns true if the Node is part of the Kubernetes control plane
@@ -217,17 +509,39 @@ func isControlPlaneNode(node *corev1.Node) bool {
 
 // drainAndDeleteNode drains the specified Node and deletes the underlying instance
 func (sm *spotMigrator) drainAndDeleteNode(ctx context.Context, node *corev1.Node) error {
+	err := sm.drainNode(ctx, node)
+	if err != nil {
+		return err
+	}
+	return sm.deleteNode(ctx, node)
+}
+
+// drainNode drains the specified Node
+func (sm *spotMigrator) drainNode(ctx context.Context, node *corev1.Node) error {
 	logger := log.FromContext(ctx, "node", node.Name)
 
 	logger.Info("Draining Node")
-	err := kubernetes.DrainNode(ctx, sm.Clientset, node)
+	var err error
+	if sm.Config != nil && sm.Config.DrainTimeout != nil {
+		err = kubernetes.DrainNodeWithTimeout(ctx, sm.Clientset, node, sm.Config.DrainTimeout.Duration)
+	} else {
+		err = kubernetes.DrainNode(ctx, sm.Clientset, node)
+	}
 	if err != nil {
 		return err
 	}
 	logger.Info("Drained Node successfully")
 
+	return nil
+}
+
+// deleteNode deletes the underlying instance of a drained Node and waits for the Node object to be
+// deleted unless the cloud provider defers its removal
+func (sm *spotMigrator) deleteNode(ctx context.Context, node *corev1.Node) error {
+	logger := log.FromContext(ctx, "node", node.Name)
+
 	logger.Info("Adding taint ToBeDeletedByClusterAutoscaler")
-	err = sm.addToBeDeletedTaint(ctx, node)
+	err := sm.addToBeDeletedTaint(ctx, node)
 	if err != nil {
 		return err
 	}
@@ -238,6 +552,9 @@ func (sm *spotMigrator) drainAndDeleteNode(ctx context.Context, node *corev1.Nod
 	if err != nil {
 		return err
 	}
+	if sm.removalDeferred() {
+		return sm.deferNodeRemoval(ctx, node)
+	}
 	logger.Info("Instance deleted successfully")
 
 	// Since the underlying instance has been deleted we expect the Node object to be deleted from
@@ -256,6 +573,46 @@ func (sm *spotMigrator) drainAndDeleteNode(ctx context.Context, node *corev1.Nod
 	return nil
 }
 
+// removalDeferred determines whether the cloud provider leaves the removal of Nodes to another
+// component
+func (sm *spotMigrator) removalDeferred() bool {
+	removalDeferrer, ok := sm.CloudProvider.(cloudprovider.RemovalDeferrer)
+	return ok && removalDeferrer.RemovalDeferred()
+}
+
+// deferNodeRemoval leaves the removal of a drained Node to another component (e.g. the cluster
+// autoscaler). We do not wait for the Node object to be deleted since this may never happen (e.g.
+// if its node group is at its minimum size) and we remove the ToBeDeletedByClusterAutoscaler taint
+// since the cluster autoscaler assumes that Nodes with the taint are already being deleted and
+// would therefore never remove the Node itself. The Node is labelled so that it is not selected for
+// deletion again
+func (sm *spotMigrator) deferNodeRemoval(ctx context.Context, node *corev1.Node) error {
+	logger := log.FromContext(ctx, "node", node.Name)
+
+	patch := []byte(fmt.Sprintf(`{"metadata":{"labels":{"%s":"true"}}}`, nodeRemovalDeferredLabelKey))
+	_, err := sm.Clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Removing taint ToBeDeletedByClusterAutoscaler")
+	err = kubernetes.RemoveToBeDeletedTaint(ctx, sm.Clientset, node.Name)
+	if err != nil {
+		return err
+	}
+	logger.Info("Node removal deferred by cloud provider")
+
+	return nil
+}
+
+func isRemovalDeferred(node *corev1.Node) bool {
+	if node.Labels == nil {
+		return false
+	}
+	value, ok := node.Labels[nodeRemovalDeferredLabelKey]
+	return ok && value == "true"
+}
+
 func (sm *spotMigrator) addSelectedForDeletionLabel(ctx context.Context, nodeName string) error {
 	patch := []byte(fmt.Sprintf(`{"metadata":{"labels":{"%s":"true"}}}`, nodeSelectedForDeletionLabelKey))
 	_, err := sm.Clientset.CoreV1().Nodes().Patch(ctx, nodeName, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
@@ -265,6 +622,32 @@ func (sm *spotMigrator) addSelectedForDeletionLabel(ctx context.Context, nodeNam
 	return nil
 }
 
+// restoreNode reverts a Node that was previously selected for deletion back to a schedulable state
+func (sm *spotMigrator) restoreNode(ctx context.Context, node *corev1.Node) error {
+	logger := log.FromContext(ctx, "node", node.Name)
+
+	logger.Info("Removing taint ToBeDeletedByClusterAutoscaler")
+	err := kubernetes.RemoveToBeDeletedTaint(ctx, sm.Clientset, node.Name)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Uncordoning Node")
+	err = kubernetes.UncordonNode(ctx, sm.Clientset, node)
+	if err != nil {
+		return err
+	}
+
+	patch := []byte(fmt.Sprintf(`{"metadata":{"labels":{"%s":null}}}`, nodeSelectedForDeletionLabelKey))
+	_, err = sm.Clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	logger.Info("Node restored successfully")
+
+	return nil
+}
+
 func isSelectedForDeletion(node *corev1.Node) bool {
 	if node.Labels == nil {
 		return false
@@ -273,38 +656,9 @@ func isSelectedForDeletion(node *corev1.Node) bool {
 	return ok && value == "true"
 }
 
-// addToBeDeletedTaint adds the ToBeDeletedByClusterAutoscaler taint to the Node to tell kube-proxy
-// to start failing its healthz and subsequently load balancer health checks depending on provider:
-// https://github.com/kubernetes/enhancements/tree/27ef0d9a740ae5058472aac4763483f0e7218c0e/keps/sig-network/3836-kube-proxy-improved-ingress-connectivity-reliability
+// addToBeDeletedTaint adds the ToBeDeletedByClusterAutoscaler taint to the Node
 func (sm *spotMigrator) addToBeDeletedTaint(ctx context.Context, node *corev1.Node) error {
-	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		node, err := sm.Clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
-		if err != nil {
-			return err
-		}
-
-		hasToBeDeletedTaint := false
-		for _, taint := range node.Spec.Taints {
-			if taint.Key == kubernetes.ToBeDeletedTaint {
-				hasToBeDeletedTaint = true
-				break
-			}
-		}
-		if !hasToBeDeletedTaint {
-			// https://github.com/kubernetes/autoscaler/blob/5bf33b23f2bcf5f9c8ccaf99d445e25366ee7f40/cluster-autoscaler/utils/taints/taints.go#L166-L174
-			node.Spec.Taints = append(node.Spec.Taints, corev1.Taint{
-				Key:    kubernetes.ToBeDeletedTaint,
-				Value:  fmt.Sprint(time.Now().Unix()),
-				Effect: corev1.TaintEffectNoSchedule,
-			})
-			_, err := sm.Clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
-			if err != nil {
-				return err
-			}
-		}
-
-		return nil
-	})
+	return kubernetes.AddToBeDeletedTaint(ctx, sm.Clientset, node.Name)
 }
 
 // selectNodeForDeletion attempts the find the best Node to delete using the following algorithm:
@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hsbc/cost-manager/pkg/kubernetes"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// By default we give evicted workloads 15 minutes to recover which should be enough time for
+	// the cluster autoscaler to add a new Node and for the workloads to be scheduled
+	defaultCanaryTimeout = 15 * time.Minute
+
+	canaryPollInterval = 10 * time.Second
+)
+
+func (sm *spotMigrator) isCanaryEnabled() bool {
+	return sm.Config != nil && sm.Config.Canary != nil
+}
+
+// waitForCanaryWorkloads waits for all workloads evicted from the canary Node to become fully
+// available again and returns an error if any are still degraded once the canary timeout expires
+func (sm *spotMigrator) waitForCanaryWorkloads(ctx context.Context, workloads []kubernetes.WorkloadReference) error {
+	logger := log.FromContext(ctx)
+
+	timeout := defaultCanaryTimeout
+	if sm.Config.Canary.Timeout != nil {
+		timeout = sm.Config.Canary.Timeout.Duration
+	}
+	deadline := time.Now().Add(timeout)
+
+	logger.WithValues("workloadCount", len(workloads), "timeout", timeout.String()).Info("Waiting for canary workloads to recover")
+	for {
+		degradedWorkloads := []string{}
+		for _, workload := range workloads {
+			available, err := kubernetes.IsWorkloadFullyAvailable(ctx, sm.Clientset, workload)
+			if err != nil {
+				return err
+			}
+			if !available {
+				degradedWorkloads = append(degradedWorkloads, workload.String())
+			}
+		}
+		if len(degradedWorkloads) == 0 {
+			logger.Info("Canary workloads recovered successfully")
+			return nil
+		}
+
+		if time.Now().Add(canaryPollInterval).After(deadline) {
+			return errors.Errorf("canary workloads failed to recover within %s: %s", timeout, strings.Join(degradedWorkloads, ", "))
+		}
+		logger.WithValues("degradedWorkloads", degradedWorkloads).Info("Waiting for canary workloads to recover")
+		select {
+		case <-time.After(canaryPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
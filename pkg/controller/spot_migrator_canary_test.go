@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/hsbc/cost-manager/pkg/kubernetes"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"knative.dev/pkg/ptr"
+)
+
+func TestWaitForCanaryWorkloads(t *testing.T) {
+	tests := map[string]struct {
+		deployment *appsv1.Deployment
+		recovered  bool
+	}{
+		"recovered": {
+			deployment: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "test"},
+				Spec:       appsv1.DeploymentSpec{Replicas: ptr.Int32(1)},
+				Status:     appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 1},
+			},
+			recovered: true,
+		},
+		"degraded": {
+			deployment: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "test"},
+				Spec:       appsv1.DeploymentSpec{Replicas: ptr.Int32(1)},
+				Status:     appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 0},
+			},
+			recovered: false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm := &spotMigrator{
+				Config: &v1alpha1.SpotMigrator{
+					// Use a zero timeout so that we do not wait for degraded workloads to recover
+					Canary: &v1alpha1.Canary{Timeout: &metav1.Duration{}},
+				},
+				Clientset: fake.NewSimpleClientset(test.deployment),
+			}
+			err := sm.waitForCanaryWorkloads(context.Background(), []kubernetes.WorkloadReference{
+				{Kind: "Deployment", Namespace: "test", Name: "test"},
+			})
+			require.Equal(t, test.recovered, err == nil)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// onDemandGuardrailBreached determines whether deleting the specified on-demand Node would leave
+// fewer on-demand Nodes than allowed by the minimum on-demand guardrail. We assume that the deleted
+// Node will be replaced by a spot Node so the total number of Nodes does not change
+func onDemandGuardrailBreached(config *v1alpha1.SpotMigrator, node *corev1.Node, onDemandNodes, spotNodes []*corev1.Node) bool {
+	if config == nil || (config.MinOnDemandNodes == nil && config.MinOnDemandFraction == nil) {
+		return false
+	}
+
+	// If the guardrail applies per zone then we only consider Nodes in the same zone
+	if config.MinOnDemandPerZone {
+		zone := node.Labels[corev1.LabelTopologyZone]
+		onDemandNodes = filterNodesByZone(onDemandNodes, zone)
+		spotNodes = filterNodesByZone(spotNodes, zone)
+	}
+
+	remainingOnDemandNodeCount := len(onDemandNodes) - 1
+	nodeCount := len(onDemandNodes) + len(spotNodes)
+
+	if config.MinOnDemandNodes != nil && remainingOnDemandNodeCount < int(*config.MinOnDemandNodes) {
+		return true
+	}
+	if config.MinOnDemandFraction != nil && nodeCount > 0 &&
+		float64(remainingOnDemandNodeCount)/float64(nodeCount) < *config.MinOnDemandFraction {
+		return true
+	}
+
+	return false
+}
+
+// guardrailBreached determines whether deleting the specified on-demand Node would breach the
+// minimum on-demand guardrail of this spot migrator. Only the spot Nodes selected by the spot Node
+// selector of a policy, or managed by this spot migrator if it is not set, are counted so that the
+// guardrail of a policy is not diluted by the spot Nodes of the rest of the cluster
+func (sm *spotMigrator) guardrailBreached(node *corev1.Node, onDemandNodes, spotNodes []*corev1.Node) bool {
+	policySpotNodes := []*corev1.Node{}
+	for _, spotNode := range spotNodes {
+		if sm.spotNodeSelector != nil && sm.spotNodeSelector.Matches(labels.Set(spotNode.Labels)) ||
+			sm.spotNodeSelector == nil && sm.managesNode(spotNode) {
+			policySpotNodes = append(policySpotNodes, spotNode)
+		}
+	}
+	return onDemandGuardrailBreached(sm.Config, node, onDemandNodes, policySpotNodes)
+}
+
+func filterNodesByZone(nodes []*corev1.Node, zone string) []*corev1.Node {
+	filteredNodes := []*corev1.Node{}
+	for _, node := range nodes {
+		if node.Labels[corev1.LabelTopologyZone] == zone {
+			filteredNodes = append(filteredNodes, node)
+		}
+	}
+	return filteredNodes
+}
+
+// removeNode returns the list of Nodes without the specified Node
+func removeNode(nodes []*corev1.Node, node *corev1.Node) []*corev1.Node {
+	remainingNodes := []*corev1.Node{}
+	for _, n := range nodes {
+		if n.UID != node.UID || n.Name != node.Name {
+			remainingNodes = append(remainingNodes, n)
+		}
+	}
+	return remainingNodes
+}
@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	cloudproviderfake "github.com/hsbc/cost-manager/pkg/cloudprovider/fake"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"knative.dev/pkg/ptr"
+)
+
+func generateZonalNodes(prefix, zone string, count int) []*corev1.Node {
+	nodes := []*corev1.Node{}
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("%s-%s-%d", prefix, zone, i)
+		nodes = append(nodes, &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				UID:  types.UID(name),
+				Labels: map[string]string{
+					corev1.LabelTopologyZone: zone,
+				},
+			},
+		})
+	}
+	return nodes
+}
+
+func TestOnDemandGuardrailBreached(t *testing.T) {
+	tests := map[string]struct {
+		config        *v1alpha1.SpotMigrator
+		onDemandNodes []*corev1.Node
+		spotNodes     []*corev1.Node
+		breached      bool
+	}{
+		"nilConfig": {
+			config:        nil,
+			onDemandNodes: generateZonalNodes("on-demand", "a", 1),
+			breached:      false,
+		},
+		"noGuardrail": {
+			config:        &v1alpha1.SpotMigrator{},
+			onDemandNodes: generateZonalNodes("on-demand", "a", 1),
+			breached:      false,
+		},
+		"minOnDemandNodesNotBreached": {
+			config: &v1alpha1.SpotMigrator{
+				MinOnDemandNodes: ptr.Int32(1),
+			},
+			onDemandNodes: generateZonalNodes("on-demand", "a", 2),
+			breached:      false,
+		},
+		"minOnDemandNodesBreached": {
+			config: &v1alpha1.SpotMigrator{
+				MinOnDemandNodes: ptr.Int32(2),
+			},
+			onDemandNodes: generateZonalNodes("on-demand", "a", 2),
+			breached:      true,
+		},
+		"minOnDemandFractionNotBreached": {
+			config: &v1alpha1.SpotMigrator{
+				MinOnDemandFraction: ptr.Float64(0.2),
+			},
+			onDemandNodes: generateZonalNodes("on-demand", "a", 3),
+			spotNodes:     generateZonalNodes("spot", "a", 7),
+			breached:      false,
+		},
+		"minOnDemandFractionBreached": {
+			config: &v1alpha1.SpotMigrator{
+				MinOnDemandFraction: ptr.Float64(0.25),
+			},
+			onDemandNodes: generateZonalNodes("on-demand", "a", 3),
+			spotNodes:     generateZonalNodes("spot", "a", 7),
+			breached:      true,
+		},
+		"minOnDemandNodesNotBreachedInZone": {
+			config: &v1alpha1.SpotMigrator{
+				MinOnDemandNodes:   ptr.Int32(1),
+				MinOnDemandPerZone: true,
+			},
+			onDemandNodes: append(generateZonalNodes("on-demand", "a", 2), generateZonalNodes("on-demand", "b", 1)...),
+			breached:      false,
+		},
+		"minOnDemandNodesBreachedInZone": {
+			config: &v1alpha1.SpotMigrator{
+				MinOnDemandNodes:   ptr.Int32(1),
+				MinOnDemandPerZone: true,
+			},
+			onDemandNodes: append(generateZonalNodes("on-demand", "a", 1), generateZonalNodes("on-demand", "b", 2)...),
+			breached:      true,
+		},
+		"minOnDemandFractionBreachedInZone": {
+			config: &v1alpha1.SpotMigrator{
+				MinOnDemandFraction: ptr.Float64(0.5),
+				MinOnDemandPerZone:  true,
+			},
+			onDemandNodes: append(generateZonalNodes("on-demand", "a", 2), generateZonalNodes("on-demand", "b", 4)...),
+			spotNodes:     append(generateZonalNodes("spot", "a", 2), generateZonalNodes("spot", "b", 1)...),
+			breached:      true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// We always attempt to delete the first on-demand Node
+			breached := onDemandGuardrailBreached(test.config, test.onDemandNodes[0], test.onDemandNodes, test.spotNodes)
+			require.Equal(t, test.breached, breached)
+		})
+	}
+}
+
+func TestSpotMigratorRunStopsAtGuardrail(t *testing.T) {
+	ctx := context.Background()
+
+	onDemandNodes := generateZonalNodes("on-demand", "a", 2)
+	clientset := fake.NewSimpleClientset(onDemandNodes[0], onDemandNodes[1])
+	sm := &spotMigrator{
+		Config: &v1alpha1.SpotMigrator{
+			MinOnDemandNodes: ptr.Int32(2),
+		},
+		Clientset:     clientset,
+		CloudProvider: &cloudproviderfake.CloudProvider{},
+	}
+
+	err := sm.run(ctx)
+	require.Nil(t, err)
+
+	// No Nodes should have been selected for deletion
+	nodeList, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	require.Nil(t, err)
+	for _, node := range nodeList.Items {
+		require.False(t, isSelectedForDeletion(&node))
+		require.False(t, node.Spec.Unschedulable)
+	}
+}
+
+func TestSpotMigratorRestoreNode(t *testing.T) {
+	ctx := context.Background()
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+			Labels: map[string]string{
+				"cost-manager.io/selected-for-deletion": "true",
+			},
+		},
+		Spec: corev1.NodeSpec{
+			Unschedulable: true,
+			Taints: []corev1.Taint{
+				{
+					Key:    "ToBeDeletedByClusterAutoscaler",
+					Effect: corev1.TaintEffectNoSchedule,
+				},
+			},
+		},
+	}
+	sm := &spotMigrator{
+		Clientset: fake.NewSimpleClientset(node),
+	}
+
+	err := sm.restoreNode(ctx, node)
+	require.Nil(t, err)
+
+	node, err = sm.Clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+	require.Nil(t, err)
+	require.False(t, isSelectedForDeletion(node))
+	require.False(t, node.Spec.Unschedulable)
+	require.Empty(t, node.Spec.Taints)
+}
+
+func TestPolicyMigratorsGuardrailBreached(t *testing.T) {
+	ctx := context.Background()
+
+	newNode := func(name, nodePool string, spot bool) *corev1.Node {
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				UID:  types.UID(name),
+				Labels: map[string]string{
+					nodePoolLabelKey: nodePool,
+				},
+			},
+		}
+		if spot {
+			node.Labels[cloudproviderfake.SpotInstanceLabelKey] = cloudproviderfake.SpotInstanceLabelValue
+		}
+		return node
+	}
+	newNodePoolSelector := func(nodePools ...string) *metav1.LabelSelector {
+		return &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{
+					Key:      nodePoolLabelKey,
+					Operator: metav1.LabelSelectorOpIn,
+					Values:   nodePools,
+				},
+			},
+		}
+	}
+	sm := &spotMigrator{
+		Config: &v1alpha1.SpotMigrator{
+			MinOnDemandFraction: ptr.Float64(0.25),
+			Policies: []v1alpha1.SpotMigrationPolicy{
+				{
+					Name:             "small",
+					NodeSelector:     newNodePoolSelector("small"),
+					SpotNodeSelector: newNodePoolSelector("small-spot"),
+				},
+				{
+					Name:             "large",
+					NodeSelector:     newNodePoolSelector("large"),
+					SpotNodeSelector: newNodePoolSelector("large-spot"),
+				},
+			},
+		},
+		Clientset: fake.NewSimpleClientset(
+			newNode("small-0", "small", false),
+			newNode("small-1", "small", false),
+			newNode("small-spot-0", "small-spot", true),
+			newNode("small-spot-1", "small-spot", true),
+			newNode("large-0", "large", false),
+			newNode("large-spot-0", "large-spot", true),
+			newNode("large-spot-1", "large-spot", true),
+			newNode("large-spot-2", "large-spot", true),
+			newNode("large-spot-3", "large-spot", true),
+			newNode("large-spot-4", "large-spot", true),
+			newNode("large-spot-5", "large-spot", true),
+		),
+		CloudProvider: &cloudproviderfake.CloudProvider{},
+	}
+
+	policyMigrators, err := sm.newPolicyMigrators()
+	require.Nil(t, err)
+	require.Len(t, policyMigrators, 2)
+
+	// Deleting a small Node leaves 1 of its 4 Nodes on-demand which satisfies the guardrail as long
+	// as the spot Nodes of the large policy are not counted whereas deleting the only large
+	// on-demand Node breaches the guardrail
+	expectedBreached := map[string]bool{
+		"small": false,
+		"large": true,
+	}
+	for _, policyMigrator := range policyMigrators {
+		onDemandNodes, spotNodes, err := policyMigrator.listNodes(ctx)
+		require.Nil(t, err)
+		breached := policyMigrator.guardrailBreached(onDemandNodes[0], onDemandNodes, spotNodes)
+		require.Equal(t, expectedBreached[policyMigrator.policyName], breached, policyMigrator.policyName)
+	}
+}
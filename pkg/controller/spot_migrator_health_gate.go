@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/hsbc/cost-manager/pkg/kubernetes"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// Pods are given some time to be scheduled before they are counted as Pending to allow for
+	// cluster scale up
+	defaultPendingPodMinAge = 10 * time.Minute
+
+	// By default we wait up to 30 minutes for the cluster to become healthy before aborting
+	defaultHealthGatePauseTimeout = 30 * time.Minute
+
+	healthGatePollInterval = 30 * time.Second
+)
+
+// waitForHealthGate checks the health of the cluster and, depending on the configured action,
+// either returns an error immediately or waits until the cluster becomes healthy again
+func (sm *spotMigrator) waitForHealthGate(ctx context.Context) error {
+	if sm.Config == nil || sm.Config.HealthGate == nil {
+		return nil
+	}
+	healthGate := sm.Config.HealthGate
+	logger := log.FromContext(ctx)
+
+	pauseTimeout := defaultHealthGatePauseTimeout
+	if healthGate.PauseTimeout != nil {
+		pauseTimeout = healthGate.PauseTimeout.Duration
+	}
+	deadline := time.Now().Add(pauseTimeout)
+
+	for {
+		failedChecks, err := sm.checkClusterHealth(ctx, time.Now())
+		if err != nil {
+			return err
+		}
+		if len(failedChecks) == 0 {
+			return nil
+		}
+		logger.WithValues("failedChecks", failedChecks).Info("Cluster health gate failed")
+
+		if healthGate.Action == v1alpha1.HealthGateActionAbort {
+			return errors.Errorf("cluster health gate failed: %s", strings.Join(failedChecks, ", "))
+		}
+		if time.Now().Add(healthGatePollInterval).After(deadline) {
+			return errors.Errorf("cluster health gate failed after waiting %s: %s", pauseTimeout, strings.Join(failedChecks, ", "))
+		}
+
+		logger.WithValues("pollInterval", healthGatePollInterval.String()).Info("Pausing spot migration until cluster is healthy")
+		select {
+		case <-time.After(healthGatePollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// checkClusterHealth runs the configured health checks and returns a description of each check
+// that failed
+func (sm *spotMigrator) checkClusterHealth(ctx context.Context, now time.Time) ([]string, error) {
+	healthGate := sm.Config.HealthGate
+	failedChecks := []string{}
+
+	if healthGate.MaxPendingPods != nil {
+		pendingPodMinAge := defaultPendingPodMinAge
+		if healthGate.PendingPodMinAge != nil {
+			pendingPodMinAge = healthGate.PendingPodMinAge.Duration
+		}
+		// Only Pending Pods are listed to avoid listing every Pod in the cluster on each check
+		podList, err := sm.Clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("status.phase", string(corev1.PodPending)).String(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		pendingPodCount := 0
+		for _, pod := range podList.Items {
+			if pod.Status.Phase == corev1.PodPending && now.Sub(pod.CreationTimestamp.Time) > pendingPodMinAge {
+				pendingPodCount++
+			}
+		}
+		if pendingPodCount > int(*healthGate.MaxPendingPods) {
+			failedChecks = append(failedChecks, fmt.Sprintf("%d Pods have been Pending for longer than %s (maximum %d)", pendingPodCount, pendingPodMinAge, *healthGate.MaxPendingPods))
+		}
+	}
+
+	if healthGate.MaxNotReadyNodes != nil {
+		nodeList, err := sm.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		notReadyNodeCount := 0
+		for _, node := range nodeList.Items {
+			if !isNodeReady(&node) {
+				notReadyNodeCount++
+			}
+		}
+		if notReadyNodeCount > int(*healthGate.MaxNotReadyNodes) {
+			failedChecks = append(failedChecks, fmt.Sprintf("%d Nodes are NotReady (maximum %d)", notReadyNodeCount, *healthGate.MaxNotReadyNodes))
+		}
+	}
+
+	if healthGate.MaxUnavailableDeployments != nil {
+		deploymentList, err := sm.Clientset.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		unavailableDeploymentCount := 0
+		for _, deployment := range deploymentList.Items {
+			// Deployments that have been scaled to zero are always considered available
+			if !kubernetes.IsDeploymentAvailable(&deployment, min(kubernetes.GetDeploymentReplicas(&deployment), 1)) {
+				unavailableDeploymentCount++
+			}
+		}
+		if unavailableDeploymentCount > int(*healthGate.MaxUnavailableDeployments) {
+			failedChecks = append(failedChecks, fmt.Sprintf("%d Deployments have no available replicas (maximum %d)", unavailableDeploymentCount, *healthGate.MaxUnavailableDeployments))
+		}
+	}
+
+	return failedChecks, nil
+}
+
+func isNodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"knative.dev/pkg/ptr"
+)
+
+func TestCheckClusterHealth(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	oldPendingPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "old",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodPending,
+		},
+	}
+	newPendingPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "new",
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(now.Add(-time.Minute)),
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodPending,
+		},
+	}
+	readyNode := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "ready",
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{
+					Type:   corev1.NodeReady,
+					Status: corev1.ConditionTrue,
+				},
+			},
+		},
+	}
+	notReadyNode := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "not-ready",
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{
+					Type:   corev1.NodeReady,
+					Status: corev1.ConditionFalse,
+				},
+			},
+		},
+	}
+	unavailableDeployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "unavailable",
+			Namespace: "default",
+		},
+		Status: appsv1.DeploymentStatus{
+			Conditions: []appsv1.DeploymentCondition{
+				{
+					Type:   appsv1.DeploymentAvailable,
+					Status: corev1.ConditionFalse,
+				},
+			},
+		},
+	}
+	tests := map[string]struct {
+		healthGate *v1alpha1.HealthGate
+		objects    []runtime.Object
+		healthy    bool
+	}{
+		"noChecks": {
+			healthGate: &v1alpha1.HealthGate{},
+			objects:    []runtime.Object{oldPendingPod, notReadyNode, unavailableDeployment},
+			healthy:    true,
+		},
+		"newPendingPod": {
+			healthGate: &v1alpha1.HealthGate{
+				MaxPendingPods: ptr.Int32(0),
+			},
+			objects: []runtime.Object{newPendingPod},
+			healthy: true,
+		},
+		"oldPendingPod": {
+			healthGate: &v1alpha1.HealthGate{
+				MaxPendingPods: ptr.Int32(0),
+			},
+			objects: []runtime.Object{oldPendingPod},
+			healthy: false,
+		},
+		"oldPendingPodWithinThreshold": {
+			healthGate: &v1alpha1.HealthGate{
+				MaxPendingPods: ptr.Int32(1),
+			},
+			objects: []runtime.Object{oldPendingPod},
+			healthy: true,
+		},
+		"oldPendingPodWithLongerMinAge": {
+			healthGate: &v1alpha1.HealthGate{
+				MaxPendingPods:   ptr.Int32(0),
+				PendingPodMinAge: &metav1.Duration{Duration: 2 * time.Hour},
+			},
+			objects: []runtime.Object{oldPendingPod},
+			healthy: true,
+		},
+		"readyNode": {
+			healthGate: &v1alpha1.HealthGate{
+				MaxNotReadyNodes: ptr.Int32(0),
+			},
+			objects: []runtime.Object{readyNode},
+			healthy: true,
+		},
+		"notReadyNode": {
+			healthGate: &v1alpha1.HealthGate{
+				MaxNotReadyNodes: ptr.Int32(0),
+			},
+			objects: []runtime.Object{readyNode, notReadyNode},
+			healthy: false,
+		},
+		"unavailableDeployment": {
+			healthGate: &v1alpha1.HealthGate{
+				MaxUnavailableDeployments: ptr.Int32(0),
+			},
+			objects: []runtime.Object{unavailableDeployment},
+			healthy: false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm := &spotMigrator{
+				Config: &v1alpha1.SpotMigrator{
+					HealthGate: test.healthGate,
+				},
+				Clientset: fake.NewSimpleClientset(test.objects...),
+			}
+			failedChecks, err := sm.checkClusterHealth(context.Background(), now)
+			require.Nil(t, err)
+			require.Equal(t, test.healthy, len(failedChecks) == 0)
+		})
+	}
+}
+
+func TestWaitForHealthGateAbort(t *testing.T) {
+	sm := &spotMigrator{
+		Config: &v1alpha1.SpotMigrator{
+			HealthGate: &v1alpha1.HealthGate{
+				MaxNotReadyNodes: ptr.Int32(0),
+				Action:           v1alpha1.HealthGateActionAbort,
+			},
+		},
+		Clientset: fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "not-ready"}}),
+	}
+	err := sm.waitForHealthGate(context.Background())
+	require.NotNil(t, err)
+}
+
+func TestCheckClusterHealthListsOnlyPendingPods(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	sm := &spotMigrator{
+		Config: &v1alpha1.SpotMigrator{
+			HealthGate: &v1alpha1.HealthGate{
+				MaxPendingPods: ptr.Int32(0),
+			},
+		},
+		Clientset: clientset,
+	}
+	_, err := sm.checkClusterHealth(context.Background(), time.Now())
+	require.Nil(t, err)
+	require.Len(t, clientset.Actions(), 1)
+	listAction, ok := clientset.Actions()[0].(k8stesting.ListAction)
+	require.True(t, ok)
+	require.Equal(t, "status.phase=Pending", listAction.GetListRestrictions().Fields.String())
+}
@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var (
+	spotMigratorPolicyFailureTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cost_manager_spot_migrator_policy_failure_total",
+		Help: "The total number of failed spot migration runs by policy",
+	}, []string{"policy"})
+)
+
+// runPolicyMigrators runs each policy migrator on its own schedule and blocks until they have all
+// returned. Failed migrations do not stop a policy migrator, however a policy migrator returns an
+// error if it cannot start; in that case the other policy migrators are stopped and all errors are
+// returned so that the manager does not keep running with a policy that is not being migrated
+func runPolicyMigrators(ctx context.Context, policyMigrators []*spotMigrator) error {
+	logger := log.FromContext(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	policyErrs := make([]error, len(policyMigrators))
+	var wg sync.WaitGroup
+	for i, policyMigrator := range policyMigrators {
+		policyLogger := logger.WithValues("policy", policyMigrator.policyName)
+		policyCtx := log.IntoContext(ctx, policyLogger)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := policyMigrator.runOnSchedule(policyCtx)
+			if err != nil {
+				policyLogger.Error(err, "Failed to run spot migration policy")
+				policyMigrator.recordPolicyFailure()
+				policyErrs[i] = errors.Wrapf(err, "spot migration policy %s failed", policyMigrator.policyName)
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	return utilerrors.NewAggregate(policyErrs)
+}
+
+// recordPolicyFailure records a failure against the policy if this spot migrator migrates the
+// Nodes of a single policy
+func (sm *spotMigrator) recordPolicyFailure() {
+	if sm.policyName != "" {
+		spotMigratorPolicyFailureTotal.WithLabelValues(sm.policyName).Inc()
+	}
+}
+
+// newPolicyMigrators creates a spot migrator for each configured policy. Each policy migrator only
+// manages the Nodes selected by its policy and not selected by any previous policy, which ensures
+// that a Node is only ever drained by a single policy migrator
+func (sm *spotMigrator) newPolicyMigrators() ([]*spotMigrator, error) {
+	policyMigrators := []*spotMigrator{}
+	previousNodeSelectors := []labels.Selector{}
+	for _, policy := range sm.Config.Policies {
+		nodeSelector := labels.Everything()
+		if policy.NodeSelector != nil {
+			var err error
+			nodeSelector, err = metav1.LabelSelectorAsSelector(policy.NodeSelector)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse Node selector for policy %s", policy.Name)
+			}
+		}
+		var spotNodeSelector labels.Selector
+		if policy.SpotNodeSelector != nil {
+			var err error
+			spotNodeSelector, err = metav1.LabelSelectorAsSelector(policy.SpotNodeSelector)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse spot Node selector for policy %s", policy.Name)
+			}
+		}
+		policyMigrators = append(policyMigrators, &spotMigrator{
+			Config:                policyConfig(sm.Config, policy),
+			Clientset:             sm.Clientset,
+			CloudProvider:         sm.CloudProvider,
+			policyName:            policy.Name,
+			nodeSelector:          nodeSelector,
+			excludedNodeSelectors: append([]labels.Selector{}, previousNodeSelectors...),
+			spotNodeSelector:      spotNodeSelector,
+		})
+		previousNodeSelectors = append(previousNodeSelectors, nodeSelector)
+	}
+	return policyMigrators, nil
+}
+
+// policyConfig returns the spot-migrator configuration for the policy, inheriting any fields that
+// are not set on the policy from the top-level configuration
+func policyConfig(config *v1alpha1.SpotMigrator, policy v1alpha1.SpotMigrationPolicy) *v1alpha1.SpotMigrator {
+	config = config.DeepCopy()
+	config.Policies = nil
+	if policy.MigrationSchedule != nil {
+		config.MigrationSchedule = policy.MigrationSchedule
+	}
+	if policy.MinOnDemandNodes != nil {
+		config.MinOnDemandNodes = policy.MinOnDemandNodes
+	}
+	if policy.MinOnDemandFraction != nil {
+		config.MinOnDemandFraction = policy.MinOnDemandFraction
+	}
+	if policy.MinOnDemandPerZone != nil {
+		config.MinOnDemandPerZone = *policy.MinOnDemandPerZone
+	}
+	if policy.MaxRunDuration != nil {
+		config.MaxRunDuration = policy.MaxRunDuration
+	}
+	if policy.MaxRunDurationAction != "" {
+		config.MaxRunDurationAction = policy.MaxRunDurationAction
+	}
+	if policy.DrainTimeout != nil {
+		config.DrainTimeout = policy.DrainTimeout
+	}
+	if policy.HealthGate != nil {
+		config.HealthGate = policy.HealthGate
+	}
+	if policy.Canary != nil {
+		config.Canary = policy.Canary
+	}
+	return config
+}
+
+// managesNode returns true if the Node should be migrated by this spot migrator
+func (sm *spotMigrator) managesNode(node *corev1.Node) bool {
+	if sm.nodeSelector == nil {
+		return true
+	}
+	nodeLabels := labels.Set(node.Labels)
+	for _, excludedNodeSelector := range sm.excludedNodeSelectors {
+		if excludedNodeSelector.Matches(nodeLabels) {
+			return false
+		}
+	}
+	return sm.nodeSelector.Matches(nodeLabels)
+}
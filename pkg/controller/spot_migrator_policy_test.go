@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	cloudproviderfake "github.com/hsbc/cost-manager/pkg/cloudprovider/fake"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"knative.dev/pkg/ptr"
+)
+
+func TestPolicyConfig(t *testing.T) {
+	config := &v1alpha1.SpotMigrator{
+		MigrationSchedule: ptr.String("@hourly"),
+		MinOnDemandNodes:  ptr.Int32(1),
+		HealthGate: &v1alpha1.HealthGate{
+			MaxNotReadyNodes: ptr.Int32(0),
+		},
+		Policies: []v1alpha1.SpotMigrationPolicy{
+			{
+				Name: "batch",
+			},
+		},
+	}
+	policy := v1alpha1.SpotMigrationPolicy{
+		Name:               "batch",
+		MigrationSchedule:  ptr.String("*/15 * * * *"),
+		MinOnDemandPerZone: ptr.Bool(true),
+		DrainTimeout:       &metav1.Duration{Duration: time.Minute},
+		Canary:             &v1alpha1.Canary{},
+	}
+
+	require.Equal(t, &v1alpha1.SpotMigrator{
+		MigrationSchedule:  ptr.String("*/15 * * * *"),
+		MinOnDemandNodes:   ptr.Int32(1),
+		MinOnDemandPerZone: true,
+		HealthGate: &v1alpha1.HealthGate{
+			MaxNotReadyNodes: ptr.Int32(0),
+		},
+		Canary:       &v1alpha1.Canary{},
+		DrainTimeout: &metav1.Duration{Duration: time.Minute},
+	}, policyConfig(config, policy))
+
+	// The health gate can be overridden by the policy
+	policy.HealthGate = &v1alpha1.HealthGate{MaxPendingPods: ptr.Int32(5)}
+	require.Equal(t, policy.HealthGate, policyConfig(config, policy).HealthGate)
+
+	// The top-level configuration should not be modified
+	require.Equal(t, "@hourly", *config.MigrationSchedule)
+	require.Len(t, config.Policies, 1)
+}
+
+func TestPolicyMigratorsListNodes(t *testing.T) {
+	ctx := context.Background()
+
+	newNode := func(name, nodePool string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Labels: map[string]string{
+					nodePoolLabelKey: nodePool,
+				},
+			},
+		}
+	}
+	newSpotNode := func(name, nodePool string) *corev1.Node {
+		node := newNode(name, nodePool)
+		node.Labels[cloudproviderfake.SpotInstanceLabelKey] = cloudproviderfake.SpotInstanceLabelValue
+		return node
+	}
+	sm := &spotMigrator{
+		Config: &v1alpha1.SpotMigrator{
+			Policies: []v1alpha1.SpotMigrationPolicy{
+				{
+					Name: "batch",
+					NodeSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							nodePoolLabelKey: "batch",
+						},
+					},
+				},
+				{
+					// Nodes selected by previous policies should not be selected again
+					Name: "default",
+				},
+			},
+		},
+		Clientset: fake.NewSimpleClientset(
+			newNode("batch-0", "batch"),
+			newNode("batch-1", "batch"),
+			newNode("ingress-0", "ingress"),
+			newSpotNode("spot-0", "spot"),
+		),
+		CloudProvider: &cloudproviderfake.CloudProvider{},
+	}
+
+	policyMigrators, err := sm.newPolicyMigrators()
+	require.Nil(t, err)
+	require.Len(t, policyMigrators, 2)
+
+	expectedNodeNames := map[string][]string{
+		"batch":   {"batch-0", "batch-1"},
+		"default": {"ingress-0"},
+	}
+	for _, policyMigrator := range policyMigrators {
+		onDemandNodes, spotNodes, err := policyMigrator.listNodes(ctx)
+		require.Nil(t, err)
+		nodeNames := []string{}
+		for _, node := range onDemandNodes {
+			nodeNames = append(nodeNames, node.Name)
+		}
+		require.ElementsMatch(t, expectedNodeNames[policyMigrator.policyName], nodeNames)
+		// Spot Nodes are not filtered by policy since replacement spot Nodes are typically in
+		// node pools that the policy does not select
+		require.Len(t, spotNodes, 1)
+		require.Equal(t, "spot-0", spotNodes[0].Name)
+	}
+}
+
+func TestRunPolicyMigratorsStopsWhenPolicyCannotStart(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	policyMigrators := []*spotMigrator{
+		{
+			Config:        &v1alpha1.SpotMigrator{MigrationSchedule: ptr.String("invalid")},
+			Clientset:     clientset,
+			CloudProvider: &cloudproviderfake.CloudProvider{},
+			policyName:    "invalid",
+		},
+		{
+			Config:        &v1alpha1.SpotMigrator{},
+			Clientset:     clientset,
+			CloudProvider: &cloudproviderfake.CloudProvider{},
+			policyName:    "valid",
+		},
+	}
+
+	errs := make(chan error)
+	go func() {
+		errs <- runPolicyMigrators(ctx, policyMigrators)
+	}()
+
+	// The invalid policy fails immediately which should stop the valid policy
+	var err error
+	select {
+	case err = <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("policy migrators did not return after a policy failed to start")
+	}
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "spot migration policy invalid failed")
+	require.NotContains(t, err.Error(), "spot migration policy valid failed")
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+	"hash/fnv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	spotMigratorNextRunTimestampSeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cost_manager_spot_migrator_next_run_timestamp_seconds",
+		Help: "The Unix time at which the next spot migration is scheduled to run",
+	}, []string{"policy"})
+)
+
+// migrationScheduleOffset returns the offset to apply to the migration schedule. The offset is
+// derived from the UID of the kube-system Namespace so that it is stable for each cluster (and
+// across restarts) but spreads migrations across a fleet of clusters that share the same schedule
+func (sm *spotMigrator) migrationScheduleOffset(ctx context.Context) (time.Duration, error) {
+	if sm.Config == nil || sm.Config.MigrationScheduleJitter == nil || sm.Config.MigrationScheduleJitter.Duration <= 0 {
+		return 0, nil
+	}
+	namespace, err := sm.Clientset.CoreV1().Namespaces().Get(ctx, metav1.NamespaceSystem, metav1.GetOptions{})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get Namespace %s", metav1.NamespaceSystem)
+	}
+	// We include the policy name in the seed so that policies sharing a schedule do not all run at
+	// the same time
+	return jitterOffset(string(namespace.UID)+"/"+sm.policyName, sm.Config.MigrationScheduleJitter.Duration), nil
+}
+
+// jitterOffset deterministically maps the seed to a duration in the range [0, maxJitter)
+func jitterOffset(seed string, maxJitter time.Duration) time.Duration {
+	if maxJitter <= 0 {
+		return 0
+	}
+	hash := fnv.New64a()
+	// Writing to a hash never returns an error
+	_, _ = hash.Write([]byte(seed))
+	return time.Duration(hash.Sum64() % uint64(maxJitter))
+}
+
+// nextMigrationTime returns the next time after now that the schedule is due when shifted by the
+// specified offset
+func nextMigrationTime(schedule cron.Schedule, now time.Time, offset time.Duration) time.Time {
+	return schedule.Next(now.Add(-offset)).Add(offset)
+}
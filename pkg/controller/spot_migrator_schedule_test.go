@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestJitterOffset(t *testing.T) {
+	maxJitter := time.Hour
+	offset := jitterOffset("foo", maxJitter)
+	require.GreaterOrEqual(t, offset, time.Duration(0))
+	require.Less(t, offset, maxJitter)
+	// The offset should be deterministic...
+	require.Equal(t, offset, jitterOffset("foo", maxJitter))
+	// ...but depend on the seed
+	require.NotEqual(t, offset, jitterOffset("bar", maxJitter))
+	require.Equal(t, time.Duration(0), jitterOffset("foo", 0))
+}
+
+func TestNextMigrationTime(t *testing.T) {
+	schedule, err := parseMigrationSchedule("@hourly")
+	require.Nil(t, err)
+	tests := map[string]struct {
+		now      time.Time
+		offset   time.Duration
+		expected time.Time
+	}{
+		"noOffset": {
+			now:      time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC),
+			offset:   0,
+			expected: time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+		},
+		"beforeOffset": {
+			now:      time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC),
+			offset:   20 * time.Minute,
+			expected: time.Date(2024, 1, 1, 0, 20, 0, 0, time.UTC),
+		},
+		"afterOffset": {
+			now:      time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC),
+			offset:   20 * time.Minute,
+			expected: time.Date(2024, 1, 1, 1, 20, 0, 0, time.UTC),
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, test.expected, nextMigrationTime(schedule, test.now, test.offset))
+		})
+	}
+}
+
+func TestMigrationScheduleOffset(t *testing.T) {
+	ctx := context.Background()
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: metav1.NamespaceSystem,
+			UID:  "6f2b4c4e-7c1e-4d5b-9a3e-1f0c2d3b4a5e",
+		},
+	}
+	sm := &spotMigrator{
+		Config: &v1alpha1.SpotMigrator{
+			MigrationScheduleJitter: &metav1.Duration{Duration: time.Hour},
+		},
+		Clientset: fake.NewSimpleClientset(namespace),
+	}
+
+	offset, err := sm.migrationScheduleOffset(ctx)
+	require.Nil(t, err)
+	require.Equal(t, jitterOffset(string(namespace.UID)+"/", time.Hour), offset)
+
+	// Jitter is disabled by default
+	sm.Config = &v1alpha1.SpotMigrator{}
+	offset, err = sm.migrationScheduleOffset(ctx)
+	require.Nil(t, err)
+	require.Equal(t, time.Duration(0), offset)
+}
@@ -2,17 +2,29 @@ package controller
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
 	cloudproviderfake "github.com/hsbc/cost-manager/pkg/cloudprovider/fake"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/gcp"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider/generic"
 	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/fake"
+	"knative.dev/pkg/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
@@ -372,6 +384,7 @@ func TestSpotMigratorPrometheusMetricRegistration(t *testing.T) {
 	require.Nil(t, err)
 	spotMigratorDrainSuccessMetricFound := false
 	spotMigratorDrainFailureMetricFound := false
+	spotMigratorRunMetricFound := false
 	for _, metricFamily := range metricFamilies {
 		// This metric name should match with the corresponding PrometheusRule alert
 		if metricFamily.Name != nil && *metricFamily.Name == "cost_manager_spot_migrator_operation_success_total" {
@@ -380,9 +393,355 @@ func TestSpotMigratorPrometheusMetricRegistration(t *testing.T) {
 		if metricFamily.Name != nil && *metricFamily.Name == "cost_manager_spot_migrator_operation_failure_total" {
 			spotMigratorDrainFailureMetricFound = true
 		}
+		if metricFamily.Name != nil && *metricFamily.Name == "cost_manager_spot_migrator_run_total" {
+			// All run outcomes should be exported before the first run
+			require.Len(t, metricFamily.Metric, 4)
+			spotMigratorRunMetricFound = true
+		}
 	}
 	require.True(t, spotMigratorDrainSuccessMetricFound)
 	require.True(t, spotMigratorDrainFailureMetricFound)
+	require.True(t, spotMigratorRunMetricFound)
+}
+
+func TestSpotMigratorRunStopsAtMaxRunDuration(t *testing.T) {
+	ctx := context.Background()
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+		},
+	}
+	clientset := fake.NewSimpleClientset(node)
+	sm := &spotMigrator{
+		Config: &v1alpha1.SpotMigrator{
+			MaxRunDuration: &metav1.Duration{},
+		},
+		Clientset:     clientset,
+		CloudProvider: &cloudproviderfake.CloudProvider{},
+	}
+
+	err := sm.run(ctx)
+	require.ErrorIs(t, err, errMaxRunDurationExceeded)
+
+	// The Node should not have been selected for deletion
+	node, err = clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+	require.Nil(t, err)
+	require.False(t, isSelectedForDeletion(node))
+}
+
+func TestSpotMigratorRunStopsHealthGateAtMaxRunDuration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	sm := &spotMigrator{
+		Config: &v1alpha1.SpotMigrator{
+			HealthGate: &v1alpha1.HealthGate{
+				MaxNotReadyNodes: ptr.Int32(0),
+				Action:           v1alpha1.HealthGateActionPause,
+				PauseTimeout:     &metav1.Duration{Duration: time.Hour},
+			},
+			MaxRunDuration: &metav1.Duration{Duration: 100 * time.Millisecond},
+		},
+		Clientset:     fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "not-ready"}}),
+		CloudProvider: &cloudproviderfake.CloudProvider{},
+	}
+
+	// We should stop waiting for the cluster to become healthy once the maximum run duration is
+	// reached rather than waiting for the pause timeout
+	err := sm.run(ctx)
+	require.ErrorIs(t, err, errMaxRunDurationExceeded)
+	require.Nil(t, ctx.Err())
+}
+
+func TestSpotMigratorRunStopsCanaryAtMaxRunDuration(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test"}}
+	// The StatefulSet never recovers after its Pod is evicted from the canary Node
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "test"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: ptr.Int32(1)},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-0",
+			Namespace: "test",
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "test", Controller: ptr.Bool(true)},
+			},
+		},
+		Spec: corev1.PodSpec{NodeName: node.Name},
+	}
+	clientset := fake.NewSimpleClientset(node, statefulSet, pod)
+	// Advertise support for the Eviction API so that the Pod can be drained
+	clientset.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{{Name: "pods/eviction", Kind: "Eviction", Group: "policy", Version: "v1"}},
+		},
+	}
+	sm := &spotMigrator{
+		Config: &v1alpha1.SpotMigrator{
+			Canary:               &v1alpha1.Canary{Timeout: &metav1.Duration{Duration: time.Hour}},
+			MaxRunDuration:       &metav1.Duration{Duration: time.Second},
+			MaxRunDurationAction: v1alpha1.MaxRunDurationActionRollback,
+		},
+		Clientset: clientset,
+		CloudProvider: &cloudproviderfake.CloudProvider{
+			Clientset:   clientset,
+			DeleteNodes: true,
+		},
+	}
+
+	// We should stop waiting for the canary workloads to recover once the maximum run duration is
+	// reached rather than waiting for the canary timeout
+	err := sm.run(ctx)
+	require.ErrorIs(t, err, errMaxRunDurationExceeded)
+	require.Nil(t, ctx.Err())
+}
+
+func TestSpotMigratorRunDeleteInstanceError(t *testing.T) {
+	ctx := context.Background()
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+		},
+	}
+	clientset := fake.NewSimpleClientset(node)
+	deleteInstanceErr := errors.New("failed to delete instance")
+	cloudProvider := &cloudproviderfake.CloudProvider{
+		DeleteInstanceErrors: map[string]error{node.Name: deleteInstanceErr},
+	}
+	sm := &spotMigrator{
+		Clientset:     clientset,
+		CloudProvider: cloudProvider,
+	}
+
+	err := sm.run(ctx)
+	require.ErrorIs(t, err, deleteInstanceErr)
+	require.Contains(t, cloudProvider.Calls(), cloudproviderfake.Call{Method: cloudproviderfake.DeleteInstanceMethod, NodeName: node.Name})
+
+	// The Node should not have been deleted
+	_, err = clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+	require.Nil(t, err)
+}
+
+func TestSpotMigratorRunReplacementNodes(t *testing.T) {
+	tests := map[string]struct {
+		replacementCapacityType cloudproviderfake.CapacityType
+		expectedDeletedNodes    []string
+	}{
+		// If the replacement Nodes are spot Nodes then all on-demand Nodes should be migrated
+		"spot": {
+			replacementCapacityType: cloudproviderfake.CapacityTypeSpot,
+			expectedDeletedNodes:    []string{"test-1", "test-2"},
+		},
+		// If an on-demand Node is created while draining then we assume that there are no more spot
+		// instances available and stop after the first Node
+		"onDemand": {
+			replacementCapacityType: cloudproviderfake.CapacityTypeOnDemand,
+			expectedDeletedNodes:    []string{"test-1"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			clientset := fake.NewSimpleClientset(
+				&corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:              "test-1",
+						UID:               "test-1",
+						CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+					},
+				},
+				&corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:              "test-2",
+						UID:               "test-2",
+						CreationTimestamp: metav1.NewTime(time.Now()),
+					},
+				},
+			)
+			cloudProvider := &cloudproviderfake.CloudProvider{
+				Clientset:               clientset,
+				DeleteNodes:             true,
+				ReplacementCapacityType: test.replacementCapacityType,
+			}
+			sm := &spotMigrator{
+				Clientset:     clientset,
+				CloudProvider: cloudProvider,
+			}
+
+			err := sm.run(ctx)
+			require.Nil(t, err)
+
+			deletedNodes := []string{}
+			for _, call := range cloudProvider.Calls() {
+				if call.Method == cloudproviderfake.DeleteInstanceMethod {
+					deletedNodes = append(deletedNodes, call.NodeName)
+				}
+			}
+			require.Equal(t, test.expectedDeletedNodes, deletedNodes)
+		})
+	}
+}
+
+func TestSpotMigratorRunGenericTaintDeletionPolicy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	clientset := fake.NewSimpleClientset(
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "test-1",
+				UID:               "test-1",
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+			},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "test-2",
+				UID:               "test-2",
+				CreationTimestamp: metav1.NewTime(time.Now()),
+			},
+		},
+	)
+	cloudProvider, err := generic.NewCloudProvider(clientset, &v1alpha1.GenericCloudProvider{
+		SpotInstanceSelector: "node.kubernetes.io/lifecycle=spot",
+		DeletionPolicy:       v1alpha1.GenericDeletionPolicyTaint,
+	})
+	require.Nil(t, err)
+	sm := &spotMigrator{
+		Clientset:     clientset,
+		CloudProvider: cloudProvider,
+	}
+
+	// Nothing deletes the tainted Nodes so the run should complete without waiting for them
+	err = sm.run(ctx)
+	require.Nil(t, err)
+	require.Nil(t, ctx.Err())
+
+	for _, nodeName := range []string{"test-1", "test-2"} {
+		node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		require.Nil(t, err)
+		require.True(t, isRemovalDeferred(node))
+		require.True(t, node.Spec.Unschedulable)
+		taintKeys := []string{}
+		for _, taint := range node.Spec.Taints {
+			taintKeys = append(taintKeys, taint.Key)
+		}
+		// The ToBeDeletedByClusterAutoscaler taint should be removed to allow the cluster
+		// autoscaler to remove the Node
+		require.Equal(t, []string{"cost-manager.io/delete"}, taintKeys)
+	}
+
+	// Nodes whose removal has been deferred should not be selected for deletion again
+	onDemandNodes, err := sm.listOnDemandNodes(ctx)
+	require.Nil(t, err)
+	require.Empty(t, onDemandNodes)
+}
+
+func TestSpotMigratorRunGCPTaintDeletionMode(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	clientset := fake.NewSimpleClientset(
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "test-1",
+				UID:               "test-1",
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour)),
+			},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "test-2",
+				UID:               "test-2",
+				CreationTimestamp: metav1.NewTime(time.Now()),
+			},
+		},
+	)
+	// The Taint deletion mode does not send any GCP API requests but the GCP API services still
+	// need credentials to be created
+	cloudProvider, err := gcp.NewCloudProvider(ctx, &v1alpha1.GCPCloudProvider{
+		CredentialsFile: writeServiceAccountCredentials(t),
+		DeletionMode:    v1alpha1.GCPDeletionModeTaint,
+	}, clientset)
+	require.Nil(t, err)
+	sm := &spotMigrator{
+		Clientset:     clientset,
+		CloudProvider: cloudProvider,
+	}
+
+	// Nothing deletes the tainted Nodes so the run should complete without waiting for them
+	err = sm.run(ctx)
+	require.Nil(t, err)
+	require.Nil(t, ctx.Err())
+
+	for _, nodeName := range []string{"test-1", "test-2"} {
+		node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		require.Nil(t, err)
+		require.True(t, isRemovalDeferred(node))
+		require.True(t, node.Spec.Unschedulable)
+		require.Equal(t, "Taint", node.Annotations["cost-manager.io/deletion-mode"])
+		require.Equal(t, []corev1.Taint{{Key: "cost-manager.io/delete", Effect: corev1.TaintEffectNoSchedule}}, node.Spec.Taints)
+	}
+
+	// Nodes whose removal has been deferred should not be selected for deletion again
+	onDemandNodes, err := sm.listOnDemandNodes(ctx)
+	require.Nil(t, err)
+	require.Empty(t, onDemandNodes)
+}
+
+// writeServiceAccountCredentials writes a GCP service account key file to a temporary directory and
+// returns its path
+func writeServiceAccountCredentials(t *testing.T) string {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.Nil(t, err)
+	credentials, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "my-project",
+		"private_key_id": "my-private-key",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateKeyBytes})),
+		"client_email":   "cost-manager@my-project.iam.gserviceaccount.com",
+	})
+	require.Nil(t, err)
+	credentialsFile := filepath.Join(t.TempDir(), "credentials.json")
+	err = os.WriteFile(credentialsFile, credentials, 0600)
+	require.Nil(t, err)
+	return credentialsFile
+}
+
+// preflightCheckCloudProvider is a fake cloud provider whose pre-flight check always fails
+type preflightCheckCloudProvider struct {
+	cloudproviderfake.CloudProvider
+	reason string
+}
+
+func (cloudProvider *preflightCheckCloudProvider) PreflightCheck(ctx context.Context, onDemandNodes, spotNodes []*corev1.Node) (string, error) {
+	return cloudProvider.reason, nil
+}
+
+func TestSpotMigratorRunSkippedWhenPreflightCheckFails(t *testing.T) {
+	ctx := context.Background()
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+		},
+	}
+	clientset := fake.NewSimpleClientset(node)
+	sm := &spotMigrator{
+		Clientset:     clientset,
+		CloudProvider: &preflightCheckCloudProvider{reason: "no spot capacity"},
+	}
+
+	err := sm.run(ctx)
+	require.ErrorIs(t, err, errPreflightCheckFailed)
+	require.ErrorContains(t, err, "no spot capacity")
+
+	// The Node should not have been selected for deletion
+	node, err = clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+	require.Nil(t, err)
+	require.False(t, isSelectedForDeletion(node))
 }
 
 func TestAnnotateNode(t *testing.T) {
@@ -0,0 +1,362 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	"github.com/hsbc/cost-manager/pkg/cloudprovider"
+	"github.com/hsbc/cost-manager/pkg/kubernetes"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgo "k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	spotPreemptionHandlerControllerName = "spot-preemption-handler"
+
+	// GKE gives spot VMs 30 seconds to shut down after receiving a preemption notice so by default
+	// we stop draining after 25 seconds to leave time for the kubelet to shut down any remaining
+	// Pods gracefully:
+	// https://cloud.google.com/kubernetes-engine/docs/concepts/spot-vms#termination_and_graceful_shutdown_of_spot_vms
+	defaultPreemptionDrainTimeout = 25 * time.Second
+
+	// Spot VMs are typically preempted in batches and each drain blocks a reconcile worker for up to
+	// the drain timeout so we drain multiple Nodes concurrently to make sure that Nodes later in
+	// the batch are drained within their preemption window
+	defaultMaxConcurrentDrains = 10
+
+	// GKE adds this taint to spot Nodes that are about to be preempted
+	impendingNodeTerminationTaintKey = "cloud.google.com/impending-node-termination"
+
+	// The kubelet sets the Ready condition to false with this message when graceful Node shutdown
+	// has been triggered
+	nodeShutdownReadyConditionMessage = "node is shutting down"
+
+	// The GKE node pool label is used to aggregate preemption metrics
+	// https://cloud.google.com/kubernetes-engine/docs/how-to/node-pools#deploy_a_workload_to_a_specific_node_pool
+	nodePoolLabelKey = "cloud.google.com/gke-nodepool"
+
+	// eventInvolvedObjectNameField is used to index cached Events by the name of their involved
+	// object so that the Events for a Node can be listed without listing all cached Events
+	eventInvolvedObjectNameField = "involvedObject.name"
+)
+
+var (
+	spotPreemptionHandlerPreemptionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cost_manager_spot_preemption_handler_preemptions_total",
+		Help: "The total number of spot Node preemptions handled by spot-preemption-handler",
+	}, []string{"node_pool", "zone"})
+	spotPreemptionHandlerDrainFailureTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cost_manager_spot_preemption_handler_drain_failure_total",
+		Help: "The total number of preempted spot Nodes that could not be drained before the drain timeout",
+	})
+
+	// Label to add to Nodes once their preemption has been handled to make sure that each
+	// preemption is only handled and counted once; the value is the boot ID of the Node when it
+	// was preempted so that we can tell when the VM has been recreated with the same name
+	nodePreemptedLabelKey = fmt.Sprintf("%s/%s", v1alpha1.GroupName, "preempted")
+
+	// Node conditions that indicate that a Node is about to be preempted; these are typically set
+	// by node-problem-detector or similar components when a preemption notice is received
+	preemptionNodeConditionTypes = []corev1.NodeConditionType{
+		"TerminationImminent",
+		"PreemptionImminent",
+	}
+
+	// Node Event reasons that indicate that a Node is about to be shut down
+	shutdownNodeEventReasons = []string{
+		"NodeShutdown",
+		"Preempted",
+		"PreemptionScheduled",
+		"TerminationImminent",
+	}
+
+	// Only Events that occurred recently are considered to indicate an imminent preemption
+	shutdownNodeEventMaxAge = 5 * time.Minute
+)
+
+// spotPreemptionHandler watches spot Nodes for signs of imminent preemption and then cordons,
+// taints and drains them within the preemption window. The kubelet's graceful Node shutdown does
+// not respect PodDisruptionBudgets and Pods are not always terminated in time so draining
+// ourselves gives workloads a better chance of moving elsewhere before the VM disappears
+type spotPreemptionHandler struct {
+	Config        *v1alpha1.SpotPreemptionHandler
+	Client        client.Client
+	Clientset     clientgo.Interface
+	CloudProvider cloudprovider.CloudProvider
+}
+
+var _ reconcile.Reconciler = &spotPreemptionHandler{}
+
+func (r *spotPreemptionHandler) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
+	// Register Prometheus metrics
+	metrics.Registry.MustRegister(spotPreemptionHandlerPreemptionsTotal)
+	metrics.Registry.MustRegister(spotPreemptionHandlerDrainFailureTotal)
+
+	err := mgr.GetFieldIndexer().IndexField(ctx, &corev1.Event{}, eventInvolvedObjectNameField, indexEventByInvolvedObjectName)
+	if err != nil {
+		return err
+	}
+
+	maxConcurrentDrains := defaultMaxConcurrentDrains
+	if r.Config != nil && r.Config.MaxConcurrentDrains != nil {
+		maxConcurrentDrains = int(*r.Config.MaxConcurrentDrains)
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Node{}).
+		Watches(&corev1.Event{}, handler.EnqueueRequestsFromMapFunc(mapShutdownEventToNode)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: maxConcurrentDrains}).
+		Complete(r)
+}
+
+func (r *spotPreemptionHandler) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	logger := log.FromContext(ctx, "node", request.Name)
+
+	node := &corev1.Node{}
+	err := r.Client.Get(ctx, request.NamespacedName, node)
+	if errors.IsNotFound(err) {
+		return reconcile.Result{}, nil
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// If we have already handled the preemption of this Node then there is nothing more to do
+	// unless the VM has been recreated with the same name (e.g. by its managed instance group) and
+	// the Node has come back on a new boot, in which case we make it schedulable again. If either
+	// boot ID is not known then we cannot tell whether the Node has been recreated so we leave it
+	if preemptedBootID, ok := getPreemptedBootID(node); ok {
+		bootID := node.Status.NodeInfo.BootID
+		if preemptedBootID == "" || bootID == "" || preemptedBootID == bootID || !isNodeReady(node) {
+			return reconcile.Result{}, nil
+		}
+		err = r.restoreNode(ctx, node)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, nil
+	}
+
+	// We only handle spot Nodes...
+	isSpotInstance, err := r.CloudProvider.IsSpotInstance(ctx, node)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if !isSpotInstance {
+		return reconcile.Result{}, nil
+	}
+
+	// ...that show signs of being preempted. Note that only Events involving Nodes are cached
+	eventList := &corev1.EventList{}
+	err = r.Client.List(ctx, eventList, client.MatchingFields{eventInvolvedObjectNameField: node.Name})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	preemptionSignal, ok := detectPreemption(node, eventList.Items, time.Now())
+	if !ok {
+		return reconcile.Result{}, nil
+	}
+	logger = logger.WithValues("signal", preemptionSignal)
+	ctx = log.IntoContext(ctx, logger)
+	logger.Info("Detected imminent preemption of spot Node")
+
+	// Label the Node first to make sure that the preemption is only counted once even if we fail
+	// to drain the Node in time
+	err = r.addPreemptedLabel(ctx, node)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	spotPreemptionHandlerPreemptionsTotal.WithLabelValues(node.Labels[nodePoolLabelKey], node.Labels[corev1.LabelTopologyZone]).Inc()
+
+	err = r.drainNode(ctx, node)
+	if err != nil {
+		// The Node is about to disappear so there is no point retrying; we rely on Prometheus
+		// metrics to alert us to failures
+		logger.Error(err, "Failed to drain preempted spot Node")
+		spotPreemptionHandlerDrainFailureTotal.Inc()
+		return reconcile.Result{}, nil
+	}
+
+	return reconcile.Result{}, nil
+}
+
+// drainNode taints the Node with ToBeDeletedByClusterAutoscaler to start failing load balancer
+// health checks and then drains it within the configured timeout
+func (r *spotPreemptionHandler) drainNode(ctx context.Context, node *corev1.Node) error {
+	logger := log.FromContext(ctx)
+
+	drainTimeout := defaultPreemptionDrainTimeout
+	if r.Config != nil && r.Config.DrainTimeout != nil {
+		drainTimeout = r.Config.DrainTimeout.Duration
+	}
+	// The timeout applies to both tainting and draining the Node so that the Node is drained within
+	// a known window
+	ctx, cancel := context.WithTimeout(ctx, drainTimeout)
+	defer cancel()
+
+	logger.Info("Adding taint ToBeDeletedByClusterAutoscaler")
+	err := kubernetes.AddToBeDeletedTaint(ctx, r.Clientset, node.Name)
+	if err != nil {
+		return err
+	}
+	logger.Info("Taint ToBeDeletedByClusterAutoscaler added successfully")
+
+	logger.WithValues("drainTimeout", drainTimeout.String()).Info("Draining Node")
+	err = kubernetes.DrainNode(ctx, r.Clientset, node)
+	if err != nil {
+		return err
+	}
+	logger.Info("Drained Node successfully")
+
+	return nil
+}
+
+// restoreNode reverts the changes made when the Node was preempted so that a Node that has come
+// back on a new boot can be scheduled to again and is no longer considered by cluster-autoscaler
+// to be in the process of being deleted
+func (r *spotPreemptionHandler) restoreNode(ctx context.Context, node *corev1.Node) error {
+	logger := log.FromContext(ctx)
+
+	logger.Info("Restoring spot Node that has been recreated since it was preempted")
+	err := kubernetes.UncordonNode(ctx, r.Clientset, node)
+	if err != nil {
+		return err
+	}
+	err = kubernetes.RemoveToBeDeletedTaint(ctx, r.Clientset, node.Name)
+	if err != nil {
+		return err
+	}
+	// The label is removed last so that we retry until the Node has been fully restored
+	err = r.removePreemptedLabel(ctx, node.Name)
+	if err != nil {
+		return err
+	}
+	logger.Info("Restored spot Node successfully")
+
+	return nil
+}
+
+func (r *spotPreemptionHandler) addPreemptedLabel(ctx context.Context, node *corev1.Node) error {
+	patch := []byte(fmt.Sprintf(`{"metadata":{"labels":{"%s":"%s"}}}`, nodePreemptedLabelKey, node.Status.NodeInfo.BootID))
+	_, err := r.Clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *spotPreemptionHandler) removePreemptedLabel(ctx context.Context, nodeName string) error {
+	patch := []byte(fmt.Sprintf(`{"metadata":{"labels":{"%s":null}}}`, nodePreemptedLabelKey))
+	_, err := r.Clientset.CoreV1().Nodes().Patch(ctx, nodeName, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// getPreemptedBootID returns the boot ID of the Node when its preemption was handled if it has
+// been handled
+func getPreemptedBootID(node *corev1.Node) (string, bool) {
+	if node.Labels == nil {
+		return "", false
+	}
+	bootID, ok := node.Labels[nodePreemptedLabelKey]
+	return bootID, ok
+}
+
+// detectPreemption determines whether the Node is about to be preempted based on its taints,
+// conditions and recent Events. If so, a description of the signal that was detected is returned
+func detectPreemption(node *corev1.Node, events []corev1.Event, now time.Time) (string, bool) {
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == impendingNodeTerminationTaintKey {
+			return fmt.Sprintf("taint %s", taint.Key), true
+		}
+	}
+
+	for _, condition := range node.Status.Conditions {
+		if slices.Contains(preemptionNodeConditionTypes, condition.Type) && condition.Status == corev1.ConditionTrue {
+			return fmt.Sprintf("condition %s", condition.Type), true
+		}
+		if condition.Type == corev1.NodeReady && condition.Status != corev1.ConditionTrue && strings.Contains(condition.Message, nodeShutdownReadyConditionMessage) {
+			return fmt.Sprintf("condition %s", condition.Type), true
+		}
+	}
+
+	for _, event := range events {
+		if event.InvolvedObject.Name != node.Name || !isShutdownNodeEvent(&event) {
+			continue
+		}
+		// Ignore Events that were emitted for a previous Node or boot with the same name or that
+		// are too old to indicate that a preemption is imminent
+		eventTime := getEventTime(&event)
+		if eventTime.Before(node.CreationTimestamp.Time) || eventTime.Before(getNodeReadyTime(node)) || now.Sub(eventTime) > shutdownNodeEventMaxAge {
+			continue
+		}
+		return fmt.Sprintf("event %s", event.Reason), true
+	}
+
+	return "", false
+}
+
+// getNodeReadyTime returns the time at which the Node last became Ready or the zero time if it is
+// not Ready
+func getNodeReadyTime(node *corev1.Node) time.Time {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady && condition.Status == corev1.ConditionTrue {
+			return condition.LastTransitionTime.Time
+		}
+	}
+	return time.Time{}
+}
+
+func isShutdownNodeEvent(event *corev1.Event) bool {
+	return event.InvolvedObject.Kind == "Node" && slices.Contains(shutdownNodeEventReasons, event.Reason)
+}
+
+// getEventTime returns the most recent time at which the Event was observed
+func getEventTime(event *corev1.Event) time.Time {
+	if event.Series != nil && !event.Series.LastObservedTime.IsZero() {
+		return event.Series.LastObservedTime.Time
+	}
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+// indexEventByInvolvedObjectName indexes Events by the name of their involved object
+func indexEventByInvolvedObjectName(object client.Object) []string {
+	event, ok := object.(*corev1.Event)
+	if !ok {
+		return nil
+	}
+	return []string{event.InvolvedObject.Name}
+}
+
+// mapShutdownEventToNode enqueues the Node involved in any shutdown-related Event
+func mapShutdownEventToNode(ctx context.Context, object client.Object) []reconcile.Request {
+	event, ok := object.(*corev1.Event)
+	if !ok || !isShutdownNodeEvent(event) {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: event.InvolvedObject.Name}}}
+}
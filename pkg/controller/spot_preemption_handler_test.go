@@ -0,0 +1,442 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cloudproviderfake "github.com/hsbc/cost-manager/pkg/cloudprovider/fake"
+	"github.com/hsbc/cost-manager/pkg/kubernetes"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	clientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestDetectPreemption(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	nodeCreationTimestamp := metav1.NewTime(now.Add(-time.Hour))
+	tests := map[string]struct {
+		node              *corev1.Node
+		events            []corev1.Event
+		preemptionPending bool
+	}{
+		"noSignals": {
+			node:              &corev1.Node{},
+			preemptionPending: false,
+		},
+		"impendingNodeTerminationTaint": {
+			node: &corev1.Node{
+				Spec: corev1.NodeSpec{
+					Taints: []corev1.Taint{
+						{
+							Key:    "cloud.google.com/impending-node-termination",
+							Effect: corev1.TaintEffectNoSchedule,
+						},
+					},
+				},
+			},
+			preemptionPending: true,
+		},
+		"otherTaint": {
+			node: &corev1.Node{
+				Spec: corev1.NodeSpec{
+					Taints: []corev1.Taint{
+						{
+							Key:    "foo",
+							Effect: corev1.TaintEffectNoSchedule,
+						},
+					},
+				},
+			},
+			preemptionPending: false,
+		},
+		"terminationImminentCondition": {
+			node: &corev1.Node{
+				Status: corev1.NodeStatus{
+					Conditions: []corev1.NodeCondition{
+						{
+							Type:   "TerminationImminent",
+							Status: corev1.ConditionTrue,
+						},
+					},
+				},
+			},
+			preemptionPending: true,
+		},
+		"terminationImminentConditionFalse": {
+			node: &corev1.Node{
+				Status: corev1.NodeStatus{
+					Conditions: []corev1.NodeCondition{
+						{
+							Type:   "TerminationImminent",
+							Status: corev1.ConditionFalse,
+						},
+					},
+				},
+			},
+			preemptionPending: false,
+		},
+		"notReadyShuttingDown": {
+			node: &corev1.Node{
+				Status: corev1.NodeStatus{
+					Conditions: []corev1.NodeCondition{
+						{
+							Type:    corev1.NodeReady,
+							Status:  corev1.ConditionFalse,
+							Message: "container runtime status check may not have completed yet, node is shutting down",
+						},
+					},
+				},
+			},
+			preemptionPending: true,
+		},
+		"notReadyForAnotherReason": {
+			node: &corev1.Node{
+				Status: corev1.NodeStatus{
+					Conditions: []corev1.NodeCondition{
+						{
+							Type:    corev1.NodeReady,
+							Status:  corev1.ConditionFalse,
+							Message: "PLEG is not healthy",
+						},
+					},
+				},
+			},
+			preemptionPending: false,
+		},
+		"recentShutdownEvent": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test",
+					CreationTimestamp: nodeCreationTimestamp,
+				},
+			},
+			events: []corev1.Event{
+				{
+					InvolvedObject: corev1.ObjectReference{Kind: "Node", Name: "test"},
+					Reason:         "NodeShutdown",
+					LastTimestamp:  metav1.NewTime(now.Add(-time.Minute)),
+				},
+			},
+			preemptionPending: true,
+		},
+		"oldShutdownEvent": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test",
+					CreationTimestamp: nodeCreationTimestamp,
+				},
+			},
+			events: []corev1.Event{
+				{
+					InvolvedObject: corev1.ObjectReference{Kind: "Node", Name: "test"},
+					Reason:         "NodeShutdown",
+					LastTimestamp:  metav1.NewTime(now.Add(-10 * time.Minute)),
+				},
+			},
+			preemptionPending: false,
+		},
+		"shutdownEventForPreviousNode": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test",
+					CreationTimestamp: metav1.NewTime(now.Add(-time.Second)),
+				},
+			},
+			events: []corev1.Event{
+				{
+					InvolvedObject: corev1.ObjectReference{Kind: "Node", Name: "test"},
+					Reason:         "NodeShutdown",
+					LastTimestamp:  metav1.NewTime(now.Add(-time.Minute)),
+				},
+			},
+			preemptionPending: false,
+		},
+		"shutdownEventForPreviousBoot": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test",
+					CreationTimestamp: nodeCreationTimestamp,
+				},
+				Status: corev1.NodeStatus{
+					Conditions: []corev1.NodeCondition{
+						{
+							Type:               corev1.NodeReady,
+							Status:             corev1.ConditionTrue,
+							LastTransitionTime: metav1.NewTime(now.Add(-time.Second)),
+						},
+					},
+				},
+			},
+			events: []corev1.Event{
+				{
+					InvolvedObject: corev1.ObjectReference{Kind: "Node", Name: "test"},
+					Reason:         "NodeShutdown",
+					LastTimestamp:  metav1.NewTime(now.Add(-time.Minute)),
+				},
+			},
+			preemptionPending: false,
+		},
+		"otherEvent": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test",
+					CreationTimestamp: nodeCreationTimestamp,
+				},
+			},
+			events: []corev1.Event{
+				{
+					InvolvedObject: corev1.ObjectReference{Kind: "Node", Name: "test"},
+					Reason:         "NodeReady",
+					LastTimestamp:  metav1.NewTime(now.Add(-time.Minute)),
+				},
+			},
+			preemptionPending: false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, preemptionPending := detectPreemption(test.node, test.events, now)
+			require.Equal(t, test.preemptionPending, preemptionPending)
+		})
+	}
+}
+
+func TestSpotPreemptionHandlerReconcile(t *testing.T) {
+	tests := map[string]struct {
+		node         *corev1.Node
+		events       []*corev1.Event
+		shouldHandle bool
+	}{
+		"preemptedSpotNode": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					Labels: map[string]string{
+						cloudproviderfake.SpotInstanceLabelKey: cloudproviderfake.SpotInstanceLabelValue,
+					},
+				},
+				Spec: corev1.NodeSpec{
+					Taints: []corev1.Taint{
+						{
+							Key:    "cloud.google.com/impending-node-termination",
+							Effect: corev1.TaintEffectNoSchedule,
+						},
+					},
+				},
+			},
+			shouldHandle: true,
+		},
+		"preemptedOnDemandNode": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: corev1.NodeSpec{
+					Taints: []corev1.Taint{
+						{
+							Key:    "cloud.google.com/impending-node-termination",
+							Effect: corev1.TaintEffectNoSchedule,
+						},
+					},
+				},
+			},
+			shouldHandle: false,
+		},
+		"spotNode": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					Labels: map[string]string{
+						cloudproviderfake.SpotInstanceLabelKey: cloudproviderfake.SpotInstanceLabelValue,
+					},
+				},
+			},
+			shouldHandle: false,
+		},
+		"spotNodeWithShutdownEvent": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					Labels: map[string]string{
+						cloudproviderfake.SpotInstanceLabelKey: cloudproviderfake.SpotInstanceLabelValue,
+					},
+				},
+			},
+			events: []*corev1.Event{
+				{
+					ObjectMeta:     metav1.ObjectMeta{Name: "test.shutdown", Namespace: "default"},
+					InvolvedObject: corev1.ObjectReference{Kind: "Node", Name: "test"},
+					Reason:         "NodeShutdown",
+					LastTimestamp:  metav1.Now(),
+				},
+			},
+			shouldHandle: true,
+		},
+		"spotNodeWithShutdownEventForOtherNode": {
+			node: &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					Labels: map[string]string{
+						cloudproviderfake.SpotInstanceLabelKey: cloudproviderfake.SpotInstanceLabelValue,
+					},
+				},
+			},
+			events: []*corev1.Event{
+				{
+					ObjectMeta:     metav1.ObjectMeta{Name: "other.shutdown", Namespace: "default"},
+					InvolvedObject: corev1.ObjectReference{Kind: "Node", Name: "other"},
+					Reason:         "NodeShutdown",
+					LastTimestamp:  metav1.Now(),
+				},
+			},
+			shouldHandle: false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			scheme, err := kubernetes.NewScheme()
+			require.Nil(t, err)
+			clientset := fake.NewSimpleClientset(test.node.DeepCopy())
+			objects := []client.Object{test.node.DeepCopy()}
+			for _, event := range test.events {
+				objects = append(objects, event)
+			}
+			client := clientfake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(objects...).
+				WithIndex(&corev1.Event{}, eventInvolvedObjectNameField, indexEventByInvolvedObjectName).
+				Build()
+			spotPreemptionHandler := &spotPreemptionHandler{
+				Client:        client,
+				Clientset:     clientset,
+				CloudProvider: &cloudproviderfake.CloudProvider{},
+			}
+
+			_, err = spotPreemptionHandler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: test.node.Name}})
+			require.Nil(t, err)
+
+			node, err := clientset.CoreV1().Nodes().Get(ctx, test.node.Name, metav1.GetOptions{})
+			require.Nil(t, err)
+			_, isPreempted := getPreemptedBootID(node)
+			require.Equal(t, test.shouldHandle, isPreempted)
+			require.Equal(t, test.shouldHandle, node.Spec.Unschedulable)
+			hasToBeDeletedTaint := false
+			for _, taint := range node.Spec.Taints {
+				if taint.Key == "ToBeDeletedByClusterAutoscaler" && taint.Effect == "NoSchedule" {
+					hasToBeDeletedTaint = true
+					break
+				}
+			}
+			require.Equal(t, test.shouldHandle, hasToBeDeletedTaint)
+		})
+	}
+}
+
+func TestSpotPreemptionHandlerReconcileRecreatedNode(t *testing.T) {
+	tests := map[string]struct {
+		preemptedBootID string
+		bootID          string
+		ready           corev1.ConditionStatus
+		shouldRestore   bool
+	}{
+		"sameBoot": {
+			preemptedBootID: "before",
+			bootID:          "before",
+			ready:           corev1.ConditionTrue,
+			shouldRestore:   false,
+		},
+		"newBootNotReady": {
+			preemptedBootID: "before",
+			bootID:          "after",
+			ready:           corev1.ConditionFalse,
+			shouldRestore:   false,
+		},
+		"newBootReady": {
+			preemptedBootID: "before",
+			bootID:          "after",
+			ready:           corev1.ConditionTrue,
+			shouldRestore:   true,
+		},
+		"unknownBoot": {
+			preemptedBootID: "",
+			bootID:          "",
+			ready:           corev1.ConditionTrue,
+			shouldRestore:   false,
+		},
+		"unknownPreemptedBoot": {
+			preemptedBootID: "",
+			bootID:          "after",
+			ready:           corev1.ConditionTrue,
+			shouldRestore:   false,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			// The Node was preempted on its previous boot and its VM has since been recreated
+			// with the same name
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+					Labels: map[string]string{
+						cloudproviderfake.SpotInstanceLabelKey: cloudproviderfake.SpotInstanceLabelValue,
+						"cost-manager.io/preempted":            test.preemptedBootID,
+					},
+				},
+				Spec: corev1.NodeSpec{
+					Unschedulable: true,
+					Taints: []corev1.Taint{
+						{
+							Key:    "ToBeDeletedByClusterAutoscaler",
+							Effect: corev1.TaintEffectNoSchedule,
+						},
+					},
+				},
+				Status: corev1.NodeStatus{
+					Conditions: []corev1.NodeCondition{
+						{
+							Type:   corev1.NodeReady,
+							Status: test.ready,
+						},
+					},
+					NodeInfo: corev1.NodeSystemInfo{
+						BootID: test.bootID,
+					},
+				},
+			}
+
+			scheme, err := kubernetes.NewScheme()
+			require.Nil(t, err)
+			clientset := fake.NewSimpleClientset(node.DeepCopy())
+			client := clientfake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(node.DeepCopy()).
+				WithIndex(&corev1.Event{}, eventInvolvedObjectNameField, indexEventByInvolvedObjectName).
+				Build()
+			spotPreemptionHandler := &spotPreemptionHandler{
+				Client:        client,
+				Clientset:     clientset,
+				CloudProvider: &cloudproviderfake.CloudProvider{},
+			}
+
+			_, err = spotPreemptionHandler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: node.Name}})
+			require.Nil(t, err)
+
+			node, err = clientset.CoreV1().Nodes().Get(ctx, node.Name, metav1.GetOptions{})
+			require.Nil(t, err)
+			_, isPreempted := getPreemptedBootID(node)
+			require.Equal(t, !test.shouldRestore, isPreempted)
+			require.Equal(t, !test.shouldRestore, node.Spec.Unschedulable)
+			require.Equal(t, !test.shouldRestore, len(node.Spec.Taints) > 0)
+		})
+	}
+}
@@ -16,9 +16,7 @@ func WaitUntilDeploymentAvailable(ctx context.Context, kubeClient client.WithWat
 		if err != nil {
 			return false, err
 		}
-		return deployment.Name == deploymentName &&
-			deployment.Status.AvailableReplicas > 0 &&
-			deployment.Generation == deployment.Status.ObservedGeneration, nil
+		return deployment.Name == deploymentName && IsDeploymentAvailable(deployment, 1), nil
 	}
 	_, err := watch.UntilWithSync(ctx, listerWatcher, &appsv1.Deployment{}, nil, condition)
 	return err
@@ -38,3 +36,20 @@ func WaitUntilDeploymentUnavailable(ctx context.Context, kubeClient client.WithW
 	_, err := watch.UntilWithSync(ctx, listerWatcher, &appsv1.Deployment{}, nil, condition)
 	return err
 }
+
+// IsDeploymentAvailable returns true if the Deployment controller has observed the latest
+// Deployment spec and at least the specified number of replicas are available. Replicas that have
+// not been updated to the latest Deployment spec are counted so that a rollout in progress does not
+// make the Deployment unavailable
+func IsDeploymentAvailable(deployment *appsv1.Deployment, minAvailableReplicas int32) bool {
+	return deployment.Generation == deployment.Status.ObservedGeneration &&
+		deployment.Status.AvailableReplicas >= minAvailableReplicas
+}
+
+// GetDeploymentReplicas returns the desired replicas of the Deployment, which default to 1 if not set
+func GetDeploymentReplicas(deployment *appsv1.Deployment) int32 {
+	if deployment.Spec.Replicas != nil {
+		return *deployment.Spec.Replicas
+	}
+	return 1
+}
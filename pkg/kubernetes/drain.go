@@ -24,6 +24,13 @@ const (
 // DrainNode uses the default drain implementation to drain the Node:
 // https://github.com/kubernetes/kubectl/blob/3ec401449e5821ad954942c7ecec9d2c90ecaaa1/pkg/drain/default.go
 func DrainNode(ctx context.Context, clientset kubernetes.Interface, node *corev1.Node) error {
+	return DrainNodeWithTimeout(ctx, clientset, node, nodeDrainTimeout)
+}
+
+// DrainNodeWithTimeout drains the Node in the same way as DrainNode but gives up once the specified
+// timeout has been reached; this allows the Node to be drained within a known window (e.g. before
+// a spot VM is preempted)
+func DrainNodeWithTimeout(ctx context.Context, clientset kubernetes.Interface, node *corev1.Node, timeout time.Duration) error {
 	// https://github.com/kubernetes/kubectl/blob/3ec401449e5821ad954942c7ecec9d2c90ecaaa1/pkg/cmd/drain/drain.go#L147-L160
 	drainer := &drain.Helper{
 		Ctx:                 ctx,
@@ -31,7 +38,7 @@ func DrainNode(ctx context.Context, clientset kubernetes.Interface, node *corev1
 		Force:               true,
 		GracePeriodSeconds:  -1,
 		IgnoreAllDaemonSets: true,
-		Timeout:             nodeDrainTimeout,
+		Timeout:             timeout,
 		DeleteEmptyDirData:  true,
 		Out:                 io.Discard,
 		ErrOut:              io.Discard,
@@ -50,6 +57,21 @@ func DrainNode(ctx context.Context, clientset kubernetes.Interface, node *corev1
 	return nil
 }
 
+// UncordonNode marks the Node as schedulable
+func UncordonNode(ctx context.Context, clientset kubernetes.Interface, node *corev1.Node) error {
+	drainer := &drain.Helper{
+		Ctx:    ctx,
+		Client: clientset,
+		Out:    io.Discard,
+		ErrOut: io.Discard,
+	}
+	err := drain.RunCordonOrUncordon(drainer, node, false)
+	if err != nil {
+		return errors.Wrapf(err, "failed to uncordon Node %s", node.Name)
+	}
+	return nil
+}
+
 func WaitForNodeToBeDeleted(ctx context.Context, clientset kubernetes.Interface, nodeName string) error {
 	nodeList, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 	if err != nil {
@@ -1,7 +1,128 @@
 package kubernetes
 
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hsbc/cost-manager/pkg/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
 const (
 	// https://github.com/kubernetes/autoscaler/blob/5bf33b23f2bcf5f9c8ccaf99d445e25366ee7f40/cluster-autoscaler/utils/taints/taints.go#L39-L42
 	ToBeDeletedTaint       = "ToBeDeletedByClusterAutoscaler"
 	DeletionCandidateTaint = "DeletionCandidateOfClusterAutoscaler"
 )
+
+var (
+	// DeleteTaint is the default taint key used to mark Nodes for removal by an external
+	// autoscaler when cost-manager does not remove them itself
+	DeleteTaint = fmt.Sprintf("%s/%s", v1alpha1.GroupName, "delete")
+)
+
+// AddToBeDeletedTaint adds the ToBeDeletedByClusterAutoscaler taint to the Node to tell kube-proxy
+// to start failing its healthz and subsequently load balancer health checks depending on provider:
+// https://github.com/kubernetes/enhancements/tree/27ef0d9a740ae5058472aac4763483f0e7218c0e/keps/sig-network/3836-kube-proxy-improved-ingress-connectivity-reliability
+func AddToBeDeletedTaint(ctx context.Context, clientset kubernetes.Interface, nodeName string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		hasToBeDeletedTaint := false
+		for _, taint := range node.Spec.Taints {
+			if taint.Key == ToBeDeletedTaint {
+				hasToBeDeletedTaint = true
+				break
+			}
+		}
+		if !hasToBeDeletedTaint {
+			// https://github.com/kubernetes/autoscaler/blob/5bf33b23f2bcf5f9c8ccaf99d445e25366ee7f40/cluster-autoscaler/utils/taints/taints.go#L166-L174
+			node.Spec.Taints = append(node.Spec.Taints, corev1.Taint{
+				Key:    ToBeDeletedTaint,
+				Value:  fmt.Sprint(time.Now().Unix()),
+				Effect: corev1.TaintEffectNoSchedule,
+			})
+			_, err := clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// RemoveToBeDeletedTaint removes the ToBeDeletedByClusterAutoscaler taint from the Node if present
+func RemoveToBeDeletedTaint(ctx context.Context, clientset kubernetes.Interface, nodeName string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		taints := []corev1.Taint{}
+		for _, taint := range node.Spec.Taints {
+			if taint.Key != ToBeDeletedTaint {
+				taints = append(taints, taint)
+			}
+		}
+		if len(taints) == len(node.Spec.Taints) {
+			return nil
+		}
+		node.Spec.Taints = taints
+		_, err = clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// AddTaint adds the taint to the Node if it is not already present
+func AddTaint(ctx context.Context, clientset kubernetes.Interface, nodeName string, taint corev1.Taint) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		for _, existingTaint := range node.Spec.Taints {
+			if existingTaint.MatchTaint(&taint) {
+				return nil
+			}
+		}
+		node.Spec.Taints = append(node.Spec.Taints, taint)
+		_, err = clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// TimeSinceToBeDeletedTaintAdded returns how long ago the ToBeDeletedByClusterAutoscaler taint was
+// added to the Node based on the Unix timestamp in the taint value; this can be used to determine
+// how long load balancers have been failing health checks for the Node
+func TimeSinceToBeDeletedTaintAdded(node *corev1.Node, now time.Time) time.Duration {
+	// Retrieve taint value
+	toBeDeletedTaintAddedValue := ""
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == ToBeDeletedTaint && taint.Effect == corev1.TaintEffectNoSchedule {
+			toBeDeletedTaintAddedValue = taint.Value
+			break
+		}
+	}
+
+	// Attempt to parse taint value as Unix timestamp
+	unixTimeSeconds, err := strconv.ParseInt(toBeDeletedTaintAddedValue, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	timeSinceToBeDeletedTaintAdded := now.Sub(time.Unix(unixTimeSeconds, 0))
+	// Ignore negative durations to avoid waiting for an unbounded amount of time
+	if timeSinceToBeDeletedTaintAdded < 0 {
+		return 0
+	}
+	return timeSinceToBeDeletedTaintAdded
+}
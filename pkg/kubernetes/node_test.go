@@ -0,0 +1,60 @@
+package kubernetes
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestTimeSinceToBeDeletedTaintAdded(t *testing.T) {
+	tests := map[string]struct {
+		node                           *corev1.Node
+		now                            time.Time
+		timeSinceToBeDeletedTaintAdded time.Duration
+	}{
+		"missingTaint": {
+			node:                           &corev1.Node{},
+			now:                            time.Now(),
+			timeSinceToBeDeletedTaintAdded: 0,
+		},
+		"recentTaint": {
+			node: &corev1.Node{
+				Spec: corev1.NodeSpec{
+					Taints: []corev1.Taint{
+						{
+							Key:    "ToBeDeletedByClusterAutoscaler",
+							Value:  fmt.Sprint(time.Date(0, 0, 0, 0, 0, 0, 0, time.UTC).Unix()),
+							Effect: corev1.TaintEffectNoSchedule,
+						},
+					},
+				},
+			},
+			now:                            time.Date(0, 0, 0, 0, 1, 0, 0, time.UTC),
+			timeSinceToBeDeletedTaintAdded: time.Minute,
+		},
+		"futureTaint": {
+			node: &corev1.Node{
+				Spec: corev1.NodeSpec{
+					Taints: []corev1.Taint{
+						{
+							Key:    "ToBeDeletedByClusterAutoscaler",
+							Value:  fmt.Sprint(time.Date(0, 0, 0, 0, 1, 0, 0, time.UTC).Unix()),
+							Effect: corev1.TaintEffectNoSchedule,
+						},
+					},
+				},
+			},
+			now:                            time.Date(0, 0, 0, 0, 0, 0, 0, time.UTC),
+			timeSinceToBeDeletedTaintAdded: 0,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			timeSinceToBeDeletedTaintAdded := TimeSinceToBeDeletedTaintAdded(test.node, test.now)
+			require.Equal(t, test.timeSinceToBeDeletedTaintAdded, timeSinceToBeDeletedTaintAdded)
+		})
+	}
+}
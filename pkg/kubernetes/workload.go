@@ -0,0 +1,150 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	DeploymentKind  = "Deployment"
+	StatefulSetKind = "StatefulSet"
+	ReplicaSetKind  = "ReplicaSet"
+	DaemonSetKind   = "DaemonSet"
+)
+
+// WorkloadReference identifies a workload that owns Pods
+type WorkloadReference struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (w WorkloadReference) String() string {
+	return fmt.Sprintf("%s %s/%s", w.Kind, w.Namespace, w.Name)
+}
+
+// ListNodeWorkloads lists the Deployments, StatefulSets and ReplicaSets that own Pods running on
+// the Node. Pods owned by DaemonSets are ignored since they are not evicted when the Node is
+// drained, as are Pods without a supported owner
+func ListNodeWorkloads(ctx context.Context, clientset kubernetes.Interface, nodeName string) ([]WorkloadReference, error) {
+	podList, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	workloadSet := map[WorkloadReference]bool{}
+	for _, pod := range podList.Items {
+		// Field selectors are not supported by all clients so we check the Node name again here
+		if pod.Spec.NodeName != nodeName {
+			continue
+		}
+		workload, err := getPodWorkload(ctx, clientset, &pod)
+		if err != nil {
+			return nil, err
+		}
+		if workload != nil {
+			workloadSet[*workload] = true
+		}
+	}
+
+	workloads := []WorkloadReference{}
+	for workload := range workloadSet {
+		workloads = append(workloads, workload)
+	}
+	sort.Slice(workloads, func(i, j int) bool {
+		return workloads[i].String() < workloads[j].String()
+	})
+	return workloads, nil
+}
+
+// getPodWorkload returns the top-level workload that owns the Pod; ReplicaSets owned by a
+// Deployment are resolved to the Deployment
+func getPodWorkload(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod) (*WorkloadReference, error) {
+	ownerReference := metav1.GetControllerOf(pod)
+	if ownerReference == nil {
+		return nil, nil
+	}
+	switch ownerReference.Kind {
+	case StatefulSetKind:
+		return &WorkloadReference{Kind: StatefulSetKind, Namespace: pod.Namespace, Name: ownerReference.Name}, nil
+	case ReplicaSetKind:
+		replicaSet, err := clientset.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, ownerReference.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		replicaSetOwnerReference := metav1.GetControllerOf(replicaSet)
+		if replicaSetOwnerReference != nil && replicaSetOwnerReference.Kind == DeploymentKind {
+			return &WorkloadReference{Kind: DeploymentKind, Namespace: pod.Namespace, Name: replicaSetOwnerReference.Name}, nil
+		}
+		return &WorkloadReference{Kind: ReplicaSetKind, Namespace: pod.Namespace, Name: replicaSet.Name}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// IsWorkloadFullyAvailable determines whether all desired replicas of the workload are available.
+// Workloads that no longer exist are considered to be available since there is nothing to recover
+func IsWorkloadFullyAvailable(ctx context.Context, clientset kubernetes.Interface, workload WorkloadReference) (bool, error) {
+	switch workload.Kind {
+	case DeploymentKind:
+		deployment, err := clientset.AppsV1().Deployments(workload.Namespace).Get(ctx, workload.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return IsDeploymentAvailable(deployment, GetDeploymentReplicas(deployment)), nil
+	case StatefulSetKind:
+		statefulSet, err := clientset.AppsV1().StatefulSets(workload.Namespace).Get(ctx, workload.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return isStatefulSetFullyAvailable(statefulSet), nil
+	case ReplicaSetKind:
+		replicaSet, err := clientset.AppsV1().ReplicaSets(workload.Namespace).Get(ctx, workload.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return isReplicaSetFullyAvailable(replicaSet), nil
+	default:
+		return false, fmt.Errorf("unsupported workload kind: %s", workload.Kind)
+	}
+}
+
+func isStatefulSetFullyAvailable(statefulSet *appsv1.StatefulSet) bool {
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	return statefulSet.Generation == statefulSet.Status.ObservedGeneration &&
+		statefulSet.Status.AvailableReplicas >= replicas
+}
+
+func isReplicaSetFullyAvailable(replicaSet *appsv1.ReplicaSet) bool {
+	replicas := int32(1)
+	if replicaSet.Spec.Replicas != nil {
+		replicas = *replicaSet.Spec.Replicas
+	}
+	return replicaSet.Generation == replicaSet.Status.ObservedGeneration &&
+		replicaSet.Status.AvailableReplicas >= replicas
+}
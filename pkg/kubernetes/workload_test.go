@@ -0,0 +1,176 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"knative.dev/pkg/ptr"
+)
+
+func TestListNodeWorkloads(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo-123",
+				Namespace: "test",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "Deployment", Name: "foo", Controller: ptr.Bool(true)},
+				},
+			},
+		},
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "bar",
+				Namespace: "test",
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo-123-abc",
+				Namespace: "test",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "ReplicaSet", Name: "foo-123", Controller: ptr.Bool(true)},
+				},
+			},
+			Spec: corev1.PodSpec{NodeName: "node"},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo-123-def",
+				Namespace: "test",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "ReplicaSet", Name: "foo-123", Controller: ptr.Bool(true)},
+				},
+			},
+			Spec: corev1.PodSpec{NodeName: "node"},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "bar-abc",
+				Namespace: "test",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "ReplicaSet", Name: "bar", Controller: ptr.Bool(true)},
+				},
+			},
+			Spec: corev1.PodSpec{NodeName: "node"},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "baz-0",
+				Namespace: "test",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "StatefulSet", Name: "baz", Controller: ptr.Bool(true)},
+				},
+			},
+			Spec: corev1.PodSpec{NodeName: "node"},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "daemon-abc",
+				Namespace: "test",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "DaemonSet", Name: "daemon", Controller: ptr.Bool(true)},
+				},
+			},
+			Spec: corev1.PodSpec{NodeName: "node"},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "bare",
+				Namespace: "test",
+			},
+			Spec: corev1.PodSpec{NodeName: "node"},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "other-0",
+				Namespace: "test",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "StatefulSet", Name: "other", Controller: ptr.Bool(true)},
+				},
+			},
+			Spec: corev1.PodSpec{NodeName: "other-node"},
+		},
+	)
+
+	workloads, err := ListNodeWorkloads(ctx, clientset, "node")
+	require.Nil(t, err)
+	require.Equal(t, []WorkloadReference{
+		{Kind: "Deployment", Namespace: "test", Name: "foo"},
+		{Kind: "ReplicaSet", Namespace: "test", Name: "bar"},
+		{Kind: "StatefulSet", Namespace: "test", Name: "baz"},
+	}, workloads)
+}
+
+func TestIsWorkloadFullyAvailable(t *testing.T) {
+	tests := map[string]struct {
+		workload  WorkloadReference
+		available bool
+	}{
+		"availableDeployment": {
+			workload:  WorkloadReference{Kind: "Deployment", Namespace: "test", Name: "available"},
+			available: true,
+		},
+		"degradedDeployment": {
+			workload:  WorkloadReference{Kind: "Deployment", Namespace: "test", Name: "degraded"},
+			available: false,
+		},
+		"rollingOutDeployment": {
+			workload:  WorkloadReference{Kind: "Deployment", Namespace: "test", Name: "rolling-out"},
+			available: true,
+		},
+		"degradedStatefulSet": {
+			workload:  WorkloadReference{Kind: "StatefulSet", Namespace: "test", Name: "degraded"},
+			available: false,
+		},
+		"availableReplicaSet": {
+			workload:  WorkloadReference{Kind: "ReplicaSet", Namespace: "test", Name: "available"},
+			available: true,
+		},
+		"missingDeployment": {
+			workload:  WorkloadReference{Kind: "Deployment", Namespace: "test", Name: "missing"},
+			available: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			clientset := fake.NewSimpleClientset(
+				&appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{Name: "available", Namespace: "test"},
+					Spec:       appsv1.DeploymentSpec{Replicas: ptr.Int32(2)},
+					Status:     appsv1.DeploymentStatus{UpdatedReplicas: 2, AvailableReplicas: 2},
+				},
+				&appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{Name: "degraded", Namespace: "test"},
+					Spec:       appsv1.DeploymentSpec{Replicas: ptr.Int32(2)},
+					Status:     appsv1.DeploymentStatus{UpdatedReplicas: 2, AvailableReplicas: 1},
+				},
+				&appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{Name: "rolling-out", Namespace: "test"},
+					Spec:       appsv1.DeploymentSpec{Replicas: ptr.Int32(2)},
+					Status:     appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 2},
+				},
+				&appsv1.StatefulSet{
+					ObjectMeta: metav1.ObjectMeta{Name: "degraded", Namespace: "test"},
+					Spec:       appsv1.StatefulSetSpec{Replicas: ptr.Int32(3)},
+					Status:     appsv1.StatefulSetStatus{AvailableReplicas: 2},
+				},
+				&appsv1.ReplicaSet{
+					ObjectMeta: metav1.ObjectMeta{Name: "available", Namespace: "test"},
+					Spec:       appsv1.ReplicaSetSpec{Replicas: ptr.Int32(1)},
+					Status:     appsv1.ReplicaSetStatus{AvailableReplicas: 1},
+				},
+			)
+			available, err := IsWorkloadFullyAvailable(ctx, clientset, test.workload)
+			require.Nil(t, err)
+			require.Equal(t, test.available, available)
+		})
+	}
+}